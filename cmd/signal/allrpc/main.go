@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/pion/ion-log"
 	"github.com/pion/ion-sfu/cmd/signal/allrpc/server"
@@ -11,11 +16,10 @@ import (
 	"github.com/spf13/viper"
 )
 
-const (
-	portRangeLimit = 1024
-)
-
 var (
+	fixByFile = []string{"asm_amd64.s", "proc.go", "icegatherer.go", "jsonrpc2"}
+	fixByFunc = []string{"Handle"}
+
 	file                string
 	cert                string
 	key                 string
@@ -44,37 +48,53 @@ func showHelp() {
 }
 
 func load() bool {
-	_, err := os.Stat(file)
+	c, err := readConfig()
 	if err != nil {
+		fmt.Printf("config file %s loaded failed. %v\n", file, err)
 		return false
 	}
+	conf = c
+
+	fmt.Printf("config %s load ok!\n", file)
+	return true
+}
+
+// readConfig reads and validates the config file
+func readConfig() (Config, error) {
+	c := Config{}
+	if _, err := os.Stat(file); err != nil {
+		return c, err
+	}
 
 	viper.SetConfigFile(file)
 	viper.SetConfigType("toml")
 
-	err = viper.ReadInConfig()
-	if err != nil {
-		fmt.Printf("config file %s read failed. %v\n", file, err)
-		return false
+	if err := viper.ReadInConfig(); err != nil {
+		return c, err
 	}
-	err = viper.GetViper().Unmarshal(&conf)
-	if err != nil {
-		fmt.Printf("sfu config file %s loaded failed. %v\n", file, err)
-		return false
+	if err := viper.GetViper().Unmarshal(&c); err != nil {
+		return c, err
 	}
+	return c, c.Validate()
+}
 
-	if len(conf.WebRTC.ICEPortRange) > 2 {
-		fmt.Printf("config file %s loaded failed. range port must be [min,max]\n", file)
-		return false
+// reload re-reads the config file and applies it to the running server
+func reload(node *server.Server) {
+	c, err := readConfig()
+	if err != nil {
+		log.Errorf("Reloading config file %s err: %v", file, err)
+		return
 	}
-
-	if len(conf.WebRTC.ICEPortRange) != 0 && conf.WebRTC.ICEPortRange[1]-conf.WebRTC.ICEPortRange[0] < portRangeLimit {
-		fmt.Printf("config file %s loaded failed. range port must be [min, max] and max - min >= %d\n", file, portRangeLimit)
-		return false
+	restart, err := node.Reload(c.Config)
+	if err != nil {
+		log.Errorf("Reloading config file %s err: %v", file, err)
+		return
 	}
-
-	fmt.Printf("config %s load ok!\n", file)
-	return true
+	if len(restart) > 0 {
+		log.Warnf("Config %s reloaded, restart needed to apply: %s", file, strings.Join(restart, ", "))
+		return
+	}
+	log.Infof("Config %s reloaded", file)
 }
 
 func parse() bool {
@@ -107,12 +127,14 @@ func main() {
 		showHelp()
 		os.Exit(-1)
 	}
-	fixByFile := []string{"asm_amd64.s", "proc.go", "icegatherer.go", "jsonrpc2"}
-	fixByFunc := []string{"Handle"}
-	log.Init(conf.Log.Level, fixByFile, fixByFunc)
+	sfu.InitLog(conf.Log, fixByFile, fixByFunc)
 	log.Infof("--- Starting SFU Node ---")
 
-	node := server.New(conf.Config)
+	node, err := server.New(conf.Config)
+	if err != nil {
+		log.Errorf("Starting SFU node err: %v", err)
+		os.Exit(-1)
+	}
 
 	if gaddr != "" {
 		go node.ServeGRPC(gaddr)
@@ -126,5 +148,29 @@ func main() {
 		go node.ServePProf(paddr)
 	}
 
-	select {}
+	waitForShutdown(node)
+}
+
+// waitForShutdown blocks until a termination signal is received and
+// gracefully shuts down the server, a second signal exits immediately.
+// SIGHUP reloads the config file.
+func waitForShutdown(node *server.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	sig := <-sigs
+	for ; sig == syscall.SIGHUP; sig = <-sigs {
+		reload(node)
+	}
+	log.Infof("Got signal %s, shutting down", sig)
+	go func() {
+		<-sigs
+		log.Warnf("Forced shutdown")
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.SFU.DrainTimeout)*time.Second)
+	defer cancel()
+	if err := node.Shutdown(ctx); err != nil {
+		log.Warnf("Sessions still open after drain timeout: %v", err)
+	}
 }
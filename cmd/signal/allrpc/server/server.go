@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"net"
 	"net/http"
 
@@ -21,14 +22,27 @@ import (
 )
 
 type Server struct {
-	sfu *sfu.SFU
+	sfu  *sfu.SFU
+	grpc *grpc.Server
+	http *http.Server
 }
 
-// New create a server which support grpc/jsonrpc
-func New(c sfu.Config) *Server {
-	return &Server{
-		sfu: sfu.NewSFU(c),
+// New create a server which support grpc/jsonrpc, the signal servers are
+// built here so Shutdown never races with the Serve calls.
+func New(c sfu.Config) (*Server, error) {
+	sf, err := sfu.NewSFU(c)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		sfu: sf,
+		grpc: grpc.NewServer(
+			grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
+		),
 	}
+	pb.RegisterSFUServer(s.grpc, grpcServer.NewServer(sf))
+	s.http = &http.Server{Handler: s.jsonRPCHandler()}
+	return s, nil
 }
 
 // ServeGRPC serve grpc
@@ -38,21 +52,16 @@ func (s *Server) ServeGRPC(gaddr string) error {
 		return err
 	}
 
-	gs := grpc.NewServer(
-		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
-	)
-	pb.RegisterSFUServer(gs, grpcServer.NewServer(s.sfu))
 	log.Infof("GRPC Listening at %s", gaddr)
-
-	if err := gs.Serve(l); err != nil {
+	if err := s.grpc.Serve(l); err != nil {
 		log.Errorf("err=%v", err)
 		return err
 	}
 	return nil
 }
 
-// ServeJSONRPC serve jsonrpc
-func (s *Server) ServeJSONRPC(jaddr, cert, key string) error {
+// jsonRPCHandler serves the json-rpc signal over websocket
+func (s *Server) jsonRPCHandler() http.Handler {
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true
@@ -61,7 +70,8 @@ func (s *Server) ServeJSONRPC(jaddr, cert, key string) error {
 		WriteBufferSize: 1024,
 	}
 
-	http.Handle("/ws", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.Handle("/ws", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			panic(err)
@@ -74,16 +84,42 @@ func (s *Server) ServeJSONRPC(jaddr, cert, key string) error {
 		jc := jsonrpc2.NewConn(r.Context(), websocketjsonrpc2.NewObjectStream(c), p)
 		<-jc.DisconnectNotify()
 	}))
+	return mux
+}
+
+// ServeJSONRPC serve jsonrpc
+func (s *Server) ServeJSONRPC(jaddr, cert, key string) error {
+	l, err := net.Listen("tcp", jaddr)
+	if err != nil {
+		return err
+	}
 
-	var err error
 	if key != "" && cert != "" {
 		log.Infof("JsonRPC Listening at https://[%s]", jaddr)
-		err = http.ListenAndServeTLS(jaddr, cert, key, nil)
+		err = s.http.ServeTLS(l, cert, key)
 	} else {
 		log.Infof("JsonRPC Listening at http://[%s]", jaddr)
-		err = http.ListenAndServe(jaddr, nil)
+		err = s.http.Serve(l)
 	}
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("err=%v", err)
+		return err
+	}
+	return nil
+}
+
+// Reload applies a new config to the running sfu, returns the settings
+// needing a restart.
+func (s *Server) Reload(c sfu.Config) ([]string, error) {
+	return s.sfu.Reload(c)
+}
+
+// Shutdown drains the sfu and stops the signal servers once its sessions
+// are closed or the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.sfu.Shutdown(ctx)
+	s.grpc.Stop()
+	if err := s.http.Close(); err != nil {
 		log.Errorf("err=%v", err)
 	}
 	return err
@@ -2,11 +2,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	log "github.com/pion/ion-log"
@@ -29,16 +34,15 @@ type Config struct {
 }
 
 var (
+	fixByFile = []string{"asm_amd64.s", "proc.go", "icegatherer.go"}
+	fixByFunc = []string{}
+
 	conf        = Config{}
 	file        string
 	addr        string
 	metricsAddr string
 )
 
-const (
-	portRangeLimit = 100
-)
-
 func showHelp() {
 	fmt.Printf("Usage:%s {params}\n", os.Args[0])
 	fmt.Println("      -c {config file}")
@@ -47,37 +51,53 @@ func showHelp() {
 }
 
 func load() bool {
-	_, err := os.Stat(file)
+	c, err := readConfig()
 	if err != nil {
+		fmt.Printf("config file %s loaded failed. %v\n", file, err)
 		return false
 	}
+	conf = c
+
+	fmt.Printf("config %s load ok!\n", file)
+	return true
+}
+
+// readConfig reads and validates the config file
+func readConfig() (Config, error) {
+	c := Config{}
+	if _, err := os.Stat(file); err != nil {
+		return c, err
+	}
 
 	viper.SetConfigFile(file)
 	viper.SetConfigType("toml")
 
-	err = viper.ReadInConfig()
-	if err != nil {
-		fmt.Printf("config file %s read failed. %v\n", file, err)
-		return false
+	if err := viper.ReadInConfig(); err != nil {
+		return c, err
 	}
-	err = viper.GetViper().Unmarshal(&conf)
-	if err != nil {
-		fmt.Printf("sfu config file %s loaded failed. %v\n", file, err)
-		return false
+	if err := viper.GetViper().Unmarshal(&c); err != nil {
+		return c, err
 	}
+	return c, c.Validate()
+}
 
-	if len(conf.WebRTC.ICEPortRange) > 2 {
-		fmt.Printf("config file %s loaded failed. range port must be [min,max]\n", file)
-		return false
+// reload re-reads the config file and applies it to the running sfu
+func reload(s *sfu.SFU) {
+	c, err := readConfig()
+	if err != nil {
+		log.Errorf("Reloading config file %s err: %v", file, err)
+		return
 	}
-
-	if len(conf.WebRTC.ICEPortRange) != 0 && conf.WebRTC.ICEPortRange[1]-conf.WebRTC.ICEPortRange[0] < portRangeLimit {
-		fmt.Printf("config file %s loaded failed. range port must be [min, max] and max - min >= %d\n", file, portRangeLimit)
-		return false
+	restart, err := s.Reload(c.Config)
+	if err != nil {
+		log.Errorf("Reloading config file %s err: %v", file, err)
+		return
 	}
-
-	fmt.Printf("config %s load ok!\n", file)
-	return true
+	if len(restart) > 0 {
+		log.Warnf("Config %s reloaded, restart needed to apply: %s", file, strings.Join(restart, ", "))
+		return
+	}
+	log.Infof("Config %s reloaded", file)
 }
 
 func parse() bool {
@@ -122,9 +142,7 @@ func main() {
 		os.Exit(-1)
 	}
 
-	fixByFile := []string{"asm_amd64.s", "proc.go", "icegatherer.go"}
-	fixByFunc := []string{}
-	log.Init(conf.Log.Level, fixByFile, fixByFunc)
+	sfu.InitLog(conf.Log, fixByFile, fixByFunc)
 
 	log.Infof("--- Starting SFU Node ---")
 	lis, err := net.Listen("tcp", addr)
@@ -135,13 +153,47 @@ func main() {
 	s := grpc.NewServer(
 		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
 	)
-	pb.RegisterSFUServer(s, server.NewServer(sfu.NewSFU(conf.Config)))
+	node, err := sfu.NewSFU(conf.Config)
+	if err != nil {
+		log.Errorf("Starting SFU node err: %v", err)
+		os.Exit(-1)
+	}
+	pb.RegisterSFUServer(s, server.NewServer(node))
 	grpc_prometheus.Register(s)
 
 	go startMetrics(metricsAddr)
 
 	log.Infof("SFU Listening at %s", addr)
-	if err := s.Serve(lis); err != nil {
-		log.Panicf("failed to serve: %v", err)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Panicf("failed to serve: %v", err)
+		}
+	}()
+
+	waitForShutdown(node, conf.SFU.DrainTimeout)
+	s.Stop()
+}
+
+// waitForShutdown blocks until a termination signal is received and
+// gracefully shuts down the sfu, a second signal exits immediately.
+// SIGHUP reloads the config file.
+func waitForShutdown(s *sfu.SFU, drainTimeout int) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	sig := <-sigs
+	for ; sig == syscall.SIGHUP; sig = <-sigs {
+		reload(s)
+	}
+	log.Infof("Got signal %s, shutting down", sig)
+	go func() {
+		<-sigs
+		log.Warnf("Forced shutdown")
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(drainTimeout)*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Warnf("Sessions still open after drain timeout: %v", err)
 	}
 }
@@ -63,7 +63,7 @@ func (x Trickle_Target) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use Trickle_Target.Descriptor instead.
 func (Trickle_Target) EnumDescriptor() ([]byte, []int) {
-	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{4, 0}
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{6, 0}
 }
 
 type SignalRequest struct {
@@ -76,6 +76,9 @@ type SignalRequest struct {
 	//	*SignalRequest_Join
 	//	*SignalRequest_Description
 	//	*SignalRequest_Trickle
+	//	*SignalRequest_Control
+	//	*SignalRequest_Kick
+	//	*SignalRequest_Role
 	Payload isSignalRequest_Payload `protobuf_oneof:"payload"`
 }
 
@@ -146,6 +149,27 @@ func (x *SignalRequest) GetTrickle() *Trickle {
 	return nil
 }
 
+func (x *SignalRequest) GetControl() *TrackControl {
+	if x, ok := x.GetPayload().(*SignalRequest_Control); ok {
+		return x.Control
+	}
+	return nil
+}
+
+func (x *SignalRequest) GetKick() *Kick {
+	if x, ok := x.GetPayload().(*SignalRequest_Kick); ok {
+		return x.Kick
+	}
+	return nil
+}
+
+func (x *SignalRequest) GetRole() *SetRole {
+	if x, ok := x.GetPayload().(*SignalRequest_Role); ok {
+		return x.Role
+	}
+	return nil
+}
+
 type isSignalRequest_Payload interface {
 	isSignalRequest_Payload()
 }
@@ -162,12 +186,30 @@ type SignalRequest_Trickle struct {
 	Trickle *Trickle `protobuf:"bytes,4,opt,name=trickle,proto3,oneof"`
 }
 
+type SignalRequest_Control struct {
+	Control *TrackControl `protobuf:"bytes,5,opt,name=control,proto3,oneof"`
+}
+
+type SignalRequest_Kick struct {
+	Kick *Kick `protobuf:"bytes,6,opt,name=kick,proto3,oneof"`
+}
+
+type SignalRequest_Role struct {
+	Role *SetRole `protobuf:"bytes,7,opt,name=role,proto3,oneof"`
+}
+
 func (*SignalRequest_Join) isSignalRequest_Payload() {}
 
 func (*SignalRequest_Description) isSignalRequest_Payload() {}
 
 func (*SignalRequest_Trickle) isSignalRequest_Payload() {}
 
+func (*SignalRequest_Control) isSignalRequest_Payload() {}
+
+func (*SignalRequest_Kick) isSignalRequest_Payload() {}
+
+func (*SignalRequest_Role) isSignalRequest_Payload() {}
+
 type SignalReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -180,6 +222,9 @@ type SignalReply struct {
 	//	*SignalReply_Trickle
 	//	*SignalReply_IceConnectionState
 	//	*SignalReply_Error
+	//	*SignalReply_Redirect
+	//	*SignalReply_Migrate
+	//	*SignalReply_TrackEvent
 	Payload isSignalReply_Payload `protobuf_oneof:"payload"`
 }
 
@@ -264,6 +309,27 @@ func (x *SignalReply) GetError() string {
 	return ""
 }
 
+func (x *SignalReply) GetRedirect() *Redirect {
+	if x, ok := x.GetPayload().(*SignalReply_Redirect); ok {
+		return x.Redirect
+	}
+	return nil
+}
+
+func (x *SignalReply) GetMigrate() *Migrate {
+	if x, ok := x.GetPayload().(*SignalReply_Migrate); ok {
+		return x.Migrate
+	}
+	return nil
+}
+
+func (x *SignalReply) GetTrackEvent() *TrackEvent {
+	if x, ok := x.GetPayload().(*SignalReply_TrackEvent); ok {
+		return x.TrackEvent
+	}
+	return nil
+}
+
 type isSignalReply_Payload interface {
 	isSignalReply_Payload()
 }
@@ -288,6 +354,18 @@ type SignalReply_Error struct {
 	Error string `protobuf:"bytes,6,opt,name=error,proto3,oneof"`
 }
 
+type SignalReply_Redirect struct {
+	Redirect *Redirect `protobuf:"bytes,7,opt,name=redirect,proto3,oneof"`
+}
+
+type SignalReply_Migrate struct {
+	Migrate *Migrate `protobuf:"bytes,8,opt,name=migrate,proto3,oneof"`
+}
+
+type SignalReply_TrackEvent struct {
+	TrackEvent *TrackEvent `protobuf:"bytes,9,opt,name=trackEvent,proto3,oneof"`
+}
+
 func (*SignalReply_Join) isSignalReply_Payload() {}
 
 func (*SignalReply_Description) isSignalReply_Payload() {}
@@ -298,6 +376,12 @@ func (*SignalReply_IceConnectionState) isSignalReply_Payload() {}
 
 func (*SignalReply_Error) isSignalReply_Payload() {}
 
+func (*SignalReply_Redirect) isSignalReply_Payload() {}
+
+func (*SignalReply_Migrate) isSignalReply_Payload() {}
+
+func (*SignalReply_TrackEvent) isSignalReply_Payload() {}
+
 type JoinRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -305,6 +389,8 @@ type JoinRequest struct {
 
 	Sid         string `protobuf:"bytes,1,opt,name=sid,proto3" json:"sid,omitempty"`
 	Description []byte `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Config      []byte `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+	Token       string `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`
 }
 
 func (x *JoinRequest) Reset() {
@@ -353,6 +439,20 @@ func (x *JoinRequest) GetDescription() []byte {
 	return nil
 }
 
+func (x *JoinRequest) GetConfig() []byte {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *JoinRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
 type JoinReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -400,6 +500,108 @@ func (x *JoinReply) GetDescription() []byte {
 	return nil
 }
 
+type Redirect struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sid  string `protobuf:"bytes,1,opt,name=sid,proto3" json:"sid,omitempty"`
+	Node string `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+}
+
+func (x *Redirect) Reset() {
+	*x = Redirect{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Redirect) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Redirect) ProtoMessage() {}
+
+func (x *Redirect) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Redirect.ProtoReflect.Descriptor instead.
+func (*Redirect) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Redirect) GetSid() string {
+	if x != nil {
+		return x.Sid
+	}
+	return ""
+}
+
+func (x *Redirect) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+type Migrate struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sid string `protobuf:"bytes,1,opt,name=sid,proto3" json:"sid,omitempty"`
+}
+
+func (x *Migrate) Reset() {
+	*x = Migrate{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Migrate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Migrate) ProtoMessage() {}
+
+func (x *Migrate) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Migrate.ProtoReflect.Descriptor instead.
+func (*Migrate) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Migrate) GetSid() string {
+	if x != nil {
+		return x.Sid
+	}
+	return ""
+}
+
 type Trickle struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -412,7 +614,7 @@ type Trickle struct {
 func (x *Trickle) Reset() {
 	*x = Trickle{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[4]
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -425,7 +627,7 @@ func (x *Trickle) String() string {
 func (*Trickle) ProtoMessage() {}
 
 func (x *Trickle) ProtoReflect() protoreflect.Message {
-	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[4]
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -438,7 +640,7 @@ func (x *Trickle) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Trickle.ProtoReflect.Descriptor instead.
 func (*Trickle) Descriptor() ([]byte, []int) {
-	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{4}
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Trickle) GetTarget() Trickle_Target {
@@ -455,12 +657,248 @@ func (x *Trickle) GetInit() string {
 	return ""
 }
 
+type TrackControl struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PeerId  string `protobuf:"bytes,1,opt,name=peerId,proto3" json:"peerId,omitempty"`
+	TrackId string `protobuf:"bytes,2,opt,name=trackId,proto3" json:"trackId,omitempty"`
+	Type    string `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Layer   int32  `protobuf:"varint,4,opt,name=layer,proto3" json:"layer,omitempty"`
+}
+
+func (x *TrackControl) Reset() {
+	*x = TrackControl{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TrackControl) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrackControl) ProtoMessage() {}
+
+func (x *TrackControl) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrackControl.ProtoReflect.Descriptor instead.
+func (*TrackControl) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TrackControl) GetPeerId() string {
+	if x != nil {
+		return x.PeerId
+	}
+	return ""
+}
+
+func (x *TrackControl) GetTrackId() string {
+	if x != nil {
+		return x.TrackId
+	}
+	return ""
+}
+
+func (x *TrackControl) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *TrackControl) GetLayer() int32 {
+	if x != nil {
+		return x.Layer
+	}
+	return 0
+}
+
+type TrackEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type    string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	TrackId string `protobuf:"bytes,2,opt,name=trackId,proto3" json:"trackId,omitempty"`
+	Layer   int32  `protobuf:"varint,3,opt,name=layer,proto3" json:"layer,omitempty"`
+}
+
+func (x *TrackEvent) Reset() {
+	*x = TrackEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TrackEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrackEvent) ProtoMessage() {}
+
+func (x *TrackEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrackEvent.ProtoReflect.Descriptor instead.
+func (*TrackEvent) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TrackEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *TrackEvent) GetTrackId() string {
+	if x != nil {
+		return x.TrackId
+	}
+	return ""
+}
+
+func (x *TrackEvent) GetLayer() int32 {
+	if x != nil {
+		return x.Layer
+	}
+	return 0
+}
+
+type Kick struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PeerId string `protobuf:"bytes,1,opt,name=peerId,proto3" json:"peerId,omitempty"`
+}
+
+func (x *Kick) Reset() {
+	*x = Kick{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Kick) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Kick) ProtoMessage() {}
+
+func (x *Kick) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Kick.ProtoReflect.Descriptor instead.
+func (*Kick) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Kick) GetPeerId() string {
+	if x != nil {
+		return x.PeerId
+	}
+	return ""
+}
+
+type SetRole struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PeerId string `protobuf:"bytes,1,opt,name=peerId,proto3" json:"peerId,omitempty"`
+	Role   string `protobuf:"bytes,2,opt,name=role,proto3" json:"role,omitempty"`
+}
+
+func (x *SetRole) Reset() {
+	*x = SetRole{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetRole) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRole) ProtoMessage() {}
+
+func (x *SetRole) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_sfu_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRole.ProtoReflect.Descriptor instead.
+func (*SetRole) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SetRole) GetPeerId() string {
+	if x != nil {
+		return x.PeerId
+	}
+	return ""
+}
+
+func (x *SetRole) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
 var File_cmd_signal_grpc_proto_sfu_proto protoreflect.FileDescriptor
 
 var file_cmd_signal_grpc_proto_sfu_proto_rawDesc = []byte{
 	0x0a, 0x1f, 0x63, 0x6d, 0x64, 0x2f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x72, 0x70,
 	0x63, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x66, 0x75, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x12, 0x03, 0x73, 0x66, 0x75, 0x22, 0xa0, 0x01, 0x0a, 0x0d, 0x53, 0x69, 0x67, 0x6e, 0x61,
+	0x6f, 0x12, 0x03, 0x73, 0x66, 0x75, 0x22, 0x94, 0x02, 0x0a, 0x0d, 0x53, 0x69, 0x67, 0x6e, 0x61,
 	0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x26, 0x0a, 0x04, 0x6a, 0x6f, 0x69, 0x6e,
 	0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x4a, 0x6f, 0x69,
@@ -469,37 +907,78 @@ var file_cmd_signal_grpc_proto_sfu_proto_rawDesc = []byte{
 	0x03, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70,
 	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x18,
 	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x54, 0x72, 0x69, 0x63,
-	0x6b, 0x6c, 0x65, 0x48, 0x00, 0x52, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x42, 0x09,
-	0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0xe6, 0x01, 0x0a, 0x0b, 0x53, 0x69,
-	0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x24, 0x0a, 0x04, 0x6a, 0x6f, 0x69,
-	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x4a, 0x6f,
-	0x69, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x48, 0x00, 0x52, 0x04, 0x6a, 0x6f, 0x69, 0x6e, 0x12,
-	0x22, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03,
-	0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
-	0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x18, 0x04,
-	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x54, 0x72, 0x69, 0x63, 0x6b,
-	0x6c, 0x65, 0x48, 0x00, 0x52, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x12, 0x30, 0x0a,
+	0x6b, 0x6c, 0x65, 0x48, 0x00, 0x52, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x12, 0x2d,
+	0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x11, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x6b, 0x43, 0x6f, 0x6e, 0x74, 0x72,
+	0x6f, 0x6c, 0x48, 0x00, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x12, 0x1f, 0x0a,
+	0x04, 0x6b, 0x69, 0x63, 0x6b, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x09, 0x2e, 0x73, 0x66,
+	0x75, 0x2e, 0x4b, 0x69, 0x63, 0x6b, 0x48, 0x00, 0x52, 0x04, 0x6b, 0x69, 0x63, 0x6b, 0x12, 0x22,
+	0x0a, 0x04, 0x72, 0x6f, 0x6c, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x73,
+	0x66, 0x75, 0x2e, 0x53, 0x65, 0x74, 0x52, 0x6f, 0x6c, 0x65, 0x48, 0x00, 0x52, 0x04, 0x72, 0x6f,
+	0x6c, 0x65, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0xf0, 0x02,
+	0x0a, 0x0b, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x24, 0x0a,
+	0x04, 0x6a, 0x6f, 0x69, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x73, 0x66,
+	0x75, 0x2e, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x48, 0x00, 0x52, 0x04, 0x6a,
+	0x6f, 0x69, 0x6e, 0x12, 0x22, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63,
+	0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b,
+	0x6c, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x54,
+	0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x48, 0x00, 0x52, 0x07, 0x74, 0x72, 0x69, 0x63, 0x6b, 0x6c,
+	0x65, 0x12, 0x30, 0x0a, 0x12, 0x69, 0x63, 0x65, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52,
 	0x12, 0x69, 0x63, 0x65, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74,
-	0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x12, 0x69, 0x63, 0x65,
-	0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12,
-	0x16, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
-	0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f,
-	0x61, 0x64, 0x22, 0x41, 0x0a, 0x0b, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
-	0x73, 0x69, 0x64, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69,
-	0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69,
-	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x2d, 0x0a, 0x09, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x70,
-	0x6c, 0x79, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f,
-	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70,
-	0x74, 0x69, 0x6f, 0x6e, 0x22, 0x73, 0x0a, 0x07, 0x54, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x12,
-	0x2b, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
-	0x13, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x54, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x2e, 0x54, 0x61,
-	0x72, 0x67, 0x65, 0x74, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04,
-	0x69, 0x6e, 0x69, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x6e, 0x69, 0x74,
-	0x22, 0x27, 0x0a, 0x06, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x55,
-	0x42, 0x4c, 0x49, 0x53, 0x48, 0x45, 0x52, 0x10, 0x00, 0x12, 0x0e, 0x0a, 0x0a, 0x53, 0x55, 0x42,
-	0x53, 0x43, 0x52, 0x49, 0x42, 0x45, 0x52, 0x10, 0x01, 0x32, 0x3b, 0x0a, 0x03, 0x53, 0x46, 0x55,
+	0x61, 0x74, 0x65, 0x12, 0x16, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x48, 0x00, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x2b, 0x0a, 0x08, 0x72,
+	0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e,
+	0x73, 0x66, 0x75, 0x2e, 0x52, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x48, 0x00, 0x52, 0x08,
+	0x72, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x12, 0x28, 0x0a, 0x07, 0x6d, 0x69, 0x67, 0x72,
+	0x61, 0x74, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x73, 0x66, 0x75, 0x2e,
+	0x4d, 0x69, 0x67, 0x72, 0x61, 0x74, 0x65, 0x48, 0x00, 0x52, 0x07, 0x6d, 0x69, 0x67, 0x72, 0x61,
+	0x74, 0x65, 0x12, 0x31, 0x0a, 0x0a, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x45, 0x76, 0x65, 0x6e, 0x74,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x73, 0x66, 0x75, 0x2e, 0x54, 0x72, 0x61,
+	0x63, 0x6b, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x48, 0x00, 0x52, 0x0a, 0x74, 0x72, 0x61, 0x63, 0x6b,
+	0x45, 0x76, 0x65, 0x6e, 0x74, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64,
+	0x22, 0x6f, 0x0a, 0x0b, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x10, 0x0a, 0x03, 0x73, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x69,
+	0x64, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x14, 0x0a, 0x05, 0x74,
+	0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65,
+	0x6e, 0x22, 0x2d, 0x0a, 0x09, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x20,
+	0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x22, 0x30, 0x0a, 0x08, 0x52, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x12, 0x10, 0x0a, 0x03,
+	0x73, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x69, 0x64, 0x12, 0x12,
+	0x0a, 0x04, 0x6e, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x6f,
+	0x64, 0x65, 0x22, 0x1b, 0x0a, 0x07, 0x4d, 0x69, 0x67, 0x72, 0x61, 0x74, 0x65, 0x12, 0x10, 0x0a,
+	0x03, 0x73, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x69, 0x64, 0x22,
+	0x73, 0x0a, 0x07, 0x54, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x12, 0x2b, 0x0a, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x73, 0x66, 0x75,
+	0x2e, 0x54, 0x72, 0x69, 0x63, 0x6b, 0x6c, 0x65, 0x2e, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52,
+	0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x6e, 0x69, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x69, 0x6e, 0x69, 0x74, 0x22, 0x27, 0x0a, 0x06, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x55, 0x42, 0x4c, 0x49, 0x53, 0x48,
+	0x45, 0x52, 0x10, 0x00, 0x12, 0x0e, 0x0a, 0x0a, 0x53, 0x55, 0x42, 0x53, 0x43, 0x52, 0x49, 0x42,
+	0x45, 0x52, 0x10, 0x01, 0x22, 0x6a, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x63, 0x6b, 0x43, 0x6f, 0x6e,
+	0x74, 0x72, 0x6f, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x65, 0x65, 0x72, 0x49, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x65, 0x65, 0x72, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07,
+	0x74, 0x72, 0x61, 0x63, 0x6b, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x74,
+	0x72, 0x61, 0x63, 0x6b, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x61,
+	0x79, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x6c, 0x61, 0x79, 0x65, 0x72,
+	0x22, 0x50, 0x0a, 0x0a, 0x54, 0x72, 0x61, 0x63, 0x6b, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x49, 0x64, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x07, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05,
+	0x6c, 0x61, 0x79, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x6c, 0x61, 0x79,
+	0x65, 0x72, 0x22, 0x1e, 0x0a, 0x04, 0x4b, 0x69, 0x63, 0x6b, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x65,
+	0x65, 0x72, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x65, 0x65, 0x72,
+	0x49, 0x64, 0x22, 0x35, 0x0a, 0x07, 0x53, 0x65, 0x74, 0x52, 0x6f, 0x6c, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x70, 0x65, 0x65, 0x72, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70,
+	0x65, 0x65, 0x72, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x6f, 0x6c, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x72, 0x6f, 0x6c, 0x65, 0x32, 0x3b, 0x0a, 0x03, 0x53, 0x46, 0x55,
 	0x12, 0x34, 0x0a, 0x06, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x12, 0x12, 0x2e, 0x73, 0x66, 0x75,
 	0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10,
 	0x2e, 0x73, 0x66, 0x75, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79,
@@ -522,28 +1001,40 @@ func file_cmd_signal_grpc_proto_sfu_proto_rawDescGZIP() []byte {
 }
 
 var file_cmd_signal_grpc_proto_sfu_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_cmd_signal_grpc_proto_sfu_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_cmd_signal_grpc_proto_sfu_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_cmd_signal_grpc_proto_sfu_proto_goTypes = []interface{}{
 	(Trickle_Target)(0),   // 0: sfu.Trickle.Target
 	(*SignalRequest)(nil), // 1: sfu.SignalRequest
 	(*SignalReply)(nil),   // 2: sfu.SignalReply
 	(*JoinRequest)(nil),   // 3: sfu.JoinRequest
 	(*JoinReply)(nil),     // 4: sfu.JoinReply
-	(*Trickle)(nil),       // 5: sfu.Trickle
+	(*Redirect)(nil),      // 5: sfu.Redirect
+	(*Migrate)(nil),       // 6: sfu.Migrate
+	(*Trickle)(nil),       // 7: sfu.Trickle
+	(*TrackControl)(nil),  // 8: sfu.TrackControl
+	(*TrackEvent)(nil),    // 9: sfu.TrackEvent
+	(*Kick)(nil),          // 10: sfu.Kick
+	(*SetRole)(nil),       // 11: sfu.SetRole
 }
 var file_cmd_signal_grpc_proto_sfu_proto_depIdxs = []int32{
-	3, // 0: sfu.SignalRequest.join:type_name -> sfu.JoinRequest
-	5, // 1: sfu.SignalRequest.trickle:type_name -> sfu.Trickle
-	4, // 2: sfu.SignalReply.join:type_name -> sfu.JoinReply
-	5, // 3: sfu.SignalReply.trickle:type_name -> sfu.Trickle
-	0, // 4: sfu.Trickle.target:type_name -> sfu.Trickle.Target
-	1, // 5: sfu.SFU.Signal:input_type -> sfu.SignalRequest
-	2, // 6: sfu.SFU.Signal:output_type -> sfu.SignalReply
-	6, // [6:7] is the sub-list for method output_type
-	5, // [5:6] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	3,  // 0: sfu.SignalRequest.join:type_name -> sfu.JoinRequest
+	7,  // 1: sfu.SignalRequest.trickle:type_name -> sfu.Trickle
+	8,  // 2: sfu.SignalRequest.control:type_name -> sfu.TrackControl
+	10, // 3: sfu.SignalRequest.kick:type_name -> sfu.Kick
+	11, // 4: sfu.SignalRequest.role:type_name -> sfu.SetRole
+	4,  // 5: sfu.SignalReply.join:type_name -> sfu.JoinReply
+	7,  // 6: sfu.SignalReply.trickle:type_name -> sfu.Trickle
+	5,  // 7: sfu.SignalReply.redirect:type_name -> sfu.Redirect
+	6,  // 8: sfu.SignalReply.migrate:type_name -> sfu.Migrate
+	9,  // 9: sfu.SignalReply.trackEvent:type_name -> sfu.TrackEvent
+	0,  // 10: sfu.Trickle.target:type_name -> sfu.Trickle.Target
+	1,  // 11: sfu.SFU.Signal:input_type -> sfu.SignalRequest
+	2,  // 12: sfu.SFU.Signal:output_type -> sfu.SignalReply
+	12, // [12:13] is the sub-list for method output_type
+	11, // [11:12] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_cmd_signal_grpc_proto_sfu_proto_init() }
@@ -601,6 +1092,30 @@ func file_cmd_signal_grpc_proto_sfu_proto_init() {
 			}
 		}
 		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Redirect); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Migrate); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Trickle); i {
 			case 0:
 				return &v.state
@@ -612,11 +1127,62 @@ func file_cmd_signal_grpc_proto_sfu_proto_init() {
 				return nil
 			}
 		}
+		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TrackControl); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TrackEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Kick); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_sfu_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetRole); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_cmd_signal_grpc_proto_sfu_proto_msgTypes[0].OneofWrappers = []interface{}{
 		(*SignalRequest_Join)(nil),
 		(*SignalRequest_Description)(nil),
 		(*SignalRequest_Trickle)(nil),
+		(*SignalRequest_Control)(nil),
+		(*SignalRequest_Kick)(nil),
+		(*SignalRequest_Role)(nil),
 	}
 	file_cmd_signal_grpc_proto_sfu_proto_msgTypes[1].OneofWrappers = []interface{}{
 		(*SignalReply_Join)(nil),
@@ -624,6 +1190,9 @@ func file_cmd_signal_grpc_proto_sfu_proto_init() {
 		(*SignalReply_Trickle)(nil),
 		(*SignalReply_IceConnectionState)(nil),
 		(*SignalReply_Error)(nil),
+		(*SignalReply_Redirect)(nil),
+		(*SignalReply_Migrate)(nil),
+		(*SignalReply_TrackEvent)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -631,7 +1200,7 @@ func file_cmd_signal_grpc_proto_sfu_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_cmd_signal_grpc_proto_sfu_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   5,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -79,11 +79,39 @@ func (s *SFUServer) Signal(stream pb.SFU_SignalServer) error {
 				}
 			}
 
-			answer, err := peer.Join(payload.Join.Sid, offer)
+			var answer *webrtc.SessionDescription
+			var config *sfu.SessionConfig
+			if len(payload.Join.Config) > 0 {
+				config = &sfu.SessionConfig{}
+				err = json.Unmarshal(payload.Join.Config, config)
+			}
+			if err == nil {
+				answer, err = peer.JoinWithToken(payload.Join.Sid, offer, payload.Join.Token, config)
+			}
+			if redirect, ok := err.(*sfu.SessionRedirectError); ok {
+				err = stream.Send(&pb.SignalReply{
+					Id: in.Id,
+					Payload: &pb.SignalReply_Redirect{
+						Redirect: &pb.Redirect{
+							Sid:  redirect.SID,
+							Node: redirect.Node,
+						},
+					},
+				})
+				if err != nil {
+					log.Errorf("grpc send error %v ", err)
+					return status.Errorf(codes.Internal, err.Error())
+				}
+				continue
+			}
 			if err != nil {
 				switch err {
 				case sfu.ErrTransportExists:
 					fallthrough
+				case sfu.ErrSessionFull:
+					fallthrough
+				case sfu.ErrInvalidToken:
+					fallthrough
 				case sfu.ErrOfferIgnored:
 					err = stream.Send(&pb.SignalReply{
 						Payload: &pb.SignalReply_Error{
@@ -100,7 +128,7 @@ func (s *SFUServer) Signal(stream pb.SFU_SignalServer) error {
 			}
 
 			// Notify user of new ice candidate
-			peer.OnIceCandidate = func(candidate *webrtc.ICECandidateInit, target int) {
+			peer.OnIceCandidate(func(candidate *webrtc.ICECandidateInit, target int) {
 				bytes, err := json.Marshal(candidate)
 				if err != nil {
 					log.Errorf("OnIceCandidate error %s", err)
@@ -116,10 +144,10 @@ func (s *SFUServer) Signal(stream pb.SFU_SignalServer) error {
 				if err != nil {
 					log.Errorf("OnIceCandidate send error %v ", err)
 				}
-			}
+			})
 
 			// Notify user of new offer
-			peer.OnOffer = func(o *webrtc.SessionDescription) {
+			peer.OnOffer(func(o *webrtc.SessionDescription) {
 				marshalled, err := json.Marshal(o)
 				if err != nil {
 					err = stream.Send(&pb.SignalReply{
@@ -142,10 +170,37 @@ func (s *SFUServer) Signal(stream pb.SFU_SignalServer) error {
 				if err != nil {
 					log.Errorf("negotiation error %s", err)
 				}
-			}
+			})
 
-			peer.OnICEConnectionStateChange = func(c webrtc.ICEConnectionState) {
-				err = stream.Send(&pb.SignalReply{
+			sid := payload.Join.Sid
+			peer.OnMigrate(func() {
+				err := stream.Send(&pb.SignalReply{
+					Payload: &pb.SignalReply_Migrate{
+						Migrate: &pb.Migrate{Sid: sid},
+					},
+				})
+				if err != nil {
+					log.Errorf("migrate send error %v ", err)
+				}
+			})
+
+			peer.OnTrackEvent(func(e sfu.TrackEvent) {
+				err := stream.Send(&pb.SignalReply{
+					Payload: &pb.SignalReply_TrackEvent{
+						TrackEvent: &pb.TrackEvent{
+							Type:    e.Type,
+							TrackId: e.TrackID,
+							Layer:   int32(e.Layer),
+						},
+					},
+				})
+				if err != nil {
+					log.Errorf("track event send error %v ", err)
+				}
+			})
+
+			peer.OnICEConnectionStateChange(func(c webrtc.ICEConnectionState) {
+				err := stream.Send(&pb.SignalReply{
 					Payload: &pb.SignalReply_IceConnectionState{
 						IceConnectionState: c.String(),
 					},
@@ -154,7 +209,7 @@ func (s *SFUServer) Signal(stream pb.SFU_SignalServer) error {
 				if err != nil {
 					log.Errorf("oniceconnectionstatechange error %s", err)
 				}
-			}
+			})
 
 			marshalled, err := json.Marshal(answer)
 			if err != nil {
@@ -293,6 +348,56 @@ func (s *SFUServer) Signal(stream pb.SFU_SignalServer) error {
 				}
 			}
 
+		case *pb.SignalRequest_Control:
+			err := peer.ControlTrack(sfu.TrackControl{
+				PeerID:  payload.Control.PeerId,
+				TrackID: payload.Control.TrackId,
+				Type:    payload.Control.Type,
+				Layer:   int(payload.Control.Layer),
+			})
+			if err != nil {
+				err = stream.Send(&pb.SignalReply{
+					Id: in.Id,
+					Payload: &pb.SignalReply_Error{
+						Error: fmt.Errorf("track control error: %w", err).Error(),
+					},
+				})
+				if err != nil {
+					log.Errorf("grpc send error %v ", err)
+					return status.Errorf(codes.Internal, err.Error())
+				}
+			}
+
+		case *pb.SignalRequest_Kick:
+			err := peer.Kick(payload.Kick.PeerId)
+			if err != nil {
+				err = stream.Send(&pb.SignalReply{
+					Id: in.Id,
+					Payload: &pb.SignalReply_Error{
+						Error: fmt.Errorf("kick error: %w", err).Error(),
+					},
+				})
+				if err != nil {
+					log.Errorf("grpc send error %v ", err)
+					return status.Errorf(codes.Internal, err.Error())
+				}
+			}
+
+		case *pb.SignalRequest_Role:
+			err := peer.SetRole(payload.Role.PeerId, sfu.Role(payload.Role.Role))
+			if err != nil {
+				err = stream.Send(&pb.SignalReply{
+					Id: in.Id,
+					Payload: &pb.SignalReply_Error{
+						Error: fmt.Errorf("set role error: %w", err).Error(),
+					},
+				})
+				if err != nil {
+					log.Errorf("grpc send error %v ", err)
+					return status.Errorf(codes.Internal, err.Error())
+				}
+			}
+
 		}
 	}
 }
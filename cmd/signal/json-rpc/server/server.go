@@ -11,10 +11,19 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+// codeSessionRedirect is replied on join when the session lives in another node
+const codeSessionRedirect = 302
+
 // Join message sent when initializing a peer connection
 type Join struct {
 	Sid   string                    `json:"sid"`
 	Offer webrtc.SessionDescription `json:"offer"`
+	// Config is applied when the session is created by this join, only
+	// for peers with a host token
+	Config *sfu.SessionConfig `json:"config,omitempty"`
+	// Token grants the role of the peer, required when the sfu has a
+	// token secret
+	Token string `json:"token,omitempty"`
 }
 
 // Negotiation message sent when renegotiating the peer connection
@@ -28,6 +37,28 @@ type Trickle struct {
 	Candidate webrtc.ICECandidateInit `json:"candidate"`
 }
 
+// Kick message sent by a host to remove a peer from the session
+type Kick struct {
+	PeerID string `json:"peerId"`
+}
+
+// SetRole message sent by a host to change the role of a peer
+type SetRole struct {
+	PeerID string   `json:"peerId"`
+	Role   sfu.Role `json:"role"`
+}
+
+// Migrate notification sent when the node is draining
+type Migrate struct {
+	Sid string `json:"sid"`
+}
+
+// Redirect data replied when the session lives in another node
+type Redirect struct {
+	Sid  string `json:"sid"`
+	Node string `json:"node"`
+}
+
 type JSONSignal struct {
 	*sfu.Peer
 }
@@ -36,7 +67,8 @@ func NewJSONSignal(p *sfu.Peer) *JSONSignal {
 	return &JSONSignal{p}
 }
 
-// Handle incoming RPC call events like join, answer, offer and trickle
+// Handle incoming RPC call events like join, answer, offer, trickle and
+// the moderation of the peers allowed by their role
 func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	replyError := func(err error) {
 		_ = conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
@@ -55,26 +87,46 @@ func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 			break
 		}
 
-		answer, err := p.Join(join.Sid, join.Offer)
+		answer, err := p.JoinWithToken(join.Sid, join.Offer, join.Token, join.Config)
 		if err != nil {
+			if redirect, ok := err.(*sfu.SessionRedirectError); ok {
+				data, _ := json.Marshal(Redirect{Sid: redirect.SID, Node: redirect.Node})
+				raw := json.RawMessage(data)
+				_ = conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+					Code:    codeSessionRedirect,
+					Message: err.Error(),
+					Data:    &raw,
+				})
+				break
+			}
 			replyError(err)
 			break
 		}
 
-		p.OnOffer = func(offer *webrtc.SessionDescription) {
+		p.OnOffer(func(offer *webrtc.SessionDescription) {
 			if err := conn.Notify(ctx, "offer", offer); err != nil {
 				log.Errorf("error sending offer %s", err)
 			}
 
-		}
-		p.OnIceCandidate = func(candidate *webrtc.ICECandidateInit, target int) {
+		})
+		p.OnMigrate(func() {
+			if err := conn.Notify(ctx, "migrate", Migrate{Sid: join.Sid}); err != nil {
+				log.Errorf("error sending migrate %s", err)
+			}
+		})
+		p.OnTrackEvent(func(e sfu.TrackEvent) {
+			if err := conn.Notify(ctx, "trackEvent", e); err != nil {
+				log.Errorf("error sending track event %s", err)
+			}
+		})
+		p.OnIceCandidate(func(candidate *webrtc.ICECandidateInit, target int) {
 			if err := conn.Notify(ctx, "trickle", Trickle{
 				Candidate: *candidate,
 				Target:    target,
 			}); err != nil {
 				log.Errorf("error sending ice candidate %s", err)
 			}
-		}
+		})
 
 		_ = conn.Reply(ctx, req.ID, answer)
 
@@ -121,5 +173,53 @@ func (p *JSONSignal) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 		if err != nil {
 			replyError(err)
 		}
+
+	case "control":
+		var control sfu.TrackControl
+		err := json.Unmarshal(*req.Params, &control)
+		if err != nil {
+			log.Errorf("connect: error parsing track control: %v", err)
+			replyError(err)
+			break
+		}
+
+		err = p.ControlTrack(control)
+		if err != nil {
+			replyError(err)
+			break
+		}
+		_ = conn.Reply(ctx, req.ID, nil)
+
+	case "kick":
+		var kick Kick
+		err := json.Unmarshal(*req.Params, &kick)
+		if err != nil {
+			log.Errorf("connect: error parsing kick: %v", err)
+			replyError(err)
+			break
+		}
+
+		err = p.Kick(kick.PeerID)
+		if err != nil {
+			replyError(err)
+			break
+		}
+		_ = conn.Reply(ctx, req.ID, nil)
+
+	case "role":
+		var role SetRole
+		err := json.Unmarshal(*req.Params, &role)
+		if err != nil {
+			log.Errorf("connect: error parsing role: %v", err)
+			replyError(err)
+			break
+		}
+
+		err = p.SetRole(role.PeerID, role.Role)
+		if err != nil {
+			replyError(err)
+			break
+		}
+		_ = conn.Reply(ctx, req.ID, nil)
 	}
 }
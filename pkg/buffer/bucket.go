@@ -1,28 +1,76 @@
 package buffer
 
 import (
-	"encoding/binary"
+	"time"
 
 	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
 )
 
-const maxPktSize = 1460
+const (
+	maxPktSize = 1460
 
+	// The packet rate of a track is estimated from its bitrate to size
+	// its bucket, with room for the bursts of the keyframes.
+	avgVideoPktSize     = 1000
+	audioPktsPerSecond  = 50
+	bucketBurstFactor   = 2
+	defaultVideoBitrate = 3000 // kbps
+
+	minBucketSize = 32
+	// maxBucketSize keeps the bucket window under half the sequence
+	// numbers space, so older and newer packets can be told apart.
+	maxBucketSize = 1 << 14
+)
+
+// bucketSize returns the number of packets a bucket keeps for bufferTime ms
+// of a track of the kind and max bitrate in kbps, zero if unknown.
+func bucketSize(kind webrtc.RTPCodecType, bufferTime int, maxBitrate uint64) int {
+	if bufferTime <= 0 {
+		bufferTime = defaultBufferTime
+	}
+	size := audioPktsPerSecond * bucketBurstFactor * uint64(bufferTime) / 1000
+	if kind == webrtc.RTPCodecTypeVideo {
+		if maxBitrate == 0 {
+			maxBitrate = defaultVideoBitrate
+		}
+		// Bytes sent in bufferTime, from the bitrate in kbps
+		size = maxBitrate * uint64(bufferTime) / 8 * bucketBurstFactor / avgVideoPktSize
+	}
+	switch {
+	case size < minBucketSize:
+		return minBucketSize
+	case size > maxBucketSize:
+		return maxBucketSize
+	}
+	return int(size)
+}
+
+type bucketSlot struct {
+	// sn is the extended sequence number of the packet, zero if empty. The
+	// extended sequence numbers start a cycle up so they're never zero.
+	sn  uint32
+	pkt []byte
+}
+
+// Bucket keeps the last packets of a track by extended sequence number to
+// retransmit them, each slot owns a buffer grown to the packets it holds.
 type Bucket struct {
-	buf    []byte
+	slots  []bucketSlot
 	nacker *nackQueue
 
-	headSN   uint16
-	step     int
-	maxSteps int
+	headSN    uint16
+	cycles    uint32
+	init      bool
+	allocated int // Bytes allocated by the slots
 
 	onLost func(nack []rtcp.NackPair, askKeyframe bool)
 }
 
+// NewBucket creates a bucket of size packets
 func NewBucket(size int, nack bool) *Bucket {
 	b := &Bucket{
-		buf:      make([]byte, size),
-		maxSteps: size/maxPktSize - 1,
+		slots: make([]bucketSlot, size),
 	}
 	if nack {
 		b.nacker = newNACKQueue()
@@ -30,32 +78,64 @@ func NewBucket(size int, nack bool) *Bucket {
 	return b
 }
 
+// extSN returns the extended sequence number of a sn relative to the head
+func (b *Bucket) extSN(sn uint16) uint32 {
+	cycles := b.cycles
+	if (sn-b.headSN)&0x8000 == 0 {
+		if sn < b.headSN {
+			cycles += maxSN
+		}
+	} else if sn > b.headSN {
+		cycles -= maxSN
+	}
+	return cycles | uint32(sn)
+}
+
+func (b *Bucket) headExtSN() uint32 {
+	return b.cycles | uint32(b.headSN)
+}
+
+// addPacket stores a packet and returns its copy in the bucket, or nil if
+// it's older than the packets the bucket keeps.
 func (b *Bucket) addPacket(pkt []byte, sn uint16, latest bool) []byte {
+	now := time.Now().UnixNano()
+	if !b.init {
+		b.init = true
+		head := maxSN + uint32(sn) - 1
+		b.headSN = uint16(head)
+		b.cycles = head &^ (maxSN - 1)
+	}
+	extSN := b.extSN(sn)
+
 	if !latest {
+		if b.headExtSN()-extSN >= uint32(len(b.slots)) {
+			return nil
+		}
 		if b.nacker != nil {
-			b.nacker.remove(sn)
+			b.nacker.remove(sn, now)
 		}
-		return b.set(sn, pkt)
+		return b.set(extSN, pkt)
 	}
+
 	diff := sn - b.headSN
 	b.headSN = sn
-	for i := uint16(1); i < diff; i++ {
-		b.step++
-		if b.nacker != nil {
-			b.nacker.push(sn - i)
+	b.cycles = extSN &^ (maxSN - 1)
+	if b.nacker != nil {
+		// Only the last packets of a gap fit in the NACK queue, pushed in
+		// order so each one is appended
+		lost := int(diff) - 1
+		if lost > maxNackCache {
+			lost = maxNackCache
 		}
-		if b.step > b.maxSteps {
-			b.step = 0
+		for i := lost; i > 0; i-- {
+			b.nacker.push(sn-uint16(i), now)
 		}
-	}
-
-	if b.nacker != nil {
-		np, akf := b.nacker.pairs()
+		np, akf := b.nacker.pairs(now)
 		if len(np) > 0 {
 			b.onLost(np, akf)
 		}
 	}
-	return b.push(pkt)
+	return b.set(extSN, pkt)
 }
 
 func (b *Bucket) getPacket(buf []byte, sn uint16) (i int, err error) {
@@ -73,54 +153,55 @@ func (b *Bucket) getPacket(buf []byte, sn uint16) (i int, err error) {
 	return
 }
 
-func (b *Bucket) push(pkt []byte) []byte {
-	binary.BigEndian.PutUint16(b.buf[b.step*maxPktSize:], uint16(len(pkt)))
-	off := b.step*maxPktSize + 2
-	copy(b.buf[off:], pkt)
-	b.step++
-	if b.step > b.maxSteps {
-		b.step = 0
-	}
-	return b.buf[off : off+len(pkt)]
-}
-
 func (b *Bucket) get(sn uint16) []byte {
-	pos := b.step - int(b.headSN-sn+1)
-	if pos < 0 {
-		pos = b.maxSteps + pos + 1
+	if !b.init {
+		return nil
 	}
-	off := pos * maxPktSize
-	if off > len(b.buf) {
+	extSN := b.extSN(sn)
+	if head := b.headExtSN(); extSN > head || head-extSN >= uint32(len(b.slots)) {
 		return nil
 	}
-	if binary.BigEndian.Uint16(b.buf[off+4:off+6]) != sn {
+	slot := &b.slots[extSN%uint32(len(b.slots))]
+	if slot.sn != extSN {
 		return nil
 	}
-	sz := int(binary.BigEndian.Uint16(b.buf[off : off+2]))
-	return b.buf[off+2 : off+2+sz]
+	return slot.pkt
 }
 
-func (b *Bucket) set(sn uint16, pkt []byte) []byte {
-	pos := b.step - int(b.headSN-sn+1)
-	if pos < 0 {
-		pos = b.maxSteps + pos + 1
+func (b *Bucket) set(extSN uint32, pkt []byte) []byte {
+	slot := &b.slots[extSN%uint32(len(b.slots))]
+	allocated := cap(slot.pkt)
+	slot.sn = extSN
+	slot.pkt = append(slot.pkt[:0], pkt...)
+	if grown := cap(slot.pkt) - allocated; grown > 0 {
+		b.allocated += grown
+		bucketBytes.Add(float64(grown))
 	}
-	off := pos * maxPktSize
-	if off > len(b.buf) {
-		return nil
-	}
-	binary.BigEndian.PutUint16(b.buf[off:], uint16(len(pkt)))
-	copy(b.buf[off+2:], pkt)
-	return b.buf[off+2 : off+2+len(pkt)]
+	return slot.pkt
 }
 
-func (b *Bucket) reset() {
-	if b.headSN != 0 {
-		b.headSN = 0
-		b.step = 0
-		b.onLost = nil
-		if b.nacker != nil {
-			b.nacker.reset()
+// reset prepares a bucket from the pool to keep size packets, the memory
+// of the slots is kept if the size doesn't change.
+func (b *Bucket) reset(size int) {
+	if len(b.slots) != size {
+		b.slots = make([]bucketSlot, size)
+		b.allocated = 0
+	} else {
+		for i := range b.slots {
+			b.slots[i].sn = 0
 		}
 	}
+	bucketBytes.Add(float64(b.allocated))
+	b.headSN = 0
+	b.cycles = 0
+	b.init = false
+	b.onLost = nil
+	if b.nacker != nil {
+		b.nacker.reset()
+	}
+}
+
+// release stops accounting the memory of a bucket put back in the pool
+func (b *Bucket) release() {
+	bucketBytes.Sub(float64(b.allocated))
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/stretchr/testify/assert"
 
@@ -44,7 +46,7 @@ var TestPackets = []*rtp.Packet{
 }
 
 func Test_queue(t *testing.T) {
-	q := NewBucket(2*1000*1000, true)
+	q := NewBucket(500, true)
 	q.onLost = func(_ []rtcp.NackPair, _ bool) {
 	}
 
@@ -100,11 +102,9 @@ func Test_queue_edges(t *testing.T) {
 			},
 		},
 	}
-	q := NewBucket(2*1000*1000, true)
+	q := NewBucket(500, true)
 	q.onLost = func(_ []rtcp.NackPair, _ bool) {
 	}
-	q.headSN = 65532
-	q.step = q.maxSteps - 2
 	for _, p := range TestPackets {
 		p := p
 		assert.NotNil(t, p)
@@ -141,3 +141,116 @@ func Test_queue_edges(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedSN+1, np.SequenceNumber)
 }
+
+func Test_queue_outOfWindow(t *testing.T) {
+	q := NewBucket(64, false)
+	buf := make([]byte, maxPktSize)
+	add := func(sn uint16, latest bool) []byte {
+		pkt, err := (&rtp.Packet{Header: rtp.Header{SequenceNumber: sn}}).Marshal()
+		assert.NoError(t, err)
+		return q.addPacket(pkt, sn, latest)
+	}
+
+	for sn := uint16(65500); sn != 100; sn++ {
+		assert.NotNil(t, add(sn, true))
+	}
+	// Overwritten by the newer packets
+	_, err := q.getPacket(buf, 65500)
+	assert.Equal(t, errPacketNotFound, err)
+	_, err = q.getPacket(buf, 99-64)
+	assert.Equal(t, errPacketNotFound, err)
+	i, err := q.getPacket(buf, 99-63)
+	assert.NoError(t, err)
+	var p rtp.Packet
+	assert.NoError(t, p.Unmarshal(buf[:i]))
+	assert.Equal(t, uint16(99-63), p.SequenceNumber)
+
+	// Too far behind the head, mustn't overwrite a newer packet in its slot
+	assert.Nil(t, add(99-64, false))
+	assert.Nil(t, add(65500, false))
+	i, err = q.getPacket(buf, 99)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Unmarshal(buf[:i]))
+	assert.Equal(t, uint16(99), p.SequenceNumber)
+
+	// Newer than the head
+	_, err = q.getPacket(buf, 100)
+	assert.Equal(t, errPacketNotFound, err)
+}
+
+func Test_queue_largeGap(t *testing.T) {
+	q := NewBucket(64, true)
+	q.onLost = func([]rtcp.NackPair, bool) {}
+	add := func(sn uint16) {
+		pkt, err := (&rtp.Packet{Header: rtp.Header{SequenceNumber: sn}}).Marshal()
+		assert.NoError(t, err)
+		assert.NotNil(t, q.addPacket(pkt, sn, true))
+	}
+
+	add(1)
+	add(30001)
+	// Only the last packets of the gap are kept
+	assert.Len(t, q.nacker.nacks, maxNackCache)
+	assert.Equal(t, uint32(30001-maxNackCache), q.nacker.nacks[0].sn)
+	assert.Equal(t, uint32(30000), q.nacker.nacks[maxNackCache-1].sn)
+}
+
+func Test_queue_largePackets(t *testing.T) {
+	q := NewBucket(8, false)
+	before := testutil.ToFloat64(bucketBytes)
+
+	large := &rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: 1},
+		Payload: make([]byte, 3*maxPktSize),
+	}
+	large.Payload[len(large.Payload)-1] = 0xff
+	pkt, err := large.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, q.addPacket(pkt, 1, true))
+
+	buf := make([]byte, len(pkt))
+	i, err := q.getPacket(buf, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, pkt, buf[:i])
+	_, err = q.getPacket(make([]byte, maxPktSize), 1)
+	assert.Equal(t, errBufferTooSmall, err)
+
+	assert.GreaterOrEqual(t, q.allocated, len(pkt))
+	assert.Equal(t, float64(q.allocated), testutil.ToFloat64(bucketBytes)-before)
+
+	// The memory of the slots is kept by a bucket reused with the same size
+	q.release()
+	assert.Equal(t, before, testutil.ToFloat64(bucketBytes))
+	q.reset(8)
+	assert.Equal(t, float64(q.allocated), testutil.ToFloat64(bucketBytes)-before)
+	_, err = q.getPacket(buf, 1)
+	assert.Equal(t, errPacketNotFound, err)
+	q.release()
+	q.reset(16)
+	assert.Equal(t, 0, q.allocated)
+	q.release()
+	assert.Equal(t, before, testutil.ToFloat64(bucketBytes))
+}
+
+func Test_bucketSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       webrtc.RTPCodecType
+		bufferTime int
+		maxBitrate uint64
+		want       int
+	}{
+		{name: "audio", kind: webrtc.RTPCodecTypeAudio, bufferTime: 1000, want: 100},
+		{name: "audio short", kind: webrtc.RTPCodecTypeAudio, bufferTime: 100, want: minBucketSize},
+		{name: "video", kind: webrtc.RTPCodecTypeVideo, bufferTime: 1000, maxBitrate: 1500, want: 375},
+		{name: "video default bitrate", kind: webrtc.RTPCodecTypeVideo, bufferTime: 1000, want: 750},
+		{name: "video default buffer time", kind: webrtc.RTPCodecTypeVideo, maxBitrate: 1500, want: 375},
+		{name: "video capped", kind: webrtc.RTPCodecTypeVideo, bufferTime: 10000, maxBitrate: 100000, want: maxBucketSize},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, bucketSize(tt.kind, tt.bufferTime, tt.maxBitrate))
+		})
+	}
+}
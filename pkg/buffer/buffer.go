@@ -32,6 +32,7 @@ type pendingPackets struct {
 type Buffer struct {
 	sync.Mutex
 	bucket     *Bucket
+	jitterBuf  *JitterBuffer
 	codecType  webrtc.RTPCodecType
 	videoPool  *sync.Pool
 	audioPool  *sync.Pool
@@ -66,6 +67,8 @@ type Buffer struct {
 	maxSeqNo           uint16  // The highest sequence number received in an RTP data packet
 	jitter             float64 // An estimate of the statistical variance of the RTP data packet inter-arrival time.
 	totalByte          uint64
+	reportByte         uint64 // Bytes received since the last report
+	bitrate            uint64 // Bitrate in bps measured on the last report interval
 	// callbacks
 	feedbackCB   func([]rtcp.Packet)
 	feedbackTWCC func(sn uint16, timeNS int64, marker bool)
@@ -73,8 +76,15 @@ type Buffer struct {
 
 // BufferOptions provides configuration options for the buffer
 type Options struct {
+	// BufferTime is the time in ms of packets kept for retransmissions
 	BufferTime int
+	// MaxBitRate is the max bitrate of the track in kbps, it sizes the
+	// packets kept for retransmissions
 	MaxBitRate uint64
+	// MaxNackTimes is the max number of NACKs sent for a lost packet
+	MaxNackTimes int
+	// NackDeadline is the time in ms after which a lost packet isn't NACKed
+	NackDeadline int
 }
 
 // NewBuffer constructs a new Buffer
@@ -99,15 +109,19 @@ func (b *Buffer) Bind(params webrtc.RTPParameters, o Options) {
 	b.clockRate = codec.ClockRate
 	b.maxBitrate = o.MaxBitRate
 
+	if o.BufferTime <= 0 {
+		o.BufferTime = defaultBufferTime
+	}
+
 	switch {
 	case strings.HasPrefix(codec.MimeType, "audio/"):
 		b.codecType = webrtc.RTPCodecTypeAudio
 		b.bucket = b.audioPool.Get().(*Bucket)
-		b.bucket.reset()
+		b.bucket.reset(bucketSize(b.codecType, o.BufferTime, o.MaxBitRate))
 	case strings.HasPrefix(codec.MimeType, "video/"):
 		b.codecType = webrtc.RTPCodecTypeVideo
 		b.bucket = b.videoPool.Get().(*Bucket)
-		b.bucket.reset()
+		b.bucket.reset(bucketSize(b.codecType, o.BufferTime, o.MaxBitRate))
 	default:
 		b.codecType = webrtc.RTPCodecType(0)
 	}
@@ -119,10 +133,6 @@ func (b *Buffer) Bind(params webrtc.RTPParameters, o Options) {
 		}
 	}
 
-	if o.BufferTime <= 0 {
-		o.BufferTime = defaultBufferTime
-	}
-
 	for _, fb := range codec.RTCPFeedback {
 		switch fb.Type {
 		case webrtc.TypeRTCPFBGoogREMB:
@@ -137,6 +147,9 @@ func (b *Buffer) Bind(params webrtc.RTPParameters, o Options) {
 		}
 	}
 
+	if b.bucket != nil && b.bucket.nacker != nil {
+		b.bucket.nacker.setBudget(o.MaxNackTimes, o.NackDeadline)
+	}
 	b.bucket.onLost = func(nacks []rtcp.NackPair, askKeyframe bool) {
 		pkts := []rtcp.Packet{&rtcp.TransportLayerNack{
 			MediaSSRC: b.mediaSSRC,
@@ -213,13 +226,22 @@ func (b *Buffer) Close() error {
 	b.Lock()
 	defer b.Unlock()
 
+	if b.closed {
+		return nil
+	}
 	b.closed = true
+	if b.bucket != nil {
+		b.bucket.release()
+	}
 	if b.bucket != nil && b.codecType == webrtc.RTPCodecTypeVideo {
 		b.videoPool.Put(b.bucket)
 	}
 	if b.bucket != nil && b.codecType == webrtc.RTPCodecTypeAudio {
 		b.audioPool.Put(b.bucket)
 	}
+	if b.jitterBuf != nil {
+		b.jitterBuf.close()
+	}
 	b.onClose()
 	close(b.packetChan)
 	return nil
@@ -235,7 +257,6 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 	if b.packetCount == 0 {
 		b.baseSN = sn
 		b.maxSeqNo = sn
-		b.bucket.headSN = sn - 1
 		b.lastReport = arrivalTime
 	} else if (sn-b.maxSeqNo)&0x8000 == 0 {
 		if sn < b.maxSeqNo {
@@ -244,13 +265,22 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 		b.maxSeqNo = sn
 	}
 	b.totalByte += uint64(len(pkt))
+	b.reportByte += uint64(len(pkt))
 	b.packetCount++
 
+	// Packets older than the bucket window aren't stored nor forwarded, but
+	// still count for the TWCC feedback and the stats.
+	stored := b.bucket.addPacket(pkt, sn, sn == b.maxSeqNo) != nil
+
+	// The packet read by the down tracks owns its memory, as the bucket
+	// may overwrite it before it's written to every subscriber.
 	var p rtp.Packet
-	if err := p.Unmarshal(b.bucket.addPacket(pkt, sn, sn == b.maxSeqNo)); err != nil {
+	if err := p.Unmarshal(append([]byte(nil), pkt...)); err != nil {
 		return
 	}
-	b.packetChan <- p
+	if stored {
+		b.forward(p, arrivalTime)
+	}
 
 	arrival := uint32(arrivalTime / 1e6 * int64(b.clockRate/1e3))
 	transit := arrival - p.Timestamp
@@ -260,6 +290,9 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 			d = -d
 		}
 		b.jitter += (float64(d) - b.jitter) / 16
+		if b.bucket.nacker != nil && b.clockRate != 0 {
+			b.bucket.nacker.setJitter(int64(b.jitter * 1e9 / float64(b.clockRate)))
+		}
 	}
 	b.lastTransit = transit
 
@@ -269,11 +302,48 @@ func (b *Buffer) calc(pkt []byte, arrivalTime int64) {
 		}
 	}
 	if arrivalTime-b.lastReport >= reportDelta {
+		b.bitrate = b.reportByte * 8 * 1e9 / uint64(arrivalTime-b.lastReport)
+		b.reportByte = 0
 		b.feedbackCB(b.getRTCP())
 		b.lastReport = arrivalTime
 	}
 }
 
+// forward sends the packet to the down tracks and the jitter buffer
+func (b *Buffer) forward(p rtp.Packet, arrivalTime int64) {
+	select {
+	case b.packetChan <- p:
+	default:
+		// Don't block the publisher read loop, subscribers recover the
+		// packet with a NACK, or with a keyframe for video.
+		droppedPackets.WithLabelValues(b.codecType.String()).Inc()
+		if b.codecType == webrtc.RTPCodecTypeVideo {
+			b.feedbackCB([]rtcp.Packet{
+				&rtcp.PictureLossIndication{SenderSSRC: b.mediaSSRC, MediaSSRC: b.mediaSSRC},
+			})
+		}
+	}
+
+	if b.jitterBuf != nil {
+		b.jitterBuf.write(p, arrivalTime)
+	}
+}
+
+// SetMaxBitrate updates the max bitrate of the REMB sent to the publisher,
+// the packets kept for retransmissions stay sized from the Bind options.
+func (b *Buffer) SetMaxBitrate(bitrate uint64) {
+	b.Lock()
+	b.maxBitrate = bitrate
+	b.Unlock()
+}
+
+// MaxBitrate returns the max bitrate of the REMB sent to the publisher
+func (b *Buffer) MaxBitrate() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.maxBitrate
+}
+
 func (b *Buffer) buildREMBPacket() *rtcp.ReceiverEstimatedMaximumBitrate {
 	br := b.totalByte * 8
 	if b.lostRate < 0.02 {
@@ -336,6 +406,26 @@ func (b *Buffer) buildReceptionReport() rtcp.ReceptionReport {
 	return rr
 }
 
+// SenderReportData is the last sender report of a track, mapping its RTP
+// timestamps to the NTP time of the publisher
+type SenderReportData struct {
+	RTPTime uint32
+	NTPTime uint64
+	// Received is the time in ns the report was received, zero if none
+	Received int64
+}
+
+// SenderReport returns the last sender report received
+func (b *Buffer) SenderReport() SenderReportData {
+	b.Lock()
+	defer b.Unlock()
+	return SenderReportData{
+		RTPTime:  b.lastSRRTPTime,
+		NTPTime:  b.lastSRNTPTime,
+		Received: b.lastSRRecv,
+	}
+}
+
 func (b *Buffer) SetSenderReportData(rtpTime uint32, ntpTime uint64) {
 	b.Lock()
 	b.lastSRRTPTime = rtpTime
@@ -358,6 +448,14 @@ func (b *Buffer) getRTCP() []rtcp.Packet {
 	return pkts
 }
 
+// SetJitterBuffer enables the ordered output of the packets through j,
+// in addition to the packets forwarded in arrival order
+func (b *Buffer) SetJitterBuffer(j *JitterBuffer) {
+	b.Lock()
+	b.jitterBuf = j
+	b.Unlock()
+}
+
 func (b *Buffer) GetPacket(buff []byte, sn uint16) (int, error) {
 	b.Lock()
 	defer b.Unlock()
@@ -367,6 +465,14 @@ func (b *Buffer) GetPacket(buff []byte, sn uint16) (int, error) {
 	return b.bucket.getPacket(buff, sn)
 }
 
+// Bitrate returns the incoming bitrate in bps measured on the last
+// report interval
+func (b *Buffer) Bitrate() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.bitrate
+}
+
 func (b *Buffer) OnTransportWideCC(fn func(sn uint16, timeNS int64, marker bool)) {
 	b.feedbackTWCC = fn
 }
@@ -3,6 +3,7 @@ package buffer
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/pion/rtcp"
 
@@ -90,7 +91,7 @@ func TestNewBuffer(t *testing.T) {
 			}
 			pool := &sync.Pool{
 				New: func() interface{} {
-					return NewBucket(2*1000*1000, true)
+					return NewBucket(500, true)
 				},
 			}
 			buff := NewBuffer(123, pool, pool)
@@ -122,3 +123,82 @@ func TestNewBuffer(t *testing.T) {
 		})
 	}
 }
+
+func TestBuffer_SetMaxBitrate(t *testing.T) {
+	b := &Buffer{maxBitrate: 1e6, totalByte: 1e6}
+	b.SetMaxBitrate(3e5)
+	assert.Equal(t, uint64(3e5), b.buildREMBPacket().Bitrate)
+}
+
+func TestBuffer_NonBlockingFanOut(t *testing.T) {
+	pool := &sync.Pool{
+		New: func() interface{} {
+			return NewBucket(500, true)
+		},
+	}
+	buff := NewBuffer(123, pool, pool)
+	var plis int
+	buff.OnFeedback(func(fb []rtcp.Packet) {
+		for _, pkt := range fb {
+			if _, ok := pkt.(*rtcp.PictureLossIndication); ok {
+				plis++
+			}
+		}
+	})
+	buff.Bind(webrtc.RTPParameters{
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/vp8", ClockRate: 90000},
+		}},
+	}, Options{})
+
+	done := make(chan struct{})
+	go func() {
+		// Nobody reads the packets, writes must not block
+		for i := 0; i < 150; i++ {
+			p := CreateTestPacket(&SequenceNumberAndTimeStamp{SequenceNumber: uint16(i)})
+			buf, _ := p.Marshal()
+			_, _ = buff.Write(buf)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("buffer write blocked on the packet channel")
+	}
+	assert.Equal(t, cap(buff.PacketChan()), len(buff.PacketChan()))
+	assert.Equal(t, 50, plis)
+
+	// Packets read own their memory
+	pkt := <-buff.PacketChan()
+	assert.Equal(t, uint16(0), pkt.SequenceNumber)
+	assert.Equal(t, []byte{1, 2, 3}, pkt.Payload)
+}
+
+func TestBuffer_calcOldPacket(t *testing.T) {
+	buff := NewBuffer(123, nil, nil)
+	buff.bucket = NewBucket(10, false)
+	buff.clockRate = 90000
+	buff.tcc = true
+	buff.twccExt = 1
+	buff.OnFeedback(func([]rtcp.Packet) {})
+	var twcc []uint16
+	buff.OnTransportWideCC(func(sn uint16, timeNS int64, marker bool) {
+		twcc = append(twcc, sn)
+	})
+
+	now := time.Now().UnixNano()
+	for i, sn := range []uint16{100, 101, 50} {
+		p := CreateTestPacket(&SequenceNumberAndTimeStamp{SequenceNumber: sn})
+		assert.NoError(t, p.SetExtension(1, []byte{0, byte(i)}))
+		buf, err := p.Marshal()
+		assert.NoError(t, err)
+		buff.calc(buf, now)
+	}
+
+	// The packet older than the bucket window isn't forwarded, but it's
+	// still acknowledged to the publisher
+	assert.Equal(t, 2, len(buff.PacketChan()))
+	assert.Equal(t, []uint16{0, 1, 2}, twcc)
+	assert.Equal(t, uint32(3), buff.packetCount)
+}
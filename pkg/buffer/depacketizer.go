@@ -0,0 +1,233 @@
+package buffer
+
+import (
+	"strings"
+)
+
+// EncodedFrame is a frame of a codec reassembled from its packets
+type EncodedFrame struct {
+	Timestamp uint32
+	Keyframe  bool
+	// Complete is false if packets of the frame were lost
+	Complete bool
+	// Data is the frame bitstream, H.264 NALUs use the Annex B format
+	Data []byte
+}
+
+// Depacketizer extracts the bitstream of a codec from the RTP payloads
+type Depacketizer interface {
+	// AppendPayload appends the bitstream of a payload to data, start is
+	// true if the payload starts a frame
+	AppendPayload(data, payload []byte) (out []byte, start bool, err error)
+	// IsKeyframe returns true if the payload is part of a keyframe
+	IsKeyframe(payload []byte) bool
+}
+
+// NewDepacketizer returns the depacketizer of a codec mime type
+func NewDepacketizer(mimeType string) (Depacketizer, error) {
+	switch strings.ToLower(mimeType) {
+	case "video/vp8":
+		return &VP8Depacketizer{}, nil
+	case "video/vp9":
+		return &VP9Depacketizer{}, nil
+	case "video/h264":
+		return &H264Depacketizer{}, nil
+	case "audio/opus":
+		return &OpusDepacketizer{}, nil
+	}
+	return nil, errUnsupportedCodec
+}
+
+// Depacketize reassembles a frame of the jitter buffer with d, e.g. from the
+// JitterBuffer OnFrame callback. The padding only packets are skipped.
+func Depacketize(d Depacketizer, f Frame) (EncodedFrame, error) {
+	frame := EncodedFrame{
+		Timestamp: f.Timestamp,
+		Complete:  f.Complete,
+	}
+	first := true
+	for _, pkt := range f.Packets {
+		if len(pkt.Payload) == 0 {
+			continue
+		}
+		data, start, err := d.AppendPayload(frame.Data, pkt.Payload)
+		if err != nil {
+			return EncodedFrame{}, err
+		}
+		if first && !start {
+			frame.Complete = false
+		}
+		first = false
+		frame.Data = data
+		frame.Keyframe = frame.Keyframe || d.IsKeyframe(pkt.Payload)
+	}
+	return frame, nil
+}
+
+// VP8Depacketizer depacketizes VP8 according https://tools.ietf.org/html/rfc7741
+type VP8Depacketizer struct{}
+
+func (d *VP8Depacketizer) AppendPayload(data, payload []byte) ([]byte, bool, error) {
+	var pkt VP8Helper
+	if err := pkt.Unmarshal(payload); err != nil {
+		return data, false, err
+	}
+	return append(data, payload[pkt.HeaderSize:]...), pkt.S && pkt.PartitionID == 0, nil
+}
+
+func (d *VP8Depacketizer) IsKeyframe(payload []byte) bool {
+	var pkt VP8Helper
+	return pkt.Unmarshal(payload) == nil && pkt.IsKeyFrame && pkt.PartitionID == 0
+}
+
+// VP9Depacketizer depacketizes VP9 according https://tools.ietf.org/html/draft-ietf-payload-vp9
+type VP9Depacketizer struct{}
+
+func (d *VP9Depacketizer) AppendPayload(data, payload []byte) ([]byte, bool, error) {
+	size, err := vp9HeaderSize(payload)
+	if err != nil {
+		return data, false, err
+	}
+	return append(data, payload[size:]...), payload[0]&0x08 > 0, nil
+}
+
+func (d *VP9Depacketizer) IsKeyframe(payload []byte) bool {
+	return IsVP9Keyframe(payload)
+}
+
+// vp9HeaderSize returns the size of the payload descriptor of a VP9 payload
+func vp9HeaderSize(payload []byte) (int, error) {
+	if len(payload) < 1 {
+		return 0, errShortPacket
+	}
+	I := payload[0]&0x80 > 0
+	P := payload[0]&0x40 > 0
+	L := payload[0]&0x20 > 0
+	F := payload[0]&0x10 > 0
+	V := payload[0]&0x02 > 0
+	idx := 1
+	if I {
+		if len(payload) <= idx {
+			return 0, errShortPacket
+		}
+		if payload[idx]&0x80 > 0 {
+			idx++
+		}
+		idx++
+	}
+	if L {
+		idx++
+		if !F {
+			// TL0PICIDX
+			idx++
+		}
+	}
+	if F && P {
+		// Up to 3 reference indices, N is set if another one follows
+		for i := 0; i < 3; i++ {
+			if len(payload) <= idx {
+				return 0, errShortPacket
+			}
+			n := payload[idx]&0x01 > 0
+			idx++
+			if !n {
+				break
+			}
+		}
+	}
+	if V {
+		if len(payload) <= idx {
+			return 0, errShortPacket
+		}
+		ns := int(payload[idx]>>5) + 1
+		Y := payload[idx]&0x10 > 0
+		G := payload[idx]&0x08 > 0
+		idx++
+		if Y {
+			// Width and height of each spatial layer
+			idx += 4 * ns
+		}
+		if G {
+			if len(payload) <= idx {
+				return 0, errShortPacket
+			}
+			ng := int(payload[idx])
+			idx++
+			for i := 0; i < ng; i++ {
+				if len(payload) <= idx {
+					return 0, errShortPacket
+				}
+				r := int(payload[idx]>>2) & 0x03
+				idx += 1 + r
+			}
+		}
+	}
+	if len(payload) <= idx {
+		return 0, errShortPacket
+	}
+	return idx, nil
+}
+
+// H264Depacketizer depacketizes H.264 according https://tools.ietf.org/html/rfc6184,
+// with the single NAL unit, STAP-A and FU-A packets sent by browsers.
+type H264Depacketizer struct{}
+
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+func (d *H264Depacketizer) AppendPayload(data, payload []byte) ([]byte, bool, error) {
+	if len(payload) < 1 {
+		return data, false, errShortPacket
+	}
+	switch nalu := payload[0] & 0x1F; {
+	case nalu == 0:
+		return data, false, errUnsupportedPacket
+	case nalu <= 23:
+		data = append(data, annexBStartCode...)
+		return append(data, payload...), true, nil
+	case nalu == 24:
+		// STAP-A
+		i := 1
+		for i < len(payload) {
+			if i+2 > len(payload) {
+				return data, false, errShortPacket
+			}
+			length := int(payload[i])<<8 | int(payload[i+1])
+			i += 2
+			if length == 0 || i+length > len(payload) {
+				return data, false, errShortPacket
+			}
+			data = append(data, annexBStartCode...)
+			data = append(data, payload[i:i+length]...)
+			i += length
+		}
+		return data, true, nil
+	case nalu == 28:
+		// FU-A
+		if len(payload) < 3 {
+			return data, false, errShortPacket
+		}
+		if payload[1]&0x80 == 0 {
+			return append(data, payload[2:]...), false, nil
+		}
+		data = append(data, annexBStartCode...)
+		data = append(data, payload[0]&0xE0|payload[1]&0x1F)
+		return append(data, payload[2:]...), true, nil
+	}
+	return data, false, errUnsupportedPacket
+}
+
+func (d *H264Depacketizer) IsKeyframe(payload []byte) bool {
+	return IsH264Keyframe(payload)
+}
+
+// OpusDepacketizer depacketizes Opus according https://tools.ietf.org/html/rfc7587,
+// every packet is a frame decodable on its own.
+type OpusDepacketizer struct{}
+
+func (d *OpusDepacketizer) AppendPayload(data, payload []byte) ([]byte, bool, error) {
+	return append(data, payload...), true, nil
+}
+
+func (d *OpusDepacketizer) IsKeyframe(payload []byte) bool {
+	return true
+}
@@ -0,0 +1,172 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDepacketize(t *testing.T) {
+	tests := []struct {
+		name     string
+		mime     string
+		payloads [][]byte
+		complete bool
+		want     EncodedFrame
+		wantErr  error
+	}{
+		{
+			name: "VP8 keyframe",
+			mime: "video/VP8",
+			payloads: [][]byte{
+				{0x90, 0xe0, 0x80, 0x01, 0x05, 0x20, 0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a},
+				{0x80, 0xe0, 0x80, 0x01, 0x05, 0x20, 0xaa, 0xbb},
+			},
+			complete: true,
+			want: EncodedFrame{
+				Keyframe: true,
+				Complete: true,
+				Data:     []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0xaa, 0xbb},
+			},
+		},
+		{
+			name:     "VP8 interframe without extensions",
+			mime:     "video/vp8",
+			payloads: [][]byte{{0x10, 0x01, 0x02, 0x03}, {}},
+			complete: true,
+			want: EncodedFrame{
+				Complete: true,
+				Data:     []byte{0x01, 0x02, 0x03},
+			},
+		},
+		{
+			name:     "VP8 frame without its start",
+			mime:     "video/vp8",
+			payloads: [][]byte{{0x80, 0xe0, 0x80, 0x01, 0x05, 0x20, 0xaa, 0xbb}},
+			complete: true,
+			want: EncodedFrame{
+				Data: []byte{0xaa, 0xbb},
+			},
+		},
+		{
+			name:     "VP8 descriptor without payload",
+			mime:     "video/vp8",
+			payloads: [][]byte{{0x90, 0x80, 0x80, 0x01}},
+			wantErr:  errShortPacket,
+		},
+		{
+			name: "VP9 keyframe with scalability structure",
+			mime: "video/vp9",
+			payloads: [][]byte{
+				{0xae, 0x80, 0x10, 0x00, 0x07, 0x18, 0x02, 0x80, 0x01, 0xe0, 0x01, 0x04, 0x01, 0x82, 0x49, 0x83},
+				{0xa4, 0x80, 0x10, 0x00, 0x07, 0x42},
+			},
+			complete: true,
+			want: EncodedFrame{
+				Keyframe: true,
+				Complete: true,
+				Data:     []byte{0x82, 0x49, 0x83, 0x42},
+			},
+		},
+		{
+			name:     "VP9 flexible mode interframe",
+			mime:     "video/vp9",
+			payloads: [][]byte{{0xd8, 0x05, 0x03, 0x04, 0x86, 0x00}},
+			complete: true,
+			want: EncodedFrame{
+				Complete: true,
+				Data:     []byte{0x86, 0x00},
+			},
+		},
+		{
+			name:     "VP9 truncated descriptor",
+			mime:     "video/vp9",
+			payloads: [][]byte{{0xd8, 0x05, 0x03}},
+			wantErr:  errShortPacket,
+		},
+		{
+			name: "H264 keyframe",
+			mime: "video/H264",
+			payloads: [][]byte{
+				{0x78, 0x00, 0x02, 0x67, 0x42, 0x00, 0x02, 0x68, 0xce},
+				{0x7c, 0x85, 0xaa},
+				{0x7c, 0x45, 0xbb},
+			},
+			complete: true,
+			want: EncodedFrame{
+				Keyframe: true,
+				Complete: true,
+				Data: []byte{
+					0x00, 0x00, 0x00, 0x01, 0x67, 0x42,
+					0x00, 0x00, 0x00, 0x01, 0x68, 0xce,
+					0x00, 0x00, 0x00, 0x01, 0x65, 0xaa, 0xbb,
+				},
+			},
+		},
+		{
+			name:     "H264 single NALU",
+			mime:     "video/h264",
+			payloads: [][]byte{{0x41, 0x9a}},
+			complete: true,
+			want: EncodedFrame{
+				Complete: true,
+				Data:     []byte{0x00, 0x00, 0x00, 0x01, 0x41, 0x9a},
+			},
+		},
+		{
+			name:     "H264 FU-A without its start",
+			mime:     "video/h264",
+			payloads: [][]byte{{0x7c, 0x45, 0xbb}},
+			complete: true,
+			want: EncodedFrame{
+				Keyframe: false,
+				Data:     []byte{0xbb},
+			},
+		},
+		{
+			name:     "H264 STAP-B",
+			mime:     "video/h264",
+			payloads: [][]byte{{0x79, 0x00, 0x01, 0x00, 0x02, 0x67, 0x42}},
+			wantErr:  errUnsupportedPacket,
+		},
+		{
+			name:     "Opus",
+			mime:     "audio/opus",
+			payloads: [][]byte{{0x78, 0x01, 0x02}},
+			complete: true,
+			want: EncodedFrame{
+				Keyframe: true,
+				Complete: true,
+				Data:     []byte{0x78, 0x01, 0x02},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDepacketizer(tt.mime)
+			assert.NoError(t, err)
+			f := Frame{Timestamp: 3000, Complete: tt.complete}
+			for _, payload := range tt.payloads {
+				f.Packets = append(f.Packets, rtp.Packet{
+					Header:  rtp.Header{Timestamp: 3000},
+					Payload: payload,
+				})
+			}
+			got, err := Depacketize(d, f)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			tt.want.Timestamp = 3000
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewDepacketizer_Unsupported(t *testing.T) {
+	_, err := NewDepacketizer("video/AV1")
+	assert.Equal(t, errUnsupportedCodec, err)
+}
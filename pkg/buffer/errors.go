@@ -6,4 +6,12 @@ var (
 	errPacketNotFound = errors.New("packet not found in cache")
 	errBufferTooSmall = errors.New("buffer too small")
 	errExtNotFound    = errors.New("ext not found")
+
+	// Helpers errors
+	errShortPacket = errors.New("packet is not large enough")
+	errNilPacket   = errors.New("invalid nil packet")
+
+	// Depacketizer errors
+	errUnsupportedCodec  = errors.New("codec not supported")
+	errUnsupportedPacket = errors.New("packet type not supported")
 )
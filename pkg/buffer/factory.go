@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/pion/transport/packetio"
+	"github.com/pion/webrtc/v3"
 )
 
 type Factory struct {
@@ -19,14 +20,12 @@ func NewBufferFactory() *Factory {
 	return &Factory{
 		videoPool: &sync.Pool{
 			New: func() interface{} {
-				// Make a 2MB buffer for video
-				return NewBucket(2*1000*1000, true)
+				return NewBucket(bucketSize(webrtc.RTPCodecTypeVideo, defaultBufferTime, 0), true)
 			},
 		},
 		audioPool: &sync.Pool{
 			New: func() interface{} {
-				// Make a max 25 packets buffer for audio
-				return NewBucket(maxPktSize*25, false)
+				return NewBucket(bucketSize(webrtc.RTPCodecTypeAudio, defaultBufferTime, 0), false)
 			},
 		},
 		rtpBuffers:  make(map[uint32]*Buffer),
@@ -77,3 +76,24 @@ func (f *Factory) GetRTCPReader(ssrc uint32) *RTCPReader {
 	defer f.RUnlock()
 	return f.rtcpReaders[ssrc]
 }
+
+// Close closes every buffer and rtcp reader still in use
+func (f *Factory) Close() {
+	f.RLock()
+	buffers := make([]*Buffer, 0, len(f.rtpBuffers))
+	for _, b := range f.rtpBuffers {
+		buffers = append(buffers, b)
+	}
+	readers := make([]*RTCPReader, 0, len(f.rtcpReaders))
+	for _, r := range f.rtcpReaders {
+		readers = append(readers, r)
+	}
+	f.RUnlock()
+
+	for _, b := range buffers {
+		_ = b.Close()
+	}
+	for _, r := range readers {
+		_ = r.Close()
+	}
+}
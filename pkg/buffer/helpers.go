@@ -0,0 +1,268 @@
+package buffer
+
+import (
+	"encoding/binary"
+
+	log "github.com/pion/ion-log"
+)
+
+// VP8Helper is a helper to get temporal data from VP8 packet header
+/*
+	VP8Helper Payload Descriptor
+			0 1 2 3 4 5 6 7                      0 1 2 3 4 5 6 7
+			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
+			|X|R|N|S|R| PID | (REQUIRED)        |X|R|N|S|R| PID | (REQUIRED)
+			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
+		X:  |I|L|T|K| RSV   | (OPTIONAL)   X:   |I|L|T|K| RSV   | (OPTIONAL)
+			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
+		I:  |M| PictureID   | (OPTIONAL)   I:   |M| PictureID   | (OPTIONAL)
+			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
+		L:  |   TL0PICIDX   | (OPTIONAL)        |   PictureID   |
+			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
+		T/K:|TID|Y| KEYIDX  | (OPTIONAL)   L:   |   TL0PICIDX   | (OPTIONAL)
+			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
+		T/K:|TID|Y| KEYIDX  | (OPTIONAL)
+			+-+-+-+-+-+-+-+-+
+*/
+type VP8Helper struct {
+	TemporalSupported bool
+	// Optional Header
+	PictureID uint16 /* 8 or 16 bits, picture ID */
+	picIDIdx  uint8
+	mBit      bool
+	TL0PICIDX uint8 /* 8 bits temporal level zero index */
+	tlzIdx    uint8
+
+	// Optional Header If either of the T or K bits are set to 1,
+	// the TID/Y/KEYIDX extension field MUST be present.
+	TID uint8 /* 2 bits temporal layer idx*/
+	// LayerSync is set when the frame only depends on the base layer
+	LayerSync bool
+	// IsKeyFrame is a helper to detect if current packet is a keyframe
+	IsKeyFrame bool
+
+	// S is set on the first packet of a partition
+	S bool
+	// PartitionID is the partition of the packet
+	PartitionID uint8
+	// HeaderSize is the size of the payload descriptor
+	HeaderSize int
+}
+
+// Unmarshal parses the passed byte slice and stores the result in the VP8Helper this method is called upon
+func (p *VP8Helper) Unmarshal(payload []byte) error {
+	if payload == nil {
+		return errNilPacket
+	}
+
+	payloadLen := len(payload)
+
+	if payloadLen < 4 {
+		return errShortPacket
+	}
+
+	var idx uint8
+	S := payload[idx]&0x10 > 0
+	p.S = S
+	p.PartitionID = payload[idx] & 0x07
+	// Check for extended bit control
+	if payload[idx]&0x80 > 0 {
+		idx++
+		// Check if T is present, if not, no temporal layer is available
+		p.TemporalSupported = payload[idx]&0x20 > 0
+		K := payload[idx]&0x10 > 0
+		L := payload[idx]&0x40 > 0
+		// Check for PictureID
+		if payload[idx]&0x80 > 0 {
+			idx++
+			p.picIDIdx = idx
+			pid := payload[idx] & 0x7f
+			// Check if m is 1, then Picture ID is 15 bits
+			if payload[idx]&0x80 > 0 {
+				idx++
+				if int(idx) >= payloadLen {
+					return errShortPacket
+				}
+				p.mBit = true
+				p.PictureID = binary.BigEndian.Uint16([]byte{pid, payload[idx]})
+			} else {
+				p.PictureID = uint16(pid)
+			}
+		}
+		// Check if TL0PICIDX is present
+		if L {
+			idx++
+			if int(idx) >= payloadLen {
+				return errShortPacket
+			}
+			p.tlzIdx = idx
+			p.TL0PICIDX = payload[idx]
+		}
+		if p.TemporalSupported || K {
+			idx++
+			if int(idx) >= payloadLen {
+				return errShortPacket
+			}
+			p.TID = (payload[idx] & 0xc0) >> 6
+			p.LayerSync = payload[idx]&0x20 > 0
+		}
+		if int(idx)+1 >= payloadLen {
+			return errShortPacket
+		}
+		idx++
+		// Check is packet is a keyframe by looking at P bit in vp8 payload
+		p.IsKeyFrame = payload[idx]&0x01 == 0 && S
+	} else {
+		idx++
+		// Check is packet is a keyframe by looking at P bit in vp8 payload
+		p.IsKeyFrame = payload[idx]&0x01 == 0 && S
+	}
+	p.HeaderSize = int(idx)
+	return nil
+}
+
+// PictureIDMask returns the mask of the 7 or 15 bits PictureID, zero if the
+// PictureID isn't present
+func (p *VP8Helper) PictureIDMask() uint16 {
+	switch {
+	case p.picIDIdx == 0:
+		return 0
+	case p.mBit:
+		return 0x7fff
+	default:
+		return 0x7f
+	}
+}
+
+// HasTL0PICIDX returns true if the TL0PICIDX is present
+func (p *VP8Helper) HasTL0PICIDX() bool {
+	return p.tlzIdx > 0
+}
+
+// WriteHeader rewrites the PictureID and TL0PICIDX of the unmarshalled payload
+func (p *VP8Helper) WriteHeader(payload []byte, picID uint16, tl0PicIdx uint8) {
+	if p.tlzIdx > 0 {
+		payload[p.tlzIdx] = tl0PicIdx
+	}
+	switch {
+	case p.picIDIdx == 0:
+	case p.mBit:
+		payload[p.picIDIdx] = byte(picID>>8)&0x7f | 0x80
+		payload[p.picIDIdx+1] = byte(picID)
+	default:
+		payload[p.picIDIdx] = byte(picID) & 0x7f
+	}
+}
+
+// IsVP9Keyframe detects if vp9 payload is the start of a keyframe, only the
+// base spatial layer starts a keyframe when layer indices are present.
+// VP9 payload descriptor according https://tools.ietf.org/html/draft-ietf-payload-vp9
+/*
+	+-+-+-+-+-+-+-+-+
+	|I|P|L|F|B|E|V|Z| (REQUIRED)
+	+-+-+-+-+-+-+-+-+
+	|M| PICTURE ID  | (RECOMMENDED)
+	+-+-+-+-+-+-+-+-+
+	|   PICTURE ID  | (OPTIONAL)
+	+-+-+-+-+-+-+-+-+
+	|  TID  |U| SID |D| (CONDITIONALLY RECOMMENDED)
+	+-+-+-+-+-+-+-+-+
+*/
+func IsVP9Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	I := payload[0]&0x80 > 0
+	P := payload[0]&0x40 > 0
+	L := payload[0]&0x20 > 0
+	B := payload[0]&0x08 > 0
+	if P || !B {
+		return false
+	}
+	if !L {
+		return true
+	}
+	idx := 1
+	if I {
+		if len(payload) <= idx {
+			return false
+		}
+		if payload[idx]&0x80 > 0 {
+			idx++
+		}
+		idx++
+	}
+	if len(payload) <= idx {
+		return false
+	}
+	sid := (payload[idx] >> 1) & 0x07
+	return sid == 0
+}
+
+// IsH264Keyframe detects if h264 payload is a keyframe, the SPS sent
+// before an IDR also starts a keyframe so decoders get the parameter sets
+// this code was taken from https://github.com/jech/galene/blob/codecs/rtpconn/rtpreader.go#L45
+// all credits belongs to Juliusz Chroboczek @jech and the awesome Galene SFU
+func IsH264Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	nalu := payload[0] & 0x1F
+	if nalu == 0 {
+		// reserved
+		return false
+	} else if nalu <= 23 {
+		// simple NALU
+		return nalu == 5 || nalu == 7
+	} else if nalu == 24 || nalu == 25 || nalu == 26 || nalu == 27 {
+		// STAP-A, STAP-B, MTAP16 or MTAP24
+		i := 1
+		if nalu == 25 || nalu == 26 || nalu == 27 {
+			// skip DON
+			i += 2
+		}
+		for i < len(payload) {
+			if i+2 > len(payload) {
+				return false
+			}
+			length := uint16(payload[i])<<8 |
+				uint16(payload[i+1])
+			i += 2
+			if i+int(length) > len(payload) {
+				return false
+			}
+			offset := 0
+			if nalu == 26 {
+				offset = 3
+			} else if nalu == 27 {
+				offset = 4
+			}
+			if offset >= int(length) {
+				return false
+			}
+			n := payload[i+offset] & 0x1F
+			if n == 5 || n == 7 {
+				return true
+			} else if n >= 24 {
+				// is this legal?
+				log.Warnf("Non-simple NALU within a STAP")
+			}
+			i += int(length)
+		}
+		if i == len(payload) {
+			return false
+		}
+		return false
+	} else if nalu == 28 || nalu == 29 {
+		// FU-A or FU-B
+		if len(payload) < 2 {
+			return false
+		}
+		if (payload[1] & 0x80) == 0 {
+			// not a starting fragment
+			return false
+		}
+		return payload[1]&0x1F == 5 || payload[1]&0x1F == 7
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVP8Helper_Unmarshal(t *testing.T) {
+	type args struct {
+		payload []byte
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantErr         bool
+		checkTemporal   bool
+		temporalSupport bool
+		checkKeyFrame   bool
+		keyFrame        bool
+		checkPictureID  bool
+		pictureID       uint16
+		checkTlzIdx     bool
+		tlzIdx          uint8
+		checkTempID     bool
+		temporalID      uint8
+	}{
+		{
+			name:    "Empty or nil payload must return error",
+			args:    args{payload: []byte{}},
+			wantErr: true,
+		},
+		{
+			name:    "Small payloads must return errors",
+			args:    args{payload: []byte{0x0, 0x1, 0x2}},
+			wantErr: true,
+		},
+		{
+			name:            "Temporal must be supported by setting T bit to 1",
+			args:            args{payload: []byte{0xff, 0x20, 0x1, 0x2, 0x3, 0x4}},
+			checkTemporal:   true,
+			temporalSupport: true,
+		},
+		{
+			name:           "Picture must be ID 7 bits by setting M bit to 0 and present by I bit set to 1",
+			args:           args{payload: []byte{0xff, 0xff, 0x11, 0x2, 0x3, 0x4}},
+			checkPictureID: true,
+			pictureID:      17,
+		},
+		{
+			name:           "Picture ID must be 15 bits by setting M bit to 1 and present by I bit set to 1",
+			args:           args{payload: []byte{0xff, 0xff, 0x92, 0x67, 0x3, 0x4, 0x5}},
+			checkPictureID: true,
+			pictureID:      4711,
+		},
+		{
+			name:        "Temporal level zero index must be present if L set to 1",
+			args:        args{payload: []byte{0xff, 0xff, 0xff, 0xfd, 0xb4, 0x4, 0x5}},
+			checkTlzIdx: true,
+			tlzIdx:      180,
+		},
+		{
+			name:        "Temporal index must be present and used if T bit set to 1",
+			args:        args{payload: []byte{0xff, 0xff, 0xff, 0xfd, 0xb4, 0x9f, 0x5, 0x6}},
+			checkTempID: true,
+			temporalID:  2,
+		},
+		{
+			name:          "Check if packet is a keyframe by looking at P bit set to 0",
+			args:          args{payload: []byte{0xff, 0xff, 0xff, 0xfd, 0xb4, 0x9f, 0x94, 0x1}},
+			checkKeyFrame: true,
+			keyFrame:      true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := &VP8Helper{}
+			if err := p.Unmarshal(tt.args.payload); (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.checkTemporal {
+				assert.Equal(t, tt.temporalSupport, p.TemporalSupported)
+			}
+			if tt.checkKeyFrame {
+				assert.Equal(t, tt.keyFrame, p.IsKeyFrame)
+			}
+			if tt.checkPictureID {
+				assert.Equal(t, tt.pictureID, p.PictureID)
+			}
+			if tt.checkTlzIdx {
+				assert.Equal(t, tt.tlzIdx, p.TL0PICIDX)
+			}
+			if tt.checkTempID {
+				assert.Equal(t, tt.temporalID, p.TID)
+			}
+		})
+	}
+}
+
+func TestVP8Helper_WriteHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		mask    uint16
+		want    []byte
+	}{
+		{
+			name:    "Payload without PictureID is left as is",
+			payload: []byte{0x10, 0x1, 0x2, 0x3},
+			want:    []byte{0x10, 0x1, 0x2, 0x3},
+		},
+		{
+			name:    "7 bits PictureID and TL0PICIDX are rewritten",
+			payload: []byte{0x90, 0xe0, 0x11, 0xb4, 0x40, 0x0},
+			mask:    0x7f,
+			want:    []byte{0x90, 0xe0, 0x05, 0x07, 0x40, 0x0},
+		},
+		{
+			name:    "15 bits PictureID is rewritten",
+			payload: []byte{0x90, 0xa0, 0x92, 0x67, 0x40, 0x0},
+			mask:    0x7fff,
+			want:    []byte{0x90, 0xa0, 0x81, 0x05, 0x40, 0x0},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var p VP8Helper
+			assert.NoError(t, p.Unmarshal(tt.payload))
+			assert.Equal(t, tt.mask, p.PictureIDMask())
+			p.WriteHeader(tt.payload, 0x105, 7)
+			assert.Equal(t, tt.want, tt.payload)
+		})
+	}
+}
+
+func TestVP8Helper_UnmarshalTruncated(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{
+			name:    "15 bits PictureID without TL0PICIDX",
+			payload: []byte{0x90, 0xf0, 0x80, 0x00},
+		},
+		{
+			name:    "15 bits PictureID without TID",
+			payload: []byte{0x90, 0xa0, 0x80, 0x01},
+		},
+		{
+			name:    "7 bits PictureID and TL0PICIDX without TID",
+			payload: []byte{0x90, 0xe0, 0x01, 0x02},
+		},
+		{
+			name:    "Every optional field without the VP8 payload",
+			payload: []byte{0x90, 0xf0, 0x80, 0x01, 0x02, 0x03},
+		},
+		{
+			name:    "15 bits PictureID cut in half",
+			payload: []byte{0x90, 0x80, 0x80},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var p VP8Helper
+			assert.Equal(t, errShortPacket, p.Unmarshal(tt.payload))
+		})
+	}
+}
+
+func TestIsVP9Keyframe(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{name: "Empty payload is not a keyframe", payload: []byte{}},
+		{name: "Inter predicted frame is not a keyframe", payload: []byte{0x48, 0x1}},
+		{name: "Frame start without layers is a keyframe", payload: []byte{0x08, 0x1}, want: true},
+		{name: "Frame continuation is not a keyframe", payload: []byte{0x04, 0x1}},
+		{name: "Base spatial layer with 15 bits picture ID is a keyframe", payload: []byte{0xa8, 0x80, 0x1, 0x0, 0x1}, want: true},
+		{name: "Upper spatial layer is not a keyframe", payload: []byte{0xa8, 0x5, 0x2, 0x1}},
+		{name: "Truncated layer indices are not a keyframe", payload: []byte{0xa8, 0x80, 0x1}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsVP9Keyframe(tt.payload))
+		})
+	}
+}
+
+func TestIsH264Keyframe(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{name: "Empty payload is not a keyframe", payload: []byte{}},
+		{name: "IDR NALU is a keyframe", payload: []byte{0x65, 0x1}, want: true},
+		{name: "Non IDR NALU is not a keyframe", payload: []byte{0x41, 0x1}},
+		{name: "STAP-A with SPS and PPS is a keyframe", payload: []byte{0x78, 0x0, 0x2, 0x67, 0x1, 0x0, 0x2, 0x68, 0x1}, want: true},
+		{name: "FU-A start of IDR is a keyframe", payload: []byte{0x7c, 0x85, 0x1}, want: true},
+		{name: "FU-A continuation of IDR is not a keyframe", payload: []byte{0x7c, 0x05, 0x1}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsH264Keyframe(tt.payload))
+		})
+	}
+}
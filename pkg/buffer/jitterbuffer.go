@@ -0,0 +1,241 @@
+package buffer
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// Frame is a frame of a track with its packets in sequence number order
+type Frame struct {
+	Timestamp uint32
+	Packets   []rtp.Packet
+	// Complete is false if packets of the frame may have been lost
+	Complete bool
+}
+
+// Gap is a range of packets given up as lost
+type Gap struct {
+	SequenceNumber uint16
+	Count          uint16
+}
+
+// jitterMaxMisorder is how far behind the emitted packets a packet is taken
+// as late, farther ones start a sequence number jump
+const jitterMaxMisorder = 100
+
+type jitterPacket struct {
+	sn      uint32
+	arrival int64
+	packet  rtp.Packet
+}
+
+// JitterBuffer reorders the packets of a buffer by sequence number for the
+// consumers needing them in order, as recorders or RTP egress. A missing
+// packet is waited for up to the latency before it's reported as a gap, and
+// the packets are emitted as frames delimited by the marker bit or a new
+// timestamp. The callbacks are called with the jitter buffer locked, so they
+// mustn't call the buffer back.
+type JitterBuffer struct {
+	sync.Mutex
+	latency int64
+	packets []jitterPacket
+	nextSN  uint32
+	init    bool
+	closed  bool
+	timer   *time.Timer
+	// jump is the packet starting a sequence number jump, the jump is taken
+	// once the packet after it arrives
+	jump *jitterPacket
+
+	frame Frame
+	// lostBefore is true if packets were lost before the current frame
+	lostBefore bool
+
+	onFrame func(Frame)
+	onGap   func(Gap)
+}
+
+// NewJitterBuffer creates a jitter buffer holding the packets up to latency
+func NewJitterBuffer(latency time.Duration) *JitterBuffer {
+	return &JitterBuffer{
+		latency: int64(latency),
+	}
+}
+
+// OnFrame sets the callback called with each frame in order
+func (j *JitterBuffer) OnFrame(fn func(Frame)) {
+	j.Lock()
+	j.onFrame = fn
+	j.Unlock()
+}
+
+// OnGap sets the callback called with the packets given up as lost
+func (j *JitterBuffer) OnGap(fn func(Gap)) {
+	j.Lock()
+	j.onGap = fn
+	j.Unlock()
+}
+
+// write adds a packet received at arrival and emits the packets ready,
+// a timer emits the packets held once the deadline of a gap passes.
+func (j *JitterBuffer) write(p rtp.Packet, arrival int64) {
+	j.Lock()
+	defer j.Unlock()
+	if j.closed {
+		return
+	}
+	j.push(p, arrival)
+	j.pop(arrival)
+	j.schedule()
+}
+
+func (j *JitterBuffer) schedule() {
+	if len(j.packets) == 0 {
+		return
+	}
+	wait := time.Duration(j.packets[0].arrival + j.latency - time.Now().UnixNano())
+	if j.timer == nil {
+		j.timer = time.AfterFunc(wait, j.expire)
+		return
+	}
+	j.timer.Reset(wait)
+}
+
+func (j *JitterBuffer) expire() {
+	j.Lock()
+	defer j.Unlock()
+	if j.closed {
+		return
+	}
+	j.pop(time.Now().UnixNano())
+	j.schedule()
+}
+
+// push inserts a packet by sequence number, the duplicates and packets
+// late by up to jitterMaxMisorder are dropped. A packet farther behind is a
+// sequence number jump, taken as a forward jump once confirmed by the next
+// packet: the packets held are flushed and the skipped ones reported lost.
+func (j *JitterBuffer) push(p rtp.Packet, arrival int64) {
+	if !j.init {
+		j.init = true
+		j.nextSN = maxSN | uint32(p.SequenceNumber)
+	}
+	if (p.SequenceNumber-uint16(j.nextSN))&0x8000 != 0 {
+		if uint16(j.nextSN)-p.SequenceNumber <= jitterMaxMisorder {
+			return
+		}
+		if j.jump == nil || p.SequenceNumber != j.jump.packet.SequenceNumber+1 {
+			j.jump = &jitterPacket{arrival: arrival, packet: p}
+			return
+		}
+		jump := *j.jump
+		j.jump = nil
+		j.resync(jump.packet.SequenceNumber)
+		j.insert(j.nextSN, jump.arrival, jump.packet)
+	}
+	j.insert(j.nextSN+uint32(p.SequenceNumber-uint16(j.nextSN)), arrival, p)
+}
+
+// resync emits the packets held and moves the next sequence number forward
+// to sn, the packets skipped are reported lost.
+func (j *JitterBuffer) resync(sn uint16) {
+	j.pop(math.MaxInt64)
+	if count := sn - uint16(j.nextSN); count > 0 {
+		j.lose(uint16(j.nextSN), count)
+		j.nextSN += uint32(count)
+	}
+}
+
+func (j *JitterBuffer) insert(sn uint32, arrival int64, p rtp.Packet) {
+	i := len(j.packets)
+	for i > 0 && j.packets[i-1].sn >= sn {
+		if j.packets[i-1].sn == sn {
+			return
+		}
+		i--
+	}
+	j.packets = append(j.packets, jitterPacket{})
+	copy(j.packets[i+1:], j.packets[i:])
+	j.packets[i] = jitterPacket{sn: sn, arrival: arrival, packet: p}
+}
+
+// pop emits the packets in order, a missing packet is given up once the
+// packet after it waited the latency.
+func (j *JitterBuffer) pop(now int64) {
+	n := 0
+	for _, pkt := range j.packets {
+		if pkt.sn != j.nextSN {
+			if now-pkt.arrival < j.latency {
+				break
+			}
+			j.lose(uint16(j.nextSN), uint16(pkt.sn-j.nextSN))
+			j.nextSN = pkt.sn
+		}
+		j.nextSN++
+		j.add(pkt.packet)
+		n++
+	}
+	copy(j.packets, j.packets[n:])
+	for i := len(j.packets) - n; i < len(j.packets); i++ {
+		j.packets[i] = jitterPacket{}
+	}
+	j.packets = j.packets[:len(j.packets)-n]
+}
+
+func (j *JitterBuffer) lose(sn, count uint16) {
+	if j.onGap != nil {
+		j.onGap(Gap{SequenceNumber: sn, Count: count})
+	}
+	// The lost packets may be the end of the current frame or the start
+	// of the next one, it's known when the next packet is emitted.
+	if len(j.frame.Packets) > 0 {
+		j.frame.Complete = false
+	}
+	j.lostBefore = true
+}
+
+func (j *JitterBuffer) add(p rtp.Packet) {
+	if len(j.frame.Packets) > 0 {
+		if p.Timestamp != j.frame.Timestamp {
+			j.emit()
+		} else {
+			j.lostBefore = false
+		}
+	}
+	if len(j.frame.Packets) == 0 {
+		j.frame.Timestamp = p.Timestamp
+		j.frame.Complete = !j.lostBefore
+		j.lostBefore = false
+	}
+	j.frame.Packets = append(j.frame.Packets, p)
+	if p.Marker {
+		j.emit()
+	}
+}
+
+func (j *JitterBuffer) emit() {
+	if j.onFrame != nil {
+		j.onFrame(j.frame)
+	}
+	j.frame = Frame{}
+}
+
+// close emits the packets held and the last frame, and stops the timer
+func (j *JitterBuffer) close() {
+	j.Lock()
+	defer j.Unlock()
+	if j.closed {
+		return
+	}
+	j.closed = true
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.pop(math.MaxInt64)
+	if len(j.frame.Packets) > 0 {
+		j.emit()
+	}
+}
@@ -0,0 +1,244 @@
+package buffer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type jitterPush struct {
+	sn      uint16
+	ts      uint32
+	marker  bool
+	arrival int64 // ms
+}
+
+type jitterFrame struct {
+	ts       uint32
+	sns      []uint16
+	complete bool
+}
+
+func TestJitterBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		pushes []jitterPush
+		now    int64 // ms
+		frames []jitterFrame
+		gaps   []Gap
+	}{
+		{
+			name: "in order frames",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100}, {sn: 2, ts: 100, marker: true},
+				{sn: 3, ts: 200, marker: true},
+				{sn: 4, ts: 300},
+			},
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1, 2}, complete: true},
+				{ts: 200, sns: []uint16{3}, complete: true},
+			},
+		},
+		{
+			name: "reordered within latency",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100}, {sn: 3, ts: 200, marker: true, arrival: 5}, {sn: 2, ts: 100, marker: true, arrival: 10},
+			},
+			now: 10,
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1, 2}, complete: true},
+				{ts: 200, sns: []uint16{3}, complete: true},
+			},
+		},
+		{
+			name: "gap inside a frame",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100}, {sn: 3, ts: 100, marker: true},
+				{sn: 4, ts: 200, marker: true},
+			},
+			now: 100,
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1, 3}, complete: false},
+				{ts: 200, sns: []uint16{4}, complete: true},
+			},
+			gaps: []Gap{{SequenceNumber: 2, Count: 1}},
+		},
+		{
+			name: "gap between frames",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100, marker: true},
+				{sn: 4, ts: 300}, {sn: 5, ts: 300, marker: true},
+				{sn: 6, ts: 400, marker: true},
+			},
+			now: 100,
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1}, complete: true},
+				{ts: 300, sns: []uint16{4, 5}, complete: false},
+				{ts: 400, sns: []uint16{6}, complete: true},
+			},
+			gaps: []Gap{{SequenceNumber: 2, Count: 2}},
+		},
+		{
+			name: "gap not due",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100, marker: true},
+				{sn: 3, ts: 300, marker: true, arrival: 20},
+			},
+			now: 69,
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1}, complete: true},
+			},
+		},
+		{
+			name: "duplicates",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100, marker: true}, {sn: 1, ts: 100, marker: true},
+				{sn: 3, ts: 300, marker: true}, {sn: 3, ts: 300, marker: true},
+			},
+			now: 100,
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1}, complete: true},
+				{ts: 300, sns: []uint16{3}, complete: false},
+			},
+			gaps: []Gap{{SequenceNumber: 2, Count: 1}},
+		},
+		{
+			name: "timestamp boundaries",
+			pushes: []jitterPush{
+				{sn: 10, ts: 960}, {sn: 11, ts: 1920}, {sn: 12, ts: 2880},
+			},
+			frames: []jitterFrame{
+				{ts: 960, sns: []uint16{10}, complete: true},
+				{ts: 1920, sns: []uint16{11}, complete: true},
+			},
+		},
+		{
+			name: "wraparound",
+			pushes: []jitterPush{
+				{sn: 65534, ts: 100}, {sn: 0, ts: 100, marker: true}, {sn: 65535, ts: 100},
+				{sn: 1, ts: 200, marker: true},
+			},
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{65534, 65535, 0}, complete: true},
+				{ts: 200, sns: []uint16{1}, complete: true},
+			},
+		},
+		{
+			name: "late packets",
+			pushes: []jitterPush{
+				{sn: 200, ts: 100, marker: true}, {sn: 201, ts: 200, marker: true},
+				{sn: 150, ts: 50, marker: true}, {sn: 101, ts: 10, marker: true},
+				{sn: 202, ts: 300, marker: true},
+			},
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{200}, complete: true},
+				{ts: 200, sns: []uint16{201}, complete: true},
+				{ts: 300, sns: []uint16{202}, complete: true},
+			},
+		},
+		{
+			name: "forward jump",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100}, {sn: 3, ts: 200, marker: true},
+				{sn: 40000, ts: 300}, {sn: 40001, ts: 300, marker: true},
+				{sn: 40002, ts: 400, marker: true},
+			},
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1}, complete: false},
+				{ts: 200, sns: []uint16{3}, complete: false},
+				{ts: 300, sns: []uint16{40000, 40001}, complete: false},
+				{ts: 400, sns: []uint16{40002}, complete: true},
+			},
+			gaps: []Gap{{SequenceNumber: 2, Count: 1}, {SequenceNumber: 4, Count: 39996}},
+		},
+		{
+			name: "single far packet ignored",
+			pushes: []jitterPush{
+				{sn: 1, ts: 100, marker: true},
+				{sn: 40000, ts: 300, marker: true},
+				{sn: 2, ts: 200, marker: true},
+			},
+			frames: []jitterFrame{
+				{ts: 100, sns: []uint16{1}, complete: true},
+				{ts: 200, sns: []uint16{2}, complete: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJitterBuffer(50 * time.Millisecond)
+			var frames []jitterFrame
+			var gaps []Gap
+			j.onFrame = func(f Frame) {
+				frame := jitterFrame{ts: f.Timestamp, complete: f.Complete}
+				for _, p := range f.Packets {
+					frame.sns = append(frame.sns, p.SequenceNumber)
+				}
+				frames = append(frames, frame)
+			}
+			j.onGap = func(g Gap) {
+				gaps = append(gaps, g)
+			}
+			for _, p := range tt.pushes {
+				j.push(rtp.Packet{Header: rtp.Header{
+					SequenceNumber: p.sn,
+					Timestamp:      p.ts,
+					Marker:         p.marker,
+				}}, p.arrival*1e6)
+				j.pop(p.arrival * 1e6)
+			}
+			j.pop(tt.now * 1e6)
+			assert.Equal(t, tt.frames, frames)
+			assert.Equal(t, tt.gaps, gaps)
+		})
+	}
+}
+
+func TestJitterBuffer_Deadline(t *testing.T) {
+	j := NewJitterBuffer(20 * time.Millisecond)
+	var mu sync.Mutex
+	var frames []Frame
+	var gaps []Gap
+	j.OnFrame(func(f Frame) {
+		mu.Lock()
+		frames = append(frames, f)
+		mu.Unlock()
+	})
+	j.OnGap(func(g Gap) {
+		mu.Lock()
+		gaps = append(gaps, g)
+		mu.Unlock()
+	})
+
+	j.write(rtp.Packet{Header: rtp.Header{SequenceNumber: 1, Timestamp: 100, Marker: true}}, time.Now().UnixNano())
+	j.write(rtp.Packet{Header: rtp.Header{SequenceNumber: 3, Timestamp: 200, Marker: true}}, time.Now().UnixNano())
+	mu.Lock()
+	assert.Len(t, frames, 1)
+	mu.Unlock()
+
+	// The timer gives up the missing packet without a new packet
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(frames) == 2
+	}, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []Gap{{SequenceNumber: 2, Count: 1}}, gaps)
+	assert.False(t, frames[1].Complete)
+	mu.Unlock()
+
+	// The last frame is emitted on close
+	j.write(rtp.Packet{Header: rtp.Header{SequenceNumber: 4, Timestamp: 300}}, time.Now().UnixNano())
+	j.close()
+	mu.Lock()
+	assert.Len(t, frames, 3)
+	mu.Unlock()
+	j.write(rtp.Packet{Header: rtp.Header{SequenceNumber: 5, Timestamp: 300, Marker: true}}, time.Now().UnixNano())
+	mu.Lock()
+	assert.Len(t, frames, 3)
+	mu.Unlock()
+}
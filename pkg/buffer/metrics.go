@@ -0,0 +1,22 @@
+package buffer
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var droppedPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sfu",
+	Subsystem: "buffer",
+	Name:      "dropped_packets_total",
+	Help:      "Packets received but dropped because the fan-out couldn't keep up.",
+}, []string{"kind"})
+
+var bucketBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "sfu",
+	Subsystem: "buffer",
+	Name:      "bucket_bytes",
+	Help:      "Memory allocated to keep the packets of the buffers in use for retransmissions.",
+})
+
+func init() {
+	prometheus.MustRegister(droppedPackets)
+	prometheus.MustRegister(bucketBytes)
+}
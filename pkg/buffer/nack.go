@@ -6,70 +6,137 @@ import (
 	"github.com/pion/rtcp"
 )
 
-const maxNackTimes = 3   // Max number of times a packet will be NACKed
-const maxNackCache = 100 // Max NACK sn the sfu will keep reference
+const (
+	maxNackTimes = 3    // Default max number of times a packet will be NACKed
+	maxNackCache = 1000 // Max NACK sn the sfu will keep reference
+
+	// Default timing, in ns
+	defaultNackRTT      = 100e6 // RTT until measured from the retransmissions
+	defaultNackDeadline = 1e9   // Time after which a lost packet is given up
+	minNackInterval     = 10e6  // Min time between NACKs of a packet
+	maxReorderDelay     = 50e6  // Max time waiting for a reordered packet before the first NACK
+)
 
 type nack struct {
-	sn     uint32
-	nacked uint8
+	sn       uint32
+	nacked   uint8
+	detected int64 // Time the loss was detected
+	lastNack int64 // Time of the last NACK sent
 }
 
+// nackQueue keeps the lost packets and schedules their NACKs, the first
+// NACK waits for a reordered packet based on the inter-arrival jitter, and
+// the next ones wait for the retransmission based on the RTT measured from
+// the retransmitted packets. A packet is given up when it's NACKed the max
+// number of times or its deadline passed.
 type nackQueue struct {
-	nacks   []nack
-	counter uint8
-	maxSN   uint16
-	kfSN    uint32
-	cycles  uint32
+	nacks  []nack
+	maxSN  uint16
+	kfSN   uint32
+	cycles uint32
+	init   bool
+
+	rtt      int64 // Smoothed RTT in ns
+	jitter   int64 // Inter-arrival jitter in ns
+	maxNacks uint8
+	deadline int64
 }
 
 func newNACKQueue() *nackQueue {
 	return &nackQueue{
-		nacks:  make([]nack, 0, maxNackCache+1),
-		maxSN:  0,
-		cycles: 0,
+		nacks: make([]nack, 0, maxNackCache+1),
 	}
 }
 
 func (n *nackQueue) reset() {
 	n.maxSN = 0
-	n.counter = 0
 	n.cycles = 0
 	n.kfSN = 0
+	n.init = false
+	n.rtt = 0
+	n.jitter = 0
 	n.nacks = n.nacks[:0]
 }
 
-func (n *nackQueue) remove(sn uint16) {
-	var extSN uint32
-	if sn > n.maxSN && sn&0x8000 == 1 && n.maxSN&0x8000 == 0 {
-		extSN = (n.cycles - maxSN) | uint32(sn)
-	} else {
-		extSN = n.cycles | uint32(sn)
-	}
+// setBudget sets the max number of NACKs of a packet and the time in ms
+// after which a lost packet is given up, zero keeps the defaults
+func (n *nackQueue) setBudget(maxNacks, deadline int) {
+	n.maxNacks = uint8(maxNacks)
+	n.deadline = int64(deadline) * 1e6
+}
 
-	i := sort.Search(len(n.nacks), func(i int) bool { return n.nacks[i].sn >= extSN })
-	if i > len(n.nacks) || n.nacks[i].sn != extSN {
-		return
-	}
-	copy(n.nacks[i:], n.nacks[i+1:])
-	n.nacks = n.nacks[:len(n.nacks)-1]
+// setJitter sets the inter-arrival jitter in ns
+func (n *nackQueue) setJitter(jitter int64) {
+	n.jitter = jitter
 }
 
-func (n *nackQueue) push(sn uint16) {
-	var extSN uint32
-	if n.maxSN == 0 {
+// extSN returns the extended sequence number of a sn, updating the cycles
+// if it's newer than the max sn seen
+func (n *nackQueue) extSN(sn uint16, update bool) uint32 {
+	if !n.init {
+		if !update {
+			return uint32(sn)
+		}
+		n.init = true
 		n.maxSN = sn
-	} else if (sn-n.maxSN)&0x8000 == 0 {
+	}
+	if (sn-n.maxSN)&0x8000 == 0 {
+		// Newer than the max sn
+		cycles := n.cycles
 		if sn < n.maxSN {
-			n.cycles += maxSN
+			cycles += maxSN
 		}
-		n.maxSN = sn
+		if update {
+			n.cycles = cycles
+			n.maxSN = sn
+		}
+		return cycles | uint32(sn)
+	}
+	if sn > n.maxSN {
+		// Older from the previous cycle
+		if n.cycles == 0 {
+			n.rebase()
+		}
+		return (n.cycles - maxSN) | uint32(sn)
 	}
+	return n.cycles | uint32(sn)
+}
 
-	if sn > n.maxSN && sn&0x8000 == 1 && n.maxSN&0x8000 == 0 {
-		extSN = (n.cycles - maxSN) | uint32(sn)
-	} else {
-		extSN = n.cycles | uint32(sn)
+// rebase shifts the extended sequence numbers a cycle up, so packets from
+// before a wraparound at the start of the stream can be represented
+func (n *nackQueue) rebase() {
+	n.cycles += maxSN
+	if n.kfSN != 0 {
+		n.kfSN += maxSN
+	}
+	for i := range n.nacks {
+		n.nacks[i].sn += maxSN
 	}
+}
+
+// remove deletes a packet received, the time since its last NACK is used
+// as a RTT sample
+func (n *nackQueue) remove(sn uint16, now int64) {
+	extSN := n.extSN(sn, false)
+	i := sort.Search(len(n.nacks), func(i int) bool { return n.nacks[i].sn >= extSN })
+	if i >= len(n.nacks) || n.nacks[i].sn != extSN {
+		return
+	}
+	if nck := n.nacks[i]; nck.nacked > 0 && now > nck.lastNack {
+		sample := now - nck.lastNack
+		if n.rtt == 0 {
+			n.rtt = sample
+		} else {
+			n.rtt += (sample - n.rtt) / 8
+		}
+	}
+	copy(n.nacks[i:], n.nacks[i+1:])
+	n.nacks = n.nacks[:len(n.nacks)-1]
+}
+
+// push adds a lost packet detected at now
+func (n *nackQueue) push(sn uint16, now int64) {
+	extSN := n.extSN(sn, true)
 
 	i := sort.Search(len(n.nacks), func(i int) bool { return n.nacks[i].sn >= extSN })
 	if i < len(n.nacks) && n.nacks[i].sn == extSN {
@@ -78,50 +145,96 @@ func (n *nackQueue) push(sn uint16) {
 	n.nacks = append(n.nacks, nack{})
 	copy(n.nacks[i+1:], n.nacks[i:])
 	n.nacks[i] = nack{
-		sn:     extSN,
-		nacked: 0,
+		sn:       extSN,
+		detected: now,
 	}
 
 	if len(n.nacks) > maxNackCache {
 		n.nacks = n.nacks[1:]
 	}
-	n.counter++
 }
 
-func (n *nackQueue) pairs() ([]rtcp.NackPair, bool) {
-	if n.counter < 2 {
-		n.counter++
-		return nil, false
+// retryInterval is the time waited for a retransmission before NACKing
+// a packet again
+func (n *nackQueue) retryInterval() int64 {
+	rtt := n.rtt
+	if rtt == 0 {
+		rtt = defaultNackRTT
+	}
+	interval := rtt + 2*n.jitter
+	if interval < minNackInterval {
+		interval = minNackInterval
+	}
+	return interval
+}
+
+// reorderDelay is the time waited for a reordered packet before the
+// first NACK of a packet
+func (n *nackQueue) reorderDelay() int64 {
+	delay := 2 * n.jitter
+	if delay > maxReorderDelay {
+		delay = maxReorderDelay
+	}
+	return delay
+}
+
+// pairs returns the NACKs due at now, and true if a keyframe must be asked
+// because a packet was given up
+func (n *nackQueue) pairs(now int64) ([]rtcp.NackPair, bool) {
+	maxNacks := n.maxNacks
+	if maxNacks == 0 {
+		maxNacks = maxNackTimes
 	}
-	n.counter = 0
+	deadline := n.deadline
+	if deadline <= 0 {
+		deadline = defaultNackDeadline
+	}
+	retry := n.retryInterval()
+	reorder := n.reorderDelay()
+
 	i := 0
 	askKF := false
+	started := false
 	var np rtcp.NackPair
 	var nps []rtcp.NackPair
 	for _, nck := range n.nacks {
-		if nck.nacked >= maxNackTimes {
+		expired := now-nck.detected > deadline ||
+			(nck.nacked >= maxNacks && now-nck.lastNack >= retry)
+		if expired {
 			if nck.sn > n.kfSN {
 				n.kfSN = nck.sn
 				askKF = true
 			}
 			continue
 		}
-		n.nacks[i] = nack{
-			sn:     nck.sn,
-			nacked: nck.nacked + 1,
+		due := false
+		if nck.nacked == 0 {
+			due = now-nck.detected >= reorder
+		} else {
+			due = nck.nacked < maxNacks && now-nck.lastNack >= retry
+		}
+		if due {
+			nck.nacked++
+			nck.lastNack = now
 		}
+		n.nacks[i] = nck
 		i++
-		if np.PacketID == 0 || uint16(nck.sn) > np.PacketID+16 {
-			if np.PacketID != 0 {
+		if !due {
+			continue
+		}
+		sn := uint16(nck.sn)
+		if !started || sn-np.PacketID > 16 {
+			if started {
 				nps = append(nps, np)
 			}
-			np.PacketID = uint16(nck.sn)
+			started = true
+			np.PacketID = sn
 			np.LostPackets = 0
 			continue
 		}
-		np.LostPackets |= 1 << (uint16(nck.sn) - np.PacketID - 1)
+		np.LostPackets |= 1 << (sn - np.PacketID - 1)
 	}
-	if np.PacketID != 0 {
+	if started {
 		nps = append(nps, np)
 	}
 	n.nacks = n.nacks[:i]
@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"math/rand"
 	"reflect"
 	"testing"
 
@@ -58,9 +59,9 @@ func Test_nackQueue_pairs(t *testing.T) {
 				cycles: tt.fields.cycles,
 			}
 			for _, sn := range tt.args {
-				n.push(sn)
+				n.push(sn, 0)
 			}
-			got, _ := n.pairs()
+			got, _ := n.pairs(0)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("pairs() = %v, want %v", got, tt.want)
 			}
@@ -102,7 +103,7 @@ func Test_nackQueue_push(t *testing.T) {
 				cycles: tt.fields.cycles,
 			}
 			for _, sn := range tt.args.sn {
-				n.push(sn)
+				n.push(sn, 0)
 			}
 			var newSN []uint32
 			for _, sn := range n.nacks {
@@ -167,9 +168,9 @@ func Test_nackQueue_remove(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			n := nackQueue{}
 			for _, sn := range tt.args.sn {
-				n.push(sn)
+				n.push(sn, 0)
 			}
-			n.remove(5)
+			n.remove(5, 0)
 			var newSN []uint32
 			for _, sn := range n.nacks {
 				newSN = append(newSN, sn.sn)
@@ -178,3 +179,207 @@ func Test_nackQueue_remove(t *testing.T) {
 		})
 	}
 }
+
+func Test_nackQueue_timing(t *testing.T) {
+	const ms = int64(1e6)
+	n := newNACKQueue()
+	n.setJitter(10 * ms)
+	n.push(10, 0)
+
+	// First NACK waits for a reordered packet
+	got, _ := n.pairs(10 * ms)
+	assert.Empty(t, got)
+	got, _ = n.pairs(20 * ms)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 10}}, got)
+
+	// Retries wait for the retransmission, the default RTT plus jitter
+	got, _ = n.pairs(100 * ms)
+	assert.Empty(t, got)
+	got, _ = n.pairs(140 * ms)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 10}}, got)
+
+	// Retransmissions measure the RTT
+	n.push(11, 140*ms)
+	got, _ = n.pairs(160 * ms)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 11}}, got)
+	n.remove(11, 190*ms)
+	assert.Equal(t, 30*ms, n.rtt)
+	got, _ = n.pairs(200 * ms)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 10}}, got)
+
+	// Packets are given up after the max NACKs, asking a keyframe
+	got, kf := n.pairs(250 * ms)
+	assert.Empty(t, got)
+	assert.True(t, kf)
+	assert.Empty(t, n.nacks)
+}
+
+func Test_nackQueue_budget(t *testing.T) {
+	const ms = int64(1e6)
+	n := newNACKQueue()
+	n.setBudget(1, 100)
+	n.push(1, 0)
+	got, _ := n.pairs(0)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 1}}, got)
+	n.push(2, 90*ms)
+	// Packet 1 reached its max NACKs, packet 2 is NACKed
+	got, kf := n.pairs(95 * ms)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 2}}, got)
+	assert.False(t, kf)
+	// Packet 1 is given up once its retransmission is late
+	got, kf = n.pairs(100 * ms)
+	assert.Empty(t, got)
+	assert.True(t, kf)
+	assert.Equal(t, 1, len(n.nacks))
+	// Packet 2 passed its deadline
+	_, kf = n.pairs(191 * ms)
+	assert.True(t, kf)
+	assert.Empty(t, n.nacks)
+}
+
+func Test_nackQueue_wraparound(t *testing.T) {
+	n := newNACKQueue()
+	// Lost packets are pushed from the newest, as done by the bucket
+	for _, sn := range []uint16{1, 0, 65535, 65534} {
+		n.push(sn, 0)
+	}
+	got, _ := n.pairs(0)
+	assert.Equal(t, []rtcp.NackPair{{PacketID: 65534, LostPackets: 7}}, got)
+
+	n.remove(0, 0)
+	n.remove(65534, 0)
+	var sns []uint16
+	for _, nck := range n.nacks {
+		sns = append(sns, uint16(nck.sn))
+	}
+	assert.Equal(t, []uint16{65535, 1}, sns)
+}
+
+// simulateNACKs sends packets every 10ms from startSN dropping the lost ones,
+// NACKed packets are retransmitted after the rtt unless the retransmission is
+// lost. Returns the packets lost and the ones recovered.
+func simulateNACKs(startSN uint16, count int, rtt int64, lost func(i int) bool, rtxLost func() bool) (int, int, bool) {
+	type rtx struct {
+		sn      uint16
+		arrival int64
+	}
+	const interval = int64(10e6)
+	n := newNACKQueue()
+	n.setJitter(2e6)
+	missing := make(map[uint16]bool)
+	var pending []rtx
+	lostCount, recovered := 0, 0
+	askedKF := false
+	head := startSN - 1
+
+	// Send lossless packets at the end so the last losses can be recovered
+	for i := 0; i < count+200; i++ {
+		now := int64(i) * interval
+		sn := startSN + uint16(i)
+		rest := pending[:0]
+		for _, p := range pending {
+			if p.arrival > now {
+				rest = append(rest, p)
+				continue
+			}
+			if missing[p.sn] {
+				delete(missing, p.sn)
+				recovered++
+				n.remove(p.sn, p.arrival)
+			}
+		}
+		pending = rest
+
+		if i < count && lost(i) {
+			missing[sn] = true
+			lostCount++
+			continue
+		}
+		for j := uint16(1); j < sn-head; j++ {
+			n.push(sn-j, now)
+		}
+		head = sn
+		nps, kf := n.pairs(now)
+		askedKF = askedKF || kf
+		for _, np := range nps {
+			for _, lostSN := range np.PacketList() {
+				if !rtxLost() {
+					pending = append(pending, rtx{sn: lostSN, arrival: now + rtt})
+				}
+			}
+		}
+	}
+	return lostCount, recovered, askedKF
+}
+
+func Test_nackQueue_recovery(t *testing.T) {
+	tests := []struct {
+		name         string
+		startSN      uint16
+		rtt          int64
+		lossRate     float64
+		burst        int
+		rtxLossRate  float64
+		wantRecovery float64
+		wantKeyframe bool
+	}{
+		{
+			name:         "Must recover random loss",
+			startSN:      1000,
+			rtt:          50e6,
+			lossRate:     0.05,
+			wantRecovery: 1,
+		},
+		{
+			name:         "Must recover random loss with lost retransmissions",
+			startSN:      1000,
+			rtt:          50e6,
+			lossRate:     0.2,
+			rtxLossRate:  0.2,
+			wantRecovery: 0.97,
+			wantKeyframe: true,
+		},
+		{
+			name:         "Must recover burst loss",
+			startSN:      1000,
+			rtt:          80e6,
+			burst:        10,
+			wantRecovery: 1,
+		},
+		{
+			name:         "Must recover loss on sequence number wraparound",
+			startSN:      65000,
+			rtt:          50e6,
+			lossRate:     0.1,
+			burst:        5,
+			wantRecovery: 1,
+		},
+		{
+			name:         "Must give up packets after the deadline",
+			startSN:      1000,
+			rtt:          2e9,
+			lossRate:     0.05,
+			wantRecovery: 0,
+			wantKeyframe: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			lost := func(i int) bool {
+				if tt.burst > 0 && i%200 >= 100 && i%200 < 100+tt.burst {
+					return true
+				}
+				return r.Float64() < tt.lossRate
+			}
+			rtxLost := func() bool {
+				return r.Float64() < tt.rtxLossRate
+			}
+			lostCount, recovered, kf := simulateNACKs(tt.startSN, 2000, tt.rtt, lost, rtxLost)
+			assert.NotZero(t, lostCount)
+			assert.GreaterOrEqual(t, float64(recovered)/float64(lostCount), tt.wantRecovery)
+			assert.Equal(t, tt.wantKeyframe, kf)
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package buffer
 
-import "io"
+import (
+	"io"
+	"sync/atomic"
+)
 
 type RTCPReader struct {
 	ssrc     uint32
-	closed   bool
+	closed   uint32
 	onPacket func([]byte)
 	onClose  func()
 }
@@ -14,7 +17,7 @@ func NewRTCPReader(ssrc uint32) *RTCPReader {
 }
 
 func (r *RTCPReader) Write(p []byte) (n int, err error) {
-	if r.closed {
+	if atomic.LoadUint32(&r.closed) == 1 {
 		err = io.EOF
 		return
 	}
@@ -29,7 +32,9 @@ func (r *RTCPReader) OnClose(fn func()) {
 }
 
 func (r *RTCPReader) Close() error {
-	r.closed = true
+	if !atomic.CompareAndSwapUint32(&r.closed, 0, 1) {
+		return nil
+	}
 	r.onClose()
 	return nil
 }
@@ -0,0 +1,9 @@
+package registry
+
+import "errors"
+
+var (
+	errUnknownRegistry = errors.New("unknown registry type")
+	errNotOwner        = errors.New("session is owned by another node")
+	errRedisReply      = errors.New("unexpected redis reply")
+)
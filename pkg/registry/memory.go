@@ -0,0 +1,60 @@
+package registry
+
+import "sync"
+
+// Memory is a process local Registry, suitable for a single node
+type Memory struct {
+	sync.RWMutex
+	owners map[string]string
+}
+
+// NewMemory creates a new in memory registry
+func NewMemory() *Memory {
+	return &Memory{
+		owners: make(map[string]string),
+	}
+}
+
+// Claim sets node as the owner of the session if it has none
+func (m *Memory) Claim(sid, node string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	if owner, ok := m.owners[sid]; ok {
+		return owner, nil
+	}
+	m.owners[sid] = node
+	return node, nil
+}
+
+// Lookup returns the node owning the session, empty if none
+func (m *Memory) Lookup(sid string) (string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.owners[sid], nil
+}
+
+// Refresh checks the node still owns the session, claims don't expire
+// in memory
+func (m *Memory) Refresh(sid, node string) error {
+	m.RLock()
+	defer m.RUnlock()
+	if m.owners[sid] != node {
+		return errNotOwner
+	}
+	return nil
+}
+
+// Release removes the session if the node owns it
+func (m *Memory) Release(sid, node string) error {
+	m.Lock()
+	defer m.Unlock()
+	if owner, ok := m.owners[sid]; ok && owner == node {
+		delete(m.owners, sid)
+	}
+	return nil
+}
+
+// Close does nothing, the memory registry holds no resources
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,228 @@
+package registry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisKeyPrefix   = "ion-sfu:session:"
+	redisDialTimeout = 3 * time.Second
+	redisIOTimeout   = 3 * time.Second
+
+	// redisRefreshScript extends the claim of KEYS[1] by ARGV[2] ms if it
+	// is owned by ARGV[1]
+	redisRefreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`
+	// redisReleaseScript deletes the claim of KEYS[1] if it is owned by ARGV[1]
+	redisReleaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+)
+
+// Redis is a Registry backed by any server speaking the redis protocol,
+// it allows several nodes to share session ownership.
+type Redis struct {
+	sync.Mutex
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedis creates a new redis registry, the connection is established
+// lazily and re-established after any network error.
+func NewRedis(addr, password string, db int, ttl time.Duration) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		ttl:      ttl,
+	}
+}
+
+// Claim sets node as the owner of the session if it has none, the claim
+// expires after the ttl unless refreshed
+func (r *Redis) Claim(sid, node string) (string, error) {
+	ttl := strconv.FormatInt(r.ttl.Milliseconds(), 10)
+	reply, err := r.do("SET", redisKeyPrefix+sid, node, "NX", "PX", ttl)
+	if err != nil {
+		return "", err
+	}
+	if reply != nil {
+		return node, nil
+	}
+	return r.Lookup(sid)
+}
+
+// Lookup returns the node owning the session, empty if none
+func (r *Redis) Lookup(sid string) (string, error) {
+	reply, err := r.do("GET", redisKeyPrefix+sid)
+	if err != nil || reply == nil {
+		return "", err
+	}
+	owner, ok := reply.(string)
+	if !ok {
+		return "", errRedisReply
+	}
+	return owner, nil
+}
+
+// Refresh extends the claim if the node owns the session, or claims the
+// session again if its claim expired and no other node claimed it.
+func (r *Redis) Refresh(sid, node string) error {
+	ttl := strconv.FormatInt(r.ttl.Milliseconds(), 10)
+	reply, err := r.do("EVAL", redisRefreshScript, "1", redisKeyPrefix+sid, node, ttl)
+	if err != nil {
+		return err
+	}
+	if reply == int64(1) {
+		return nil
+	}
+	reply, err = r.do("SET", redisKeyPrefix+sid, node, "NX", "PX", ttl)
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return errNotOwner
+	}
+	return nil
+}
+
+// Release removes the session claim if the node owns it
+func (r *Redis) Release(sid, node string) error {
+	_, err := r.do("EVAL", redisReleaseScript, "1", redisKeyPrefix+sid, node)
+	return err
+}
+
+// Close the connection to the redis server
+func (r *Redis) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+func (r *Redis) do(args ...string) (interface{}, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := r.roundTrip(args...)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			_ = r.conn.Close()
+			r.conn = nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (r *Redis) connect() error {
+	conn, err := net.DialTimeout("tcp", r.addr, redisDialTimeout)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.rd = bufio.NewReader(conn)
+
+	if r.password != "" {
+		if _, err := r.roundTrip("AUTH", r.password); err != nil {
+			_ = conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+	if r.db != 0 {
+		if _, err := r.roundTrip("SELECT", strconv.Itoa(r.db)); err != nil {
+			_ = conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Redis) roundTrip(args ...string) (interface{}, error) {
+	if err := r.conn.SetDeadline(time.Now().Add(redisIOTimeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := r.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(r.rd)
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// readReply parses a RESP reply, nil bulk strings and arrays are
+// returned as nil.
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errRedisReply
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%w: %q", errRedisReply, kind)
+}
@@ -0,0 +1,53 @@
+// Package registry records which SFU node owns each session, so every
+// peer of a session can be routed to the same node in a cluster.
+package registry
+
+import "time"
+
+// Registry records the node owning each session
+type Registry interface {
+	// Claim sets node as the owner of the session if it has no owner
+	// yet, and returns the current owner of the session.
+	Claim(sid, node string) (string, error)
+	// Lookup returns the node owning the session, empty if none.
+	Lookup(sid string) (string, error)
+	// Refresh extends the node ownership over the session.
+	Refresh(sid, node string) error
+	// Release removes the node ownership over the session.
+	Release(sid, node string) error
+	// Close releases the resources of the registry.
+	Close() error
+}
+
+// Config defines the session registry parameters
+type Config struct {
+	// Type of registry, "memory" or "redis"
+	Type     string `mapstructure:"type"`
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// TTL of a session claim in seconds, claims are refreshed while
+	// the session is alive.
+	TTL int `mapstructure:"ttl"`
+}
+
+const defaultTTL = 30 * time.Second
+
+// New creates a registry from its configuration
+func New(c Config) (Registry, error) {
+	switch c.Type {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(c.Addr, c.Password, c.DB, c.ClaimTTL()), nil
+	}
+	return nil, errUnknownRegistry
+}
+
+// ClaimTTL returns the duration of a session claim
+func (c Config) ClaimTTL() time.Duration {
+	if c.TTL <= 0 {
+		return defaultTTL
+	}
+	return time.Duration(c.TTL) * time.Second
+}
@@ -0,0 +1,259 @@
+package registry
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is a minimal stand-in for a redis server, it implements the
+// subset of commands used by the Redis registry.
+type fakeRedis struct {
+	sync.Mutex
+	ln      net.Listener
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	f := &fakeRedis{
+		ln:      ln,
+		values:  make(map[string]string),
+		expires: make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+		if _, err := conn.Write([]byte(f.exec(args))); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.Lock()
+	defer f.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		if exp, ok := f.expires[args[1]]; ok && time.Now().After(exp) {
+			delete(f.values, args[1])
+		}
+		v, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case "SET":
+		key, val := args[1], args[2]
+		if exp, ok := f.expires[key]; ok && time.Now().After(exp) {
+			delete(f.values, key)
+		}
+		_, exists := f.values[key]
+		var ttl time.Duration
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if exists {
+					return "$-1\r\n"
+				}
+			case "XX":
+				if !exists {
+					return "$-1\r\n"
+				}
+			case "PX":
+				i++
+				ms, _ := strconv.Atoi(args[i])
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+		}
+		f.values[key] = val
+		delete(f.expires, key)
+		if ttl > 0 {
+			f.expires[key] = time.Now().Add(ttl)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := f.values[args[1]]
+		delete(f.values, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "EVAL":
+		// Only the scripts of the registry are supported
+		key, node := args[3], args[4]
+		if exp, ok := f.expires[key]; ok && time.Now().After(exp) {
+			delete(f.values, key)
+		}
+		if f.values[key] != node {
+			return ":0\r\n"
+		}
+		switch args[1] {
+		case redisRefreshScript:
+			ms, _ := strconv.Atoi(args[5])
+			f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		case redisReleaseScript:
+			delete(f.values, key)
+			delete(f.expires, key)
+		default:
+			return "-ERR unknown script\r\n"
+		}
+		return ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func testRegistry(t *testing.T, r Registry) {
+	owner, err := r.Claim("session1", "node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+
+	owner, err = r.Claim("session1", "node2")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+
+	owner, err = r.Lookup("session1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+
+	assert.NoError(t, r.Refresh("session1", "node1"))
+	assert.Error(t, r.Refresh("session1", "node2"))
+
+	// Only the owner can release a session
+	assert.NoError(t, r.Release("session1", "node2"))
+	owner, err = r.Lookup("session1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+
+	assert.NoError(t, r.Release("session1", "node1"))
+	owner, err = r.Lookup("session1")
+	assert.NoError(t, err)
+	assert.Empty(t, owner)
+
+	owner, err = r.Claim("session1", "node2")
+	assert.NoError(t, err)
+	assert.Equal(t, "node2", owner)
+}
+
+func TestMemory(t *testing.T) {
+	testRegistry(t, NewMemory())
+}
+
+func TestRedis(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.ln.Close()
+
+	r := NewRedis(f.ln.Addr().String(), "secret", 1, time.Minute)
+	defer r.Close()
+	testRegistry(t, r)
+}
+
+func TestRedis_ClaimExpires(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.ln.Close()
+
+	r := NewRedis(f.ln.Addr().String(), "", 0, 50*time.Millisecond)
+	defer r.Close()
+
+	owner, err := r.Claim("session1", "node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+
+	time.Sleep(100 * time.Millisecond)
+
+	owner, err = r.Claim("session1", "node2")
+	assert.NoError(t, err)
+	assert.Equal(t, "node2", owner)
+}
+
+func TestRedis_RefreshExpired(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.ln.Close()
+
+	r := NewRedis(f.ln.Addr().String(), "", 0, 50*time.Millisecond)
+	defer r.Close()
+
+	_, err := r.Claim("session1", "node1")
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	// An expired claim is claimed again by its node
+	assert.NoError(t, r.Refresh("session1", "node1"))
+	owner, err := r.Lookup("session1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+
+	// but not taken over from the node that claimed it meanwhile
+	time.Sleep(100 * time.Millisecond)
+	_, err = r.Claim("session1", "node2")
+	assert.NoError(t, err)
+	assert.Equal(t, errNotOwner, r.Refresh("session1", "node1"))
+	owner, err = r.Lookup("session1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node2", owner)
+}
+
+func TestRedis_Reconnect(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.ln.Close()
+
+	r := NewRedis(f.ln.Addr().String(), "", 0, time.Minute)
+	defer r.Close()
+
+	_, err := r.Claim("session1", "node1")
+	assert.NoError(t, err)
+
+	// Drop the connection, the next command must reconnect
+	r.Lock()
+	r.conn.Close()
+	r.Unlock()
+	_, _ = r.Lookup("session1")
+
+	owner, err := r.Lookup("session1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", owner)
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, &Memory{}, r)
+
+	r, err = New(Config{Type: "redis", Addr: "127.0.0.1:6379"})
+	assert.NoError(t, err)
+	assert.IsType(t, &Redis{}, r)
+
+	_, err = New(Config{Type: "etcd"})
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package sfu
 
 import (
 	"encoding/json"
+	"sync"
 
 	log "github.com/pion/ion-log"
 	"github.com/pion/webrtc/v3"
@@ -9,6 +10,8 @@ import (
 
 const (
 	apiChannelLabel = "ion-sfu"
+	// apiVersion is the version of the typed commands of the api channel
+	apiVersion = 1
 
 	videoHighQuality   = "high"
 	videoMediumQuality = "medium"
@@ -16,40 +19,381 @@ const (
 	videoMuted         = "none"
 )
 
-type setRemoteMedia struct {
+// Methods of the typed commands of the ion-sfu data channel
+const (
+	APISetLayer         = "setLayer"
+	APISetTemporalLayer = "setTemporalLayer"
+	APIPause            = "pause"
+	APIResume           = "resume"
+	APIGetStats         = "getStats"
+	APISubscribe        = "subscribe"
+	APIUnsubscribe      = "unsubscribe"
+)
+
+// Events pushed by the sfu on the ion-sfu data channel
+const (
+	// APIEventLayerSwitched is sent with APILayerParams once a simulcast
+	// layer switch is done
+	APIEventLayerSwitched = "layerSwitched"
+	// APIEventTrackMuted is sent with APITrack when a moderator mutes a track
+	APIEventTrackMuted = "trackMuted"
+	// APIEventTrackUnmuted is sent with APITrack when a moderator unmutes a track
+	APIEventTrackUnmuted = "trackUnmuted"
+)
+
+// Error codes of the api responses
+const (
+	APIErrBadRequest = 400
+	APIErrNotFound   = 404
+	APIErrConflict   = 409
+)
+
+// APIRequest is a command sent on the ion-sfu data channel, the sfu
+// replies with an APIResponse with the same id.
+type APIRequest struct {
+	Version int             `json:"v"`
+	ID      string          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// APIResponse replies to an APIRequest, with a result or an error
+type APIResponse struct {
+	Version int         `json:"v"`
+	ID      string      `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *APIError   `json:"error,omitempty"`
+}
+
+// APIError is the error of a failed command
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIEvent is pushed by the sfu on the ion-sfu data channel
+type APIEvent struct {
+	Version int         `json:"v"`
+	Event   string      `json:"event"`
+	Data    interface{} `json:"data"`
+}
+
+// APITrack selects the subscribed tracks of a stream, every track of the
+// stream when TrackID is empty. Params of pause and resume.
+type APITrack struct {
+	StreamID string `json:"streamId"`
+	TrackID  string `json:"trackId,omitempty"`
+}
+
+// APILayerParams are the params of setLayer and setTemporalLayer
+type APILayerParams struct {
+	APITrack
+	Layer int `json:"layer"`
+}
+
+// APILayerResult is the result of setLayer, Pending is true when a switch
+// waits for a probe of the subscriber bandwidth, no layerSwitched event is
+// sent if the probe fails. Tracks has the result of each track, a track
+// failing to switch doesn't undo the switches of the other ones.
+type APILayerResult struct {
+	Pending bool                  `json:"pending"`
+	Tracks  []APILayerTrackResult `json:"tracks"`
+}
+
+// APILayerTrackResult is the setLayer result of a track
+type APILayerTrackResult struct {
+	TrackID string    `json:"trackId"`
+	Pending bool      `json:"pending"`
+	Error   *APIError `json:"error,omitempty"`
+}
+
+// APIPeerParams are the params of subscribe and unsubscribe
+type APIPeerParams struct {
+	PeerID string `json:"peerId"`
+}
+
+// APITrackStats is the result of getStats for each subscribed track,
+// getStats takes optional APITrack params to select the tracks.
+type APITrackStats struct {
 	StreamID string `json:"streamId"`
-	Video    string `json:"video"`
-	Audio    bool   `json:"audio"`
+	TrackID  string `json:"trackId"`
+	Kind     string `json:"kind"`
+	MimeType string `json:"mimeType"`
+	// Paused is true if paused by the subscriber, Muted if muted by a moderator
+	Paused bool `json:"paused"`
+	Muted  bool `json:"muted"`
+	// Layer is the simulcast layer forwarded, TargetLayer differs while
+	// switching, Layers is the number of layers published
+	Layer         int `json:"layer"`
+	TargetLayer   int `json:"targetLayer"`
+	Layers        int `json:"layers"`
+	TemporalLayer int `json:"temporalLayer"`
+	// Packets and Bytes sent, Bitrate of the forwarded layer in bps
+	Packets uint32 `json:"packets"`
+	Bytes   uint32 `json:"bytes"`
+	Bitrate uint64 `json:"bitrate"`
+}
+
+type setRemoteMedia struct {
+	StreamID  string `json:"streamId"`
+	Video     string `json:"video"`
+	FrameRate string `json:"framerate,omitempty"`
+	Audio     bool   `json:"audio"`
 }
 
-func handleAPICommand(s *Subscriber, dc *webrtc.DataChannel) {
+// apiChannel serves the commands of the ion-sfu data channel of a subscriber
+type apiChannel struct {
+	sync.Mutex
+	sub  *Subscriber
+	send func(data []byte) error
+	// subscribe subscribes to or unsubscribes from the tracks of a peer,
+	// set once the peer joined a session
+	subscribe func(pid string, subscribe bool) error
+}
+
+func newAPIChannel(s *Subscriber, dc *webrtc.DataChannel) *apiChannel {
+	a := &apiChannel{
+		sub: s,
+		send: func(data []byte) error {
+			if dc.ReadyState() != webrtc.DataChannelStateOpen {
+				return nil
+			}
+			return dc.SendText(string(data))
+		},
+	}
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		srm := &setRemoteMedia{}
-		if err := json.Unmarshal(msg.Data, srm); err != nil {
-			log.Errorf("Unmarshal api command err: %v", err)
-			return
-		}
-		downTracks := s.GetDownTracks(srm.StreamID)
-
-		for _, dt := range downTracks {
-			switch dt.Kind() {
-			case webrtc.RTPCodecTypeAudio:
-				dt.Mute(!srm.Audio)
-			case webrtc.RTPCodecTypeVideo:
-				switch srm.Video {
-				case videoHighQuality:
-					dt.Mute(false)
-					dt.SwitchSpatialLayer(2)
-				case videoMediumQuality:
-					dt.Mute(false)
-					dt.SwitchSpatialLayer(1)
-				case videoLowQuality:
-					dt.Mute(false)
-					dt.SwitchSpatialLayer(0)
-				case videoMuted:
-					dt.Mute(true)
-				}
+		a.onMessage(msg.Data)
+	})
+	return a
+}
+
+func (a *apiChannel) onSubscribe(fn func(pid string, subscribe bool) error) {
+	a.Lock()
+	a.subscribe = fn
+	a.Unlock()
+}
+
+func (a *apiChannel) onMessage(data []byte) {
+	var req APIRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Errorf("Unmarshal api command err: %v", err)
+		return
+	}
+	// Commands without method are the untyped commands of the first api
+	if req.Method == "" {
+		a.setRemoteMedia(data)
+		return
+	}
+	a.write(a.handle(req))
+}
+
+// handle runs a typed command and returns its response
+func (a *apiChannel) handle(req APIRequest) APIResponse {
+	res := APIResponse{Version: apiVersion, ID: req.ID}
+	if req.Version != apiVersion {
+		res.Error = &APIError{Code: APIErrBadRequest, Message: errAPIVersion.Error()}
+		return res
+	}
+	result, err := a.call(req.Method, req.Params)
+	if err != nil {
+		res.Error = &APIError{Code: apiErrorCode(err), Message: err.Error()}
+		return res
+	}
+	res.Result = result
+	return res
+}
+
+func (a *apiChannel) call(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case APISetLayer, APISetTemporalLayer:
+		var p APILayerParams
+		if err := unmarshalAPIParams(params, &p); err != nil {
+			return nil, err
+		}
+		if method == APISetLayer {
+			return a.setLayer(p)
+		}
+		return nil, a.setTemporalLayer(p)
+	case APIPause, APIResume:
+		var p APITrack
+		if err := unmarshalAPIParams(params, &p); err != nil {
+			return nil, err
+		}
+		dts := a.sub.selectDownTracks(p)
+		if len(dts) == 0 {
+			return nil, errNoTrackFound
+		}
+		for _, dt := range dts {
+			dt.Mute(method == APIPause)
+		}
+		return nil, nil
+	case APIGetStats:
+		var p APITrack
+		if len(params) > 0 {
+			if err := unmarshalAPIParams(params, &p); err != nil {
+				return nil, err
 			}
 		}
-	})
+		stats := []APITrackStats{}
+		for _, dt := range a.sub.selectDownTracks(p) {
+			stats = append(stats, dt.apiStats())
+		}
+		return stats, nil
+	case APISubscribe, APIUnsubscribe:
+		var p APIPeerParams
+		if err := unmarshalAPIParams(params, &p); err != nil {
+			return nil, err
+		}
+		a.Lock()
+		subscribe := a.subscribe
+		a.Unlock()
+		if subscribe == nil {
+			return nil, errNoPublisherFound
+		}
+		return nil, subscribe(p.PeerID, method == APISubscribe)
+	}
+	return nil, errAPIUnknownMethod
+}
+
+func (a *apiChannel) setLayer(p APILayerParams) (*APILayerResult, error) {
+	var dts []*DownTrack
+	for _, dt := range a.sub.selectDownTracks(p.APITrack) {
+		if dt.Kind() == webrtc.RTPCodecTypeVideo {
+			dts = append(dts, dt)
+		}
+	}
+	if len(dts) == 0 {
+		return nil, errNoTrackFound
+	}
+	for _, dt := range dts {
+		if dt.trackType != SimulcastDownTrack {
+			return nil, errNotSimulcast
+		}
+		if p.Layer < 0 || p.Layer >= dt.receiver.Layers() {
+			return nil, errLayerNotFound
+		}
+		if layer, ok := dt.receiver.ForcedLayer(); ok && layer != p.Layer {
+			return nil, errLayerForced
+		}
+		if current, target := dt.spatialLayers(); current != target {
+			return nil, errLayerSwitching
+		}
+	}
+	// A switch can still fail if the track changed since it was checked,
+	// the error is reported with the track and only fails the request when
+	// no track switched.
+	res := &APILayerResult{}
+	var firstErr error
+	failed := 0
+	for _, dt := range dts {
+		pending, err := dt.requestSpatialLayer(p.Layer)
+		track := APILayerTrackResult{TrackID: dt.id, Pending: pending}
+		if err != nil {
+			track.Error = &APIError{Code: apiErrorCode(err), Message: err.Error()}
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+		res.Pending = res.Pending || pending
+		res.Tracks = append(res.Tracks, track)
+	}
+	if failed == len(dts) {
+		return nil, firstErr
+	}
+	return res, nil
+}
+
+func (a *apiChannel) setTemporalLayer(p APILayerParams) error {
+	var dts []*DownTrack
+	for _, dt := range a.sub.selectDownTracks(p.APITrack) {
+		if dt.Kind() == webrtc.RTPCodecTypeVideo {
+			dts = append(dts, dt)
+		}
+	}
+	if len(dts) == 0 {
+		return errNoTrackFound
+	}
+	for _, dt := range dts {
+		if !dt.simulcast.temporalEnabled {
+			return errTemporalLayersDisabled
+		}
+	}
+	for _, dt := range dts {
+		dt.SwitchTemporalLayer(p.Layer)
+	}
+	return nil
+}
+
+// event pushes an event to the subscriber
+func (a *apiChannel) event(event string, data interface{}) {
+	a.write(APIEvent{Version: apiVersion, Event: event, Data: data})
+}
+
+func (a *apiChannel) write(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("Marshal api message err: %v", err)
+		return
+	}
+	if err := a.send(data); err != nil {
+		log.Errorf("Sending api message err: %v", err)
+	}
+}
+
+func unmarshalAPIParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return errAPIBadParams
+	}
+	return nil
+}
+
+func apiErrorCode(err error) int {
+	switch err {
+	case errNoTrackFound, errNoPublisherFound, errLayerNotFound:
+		return APIErrNotFound
+	case errLayerForced, errLayerSwitching:
+		return APIErrConflict
+	}
+	return APIErrBadRequest
+}
+
+// setRemoteMedia applies the untyped command of the first api, it isn't
+// replied to.
+func (a *apiChannel) setRemoteMedia(data []byte) {
+	srm := &setRemoteMedia{}
+	if err := json.Unmarshal(data, srm); err != nil {
+		log.Errorf("Unmarshal api command err: %v", err)
+		return
+	}
+	downTracks := a.sub.GetDownTracks(srm.StreamID)
+
+	for _, dt := range downTracks {
+		switch dt.Kind() {
+		case webrtc.RTPCodecTypeAudio:
+			dt.Mute(!srm.Audio)
+		case webrtc.RTPCodecTypeVideo:
+			switch srm.Video {
+			case videoHighQuality:
+				dt.Mute(false)
+				dt.SwitchSpatialLayer(dt.receiver.Layers() - 1)
+			case videoMediumQuality:
+				dt.Mute(false)
+				dt.SwitchSpatialLayer((dt.receiver.Layers() - 1) / 2)
+			case videoLowQuality:
+				dt.Mute(false)
+				dt.SwitchSpatialLayer(0)
+			case videoMuted:
+				dt.Mute(true)
+			}
+			switch srm.FrameRate {
+			case videoHighQuality:
+				dt.SwitchTemporalLayer(maxTemporalLayer)
+			case videoMediumQuality:
+				dt.SwitchTemporalLayer(1)
+			case videoLowQuality:
+				dt.SwitchTemporalLayer(0)
+			}
+		}
+	}
 }
@@ -0,0 +1,288 @@
+package sfu
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type apiFixture struct {
+	api   *apiChannel
+	recv  *WebRTCReceiver
+	video *DownTrack
+	audio *DownTrack
+	sent  [][]byte
+}
+
+func newAPIFixture() *apiFixture {
+	f := &apiFixture{}
+	f.recv = &WebRTCReceiver{
+		isSimulcast: true,
+		upTracks:    []*webrtc.TrackRemote{{}, {}, {}},
+		buffers:     make([]*buffer.Buffer, 3),
+		caches:      make([]*keyframeCache, 3),
+		downTracks:  [][]*DownTrack{{}, {}, {}},
+	}
+	sub := &Subscriber{id: "sub", tracks: make(map[string][]*DownTrack)}
+	f.api = &apiChannel{sub: sub, send: func(data []byte) error {
+		f.sent = append(f.sent, data)
+		return nil
+	}}
+	sub.api = f.api
+
+	f.video = &DownTrack{
+		id:                  "video",
+		peerID:              "sub",
+		streamID:            "stream",
+		codec:               webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8},
+		receiver:            f.recv,
+		api:                 f.api,
+		trackType:           SimulcastDownTrack,
+		currentSpatialLayer: 2,
+	}
+	f.video.simulcast.targetSpatialLayer = 2
+	f.video.simulcast.targetTempLayer = maxTemporalLayer
+	f.video.enabled.set(true)
+	f.recv.downTracks[2] = []*DownTrack{f.video}
+
+	f.audio = &DownTrack{
+		id:        "audio",
+		peerID:    "sub",
+		streamID:  "stream",
+		codec:     webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
+		receiver:  &WebRTCReceiver{},
+		api:       f.api,
+		trackType: SimpleDownTrack,
+	}
+	f.audio.enabled.set(true)
+	sub.tracks["stream"] = []*DownTrack{f.video, f.audio}
+	return f
+}
+
+func TestAPIChannel_handle(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(f *apiFixture)
+		req   string
+		want  APIResponse
+		check func(t *testing.T, f *apiFixture)
+	}{
+		{
+			name: "Must reject unsupported versions",
+			req:  `{"v":2,"id":"1","method":"pause","params":{"streamId":"stream"}}`,
+			want: APIResponse{Version: 1, ID: "1", Error: &APIError{Code: APIErrBadRequest, Message: errAPIVersion.Error()}},
+		},
+		{
+			name: "Must reject unknown methods",
+			req:  `{"v":1,"id":"2","method":"record"}`,
+			want: APIResponse{Version: 1, ID: "2", Error: &APIError{Code: APIErrBadRequest, Message: errAPIUnknownMethod.Error()}},
+		},
+		{
+			name: "Must reject invalid params",
+			req:  `{"v":1,"id":"3","method":"setLayer","params":{"layer":"high"}}`,
+			want: APIResponse{Version: 1, ID: "3", Error: &APIError{Code: APIErrBadRequest, Message: errAPIBadParams.Error()}},
+		},
+		{
+			name: "Must switch the simulcast layer",
+			req:  `{"v":1,"id":"4","method":"setLayer","params":{"streamId":"stream","layer":0}}`,
+			want: APIResponse{Version: 1, ID: "4", Result: &APILayerResult{Tracks: []APILayerTrackResult{{TrackID: "video"}}}},
+			check: func(t *testing.T, f *apiFixture) {
+				assert.Equal(t, 0, f.video.simulcast.targetSpatialLayer)
+				assert.Len(t, f.recv.downTracks[0], 1)
+			},
+		},
+		{
+			name: "Must not switch to a layer not published",
+			req:  `{"v":1,"id":"5","method":"setLayer","params":{"streamId":"stream","layer":3}}`,
+			want: APIResponse{Version: 1, ID: "5", Error: &APIError{Code: APIErrNotFound, Message: errLayerNotFound.Error()}},
+		},
+		{
+			name: "Must not switch away from a forced layer",
+			setup: func(f *apiFixture) {
+				f.recv.forced, f.recv.forcedLayer = true, 2
+			},
+			req:  `{"v":1,"id":"6","method":"setLayer","params":{"streamId":"stream","layer":1}}`,
+			want: APIResponse{Version: 1, ID: "6", Error: &APIError{Code: APIErrConflict, Message: errLayerForced.Error()}},
+		},
+		{
+			name: "Must not switch while a previous switch is in progress",
+			setup: func(f *apiFixture) {
+				f.video.simulcast.targetSpatialLayer = 1
+			},
+			req:  `{"v":1,"id":"15","method":"setLayer","params":{"streamId":"stream","layer":0}}`,
+			want: APIResponse{Version: 1, ID: "15", Error: &APIError{Code: APIErrConflict, Message: errLayerSwitching.Error()}},
+		},
+		{
+			name: "Must report a switch waiting for a probe as pending",
+			setup: func(f *apiFixture) {
+				f.video.probe = newProber(ProbeConfig{Enabled: true, MaxBitrate: 800})
+				f.video.setSpatialLayer(0)
+				f.recv.downTracks[0], f.recv.downTracks[2] = f.recv.downTracks[2], nil
+			},
+			req:  `{"v":1,"id":"16","method":"setLayer","params":{"streamId":"stream","layer":2}}`,
+			want: APIResponse{Version: 1, ID: "16", Result: &APILayerResult{Pending: true, Tracks: []APILayerTrackResult{{TrackID: "video", Pending: true}}}},
+			check: func(t *testing.T, f *apiFixture) {
+				current, target := f.video.spatialLayers()
+				assert.Equal(t, 0, current)
+				assert.Equal(t, 0, target)
+			},
+		},
+		{
+			name: "Must report the tracks failing to switch",
+			setup: func(f *apiFixture) {
+				recv := &WebRTCReceiver{
+					isSimulcast: true,
+					upTracks:    []*webrtc.TrackRemote{{}, {}, {}},
+					downTracks:  [][]*DownTrack{{}, {}, {}},
+					stopped:     true,
+				}
+				screen := &DownTrack{
+					id:                  "screen",
+					peerID:              "sub",
+					streamID:            "stream",
+					codec:               webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8},
+					receiver:            recv,
+					trackType:           SimulcastDownTrack,
+					currentSpatialLayer: 2,
+				}
+				screen.simulcast.targetSpatialLayer = 2
+				f.api.sub.tracks["stream"] = append(f.api.sub.tracks["stream"], screen)
+			},
+			req: `{"v":1,"id":"17","method":"setLayer","params":{"streamId":"stream","layer":0}}`,
+			want: APIResponse{Version: 1, ID: "17", Result: &APILayerResult{Tracks: []APILayerTrackResult{
+				{TrackID: "video"},
+				{TrackID: "screen", Error: &APIError{Code: APIErrBadRequest, Message: errNoReceiverFound.Error()}},
+			}}},
+			check: func(t *testing.T, f *apiFixture) {
+				assert.Equal(t, 0, f.video.simulcast.targetSpatialLayer)
+			},
+		},
+		{
+			name: "Must not find unknown streams",
+			req:  `{"v":1,"id":"7","method":"setLayer","params":{"streamId":"other","layer":1}}`,
+			want: APIResponse{Version: 1, ID: "7", Error: &APIError{Code: APIErrNotFound, Message: errNoTrackFound.Error()}},
+		},
+		{
+			name: "Must not set temporal layers when disabled",
+			req:  `{"v":1,"id":"8","method":"setTemporalLayer","params":{"streamId":"stream","layer":0}}`,
+			want: APIResponse{Version: 1, ID: "8", Error: &APIError{Code: APIErrBadRequest, Message: errTemporalLayersDisabled.Error()}},
+		},
+		{
+			name: "Must set the temporal layer",
+			setup: func(f *apiFixture) {
+				f.video.simulcast.temporalEnabled = true
+			},
+			req:  `{"v":1,"id":"9","method":"setTemporalLayer","params":{"streamId":"stream","trackId":"video","layer":0}}`,
+			want: APIResponse{Version: 1, ID: "9"},
+			check: func(t *testing.T, f *apiFixture) {
+				assert.Equal(t, int32(0), f.video.simulcast.targetTempLayer)
+			},
+		},
+		{
+			name: "Must pause a single track",
+			req:  `{"v":1,"id":"10","method":"pause","params":{"streamId":"stream","trackId":"audio"}}`,
+			want: APIResponse{Version: 1, ID: "10"},
+			check: func(t *testing.T, f *apiFixture) {
+				assert.False(t, f.audio.enabled.get())
+				assert.True(t, f.video.enabled.get())
+			},
+		},
+		{
+			name: "Must resume the tracks of a stream",
+			setup: func(f *apiFixture) {
+				f.audio.Mute(true)
+				f.video.Mute(true)
+			},
+			req:  `{"v":1,"id":"11","method":"resume","params":{"streamId":"stream"}}`,
+			want: APIResponse{Version: 1, ID: "11"},
+			check: func(t *testing.T, f *apiFixture) {
+				assert.True(t, f.audio.enabled.get())
+				assert.True(t, f.video.enabled.get())
+			},
+		},
+		{
+			name: "Must reply the stats of a track",
+			req:  `{"v":1,"id":"12","method":"getStats","params":{"trackId":"video"}}`,
+			want: APIResponse{Version: 1, ID: "12", Result: []APITrackStats{{
+				StreamID:      "stream",
+				TrackID:       "video",
+				Kind:          "video",
+				MimeType:      webrtc.MimeTypeVP8,
+				Layer:         2,
+				TargetLayer:   2,
+				Layers:        3,
+				TemporalLayer: maxTemporalLayer,
+			}}},
+		},
+		{
+			name: "Must not subscribe before joining",
+			req:  `{"v":1,"id":"13","method":"subscribe","params":{"peerId":"pub"}}`,
+			want: APIResponse{Version: 1, ID: "13", Error: &APIError{Code: APIErrNotFound, Message: errNoPublisherFound.Error()}},
+		},
+		{
+			name: "Must unsubscribe from a peer",
+			setup: func(f *apiFixture) {
+				f.api.onSubscribe(func(pid string, subscribe bool) error {
+					assert.Equal(t, "pub", pid)
+					assert.False(t, subscribe)
+					return nil
+				})
+			},
+			req:  `{"v":1,"id":"14","method":"unsubscribe","params":{"peerId":"pub"}}`,
+			want: APIResponse{Version: 1, ID: "14"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAPIFixture()
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+			var req APIRequest
+			assert.NoError(t, json.Unmarshal([]byte(tt.req), &req))
+			assert.Equal(t, tt.want, f.api.handle(req))
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func TestAPIChannel_onMessage(t *testing.T) {
+	f := newAPIFixture()
+
+	// Untyped commands of the first api aren't replied to
+	f.api.onMessage([]byte(`{"streamId":"stream","video":"none","audio":true}`))
+	assert.False(t, f.video.enabled.get())
+	assert.True(t, f.audio.enabled.get())
+	assert.Empty(t, f.sent)
+
+	f.api.onMessage([]byte(`{"v":1,"id":"1","method":"resume","params":{"streamId":"stream"}}`))
+	assert.True(t, f.video.enabled.get())
+	assert.Equal(t, []string{`{"v":1,"id":"1"}`}, sentStrings(f.sent))
+
+	// Moderator mutes are pushed to the subscribers
+	f.sent = nil
+	f.recv.Mute(true)
+	assert.Equal(t, []string{`{"v":1,"event":"trackMuted","data":{"streamId":"stream","trackId":"video"}}`}, sentStrings(f.sent))
+}
+
+func sentStrings(sent [][]byte) []string {
+	var s []string
+	for _, data := range sent {
+		s = append(s, string(data))
+	}
+	return s
+}
+
+func TestAPIChannel_setRemoteMedia(t *testing.T) {
+	f := newAPIFixture()
+	// Medium is the lower layer of two layers
+	f.recv.upTracks = f.recv.upTracks[:2]
+	f.api.onMessage([]byte(`{"streamId":"stream","video":"medium","audio":true}`))
+	assert.Equal(t, 0, f.video.simulcast.targetSpatialLayer)
+}
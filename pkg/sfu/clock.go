@@ -0,0 +1,47 @@
+package sfu
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	defaultVideoClockRate = 90000
+	defaultAudioClockRate = 48000
+)
+
+// rtpClock converts between durations and the RTP timestamp units of the
+// codec negotiated with a subscriber
+type rtpClock struct {
+	rate uint32
+}
+
+// newRTPClock returns the clock of a codec, with the usual rate of its kind
+// if the clock rate is unknown
+func newRTPClock(codec webrtc.RTPCodecCapability, kind webrtc.RTPCodecType) rtpClock {
+	switch {
+	case codec.ClockRate != 0:
+		return rtpClock{rate: codec.ClockRate}
+	case kind == webrtc.RTPCodecTypeAudio:
+		return rtpClock{rate: defaultAudioClockRate}
+	}
+	return rtpClock{rate: defaultVideoClockRate}
+}
+
+// ticks returns the timestamp units elapsed in d. Seconds and the remainder
+// are converted apart so long idle periods don't overflow, the result wraps
+// around as the RTP timestamps do.
+func (c rtpClock) ticks(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	seconds := uint64(d / time.Second)
+	rem := uint64(d % time.Second)
+	return uint32(seconds*uint64(c.rate) + rem*uint64(c.rate)/uint64(time.Second))
+}
+
+// duration returns the duration of a signed timestamp difference
+func (c rtpClock) duration(ticks int32) time.Duration {
+	return time.Duration(int64(ticks) * int64(time.Second) / int64(c.rate))
+}
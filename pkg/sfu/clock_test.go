@@ -0,0 +1,42 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rtpClock_ticks(t *testing.T) {
+	tests := []struct {
+		name string
+		rate uint32
+		d    time.Duration
+		want uint32
+	}{
+		{name: "Audio frame", rate: 48000, d: 20 * time.Millisecond, want: 960},
+		{name: "Video frame", rate: 90000, d: 33 * time.Millisecond, want: 2970},
+		{name: "Video second and a half", rate: 90000, d: 1500 * time.Millisecond, want: 135000},
+		{name: "Audio long idle wraps around", rate: 48000, d: 30 * time.Hour, want: uint32(uint64(30*3600) * 48000 % (1 << 32))},
+		{name: "Video long idle wraps around", rate: 90000, d: 30 * time.Hour, want: uint32(uint64(30*3600) * 90000 % (1 << 32))},
+		{name: "Negative duration", rate: 90000, d: -time.Second},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rtpClock{rate: tt.rate}.ticks(tt.d))
+		})
+	}
+}
+
+func Test_rtpClock_duration(t *testing.T) {
+	assert.Equal(t, 20*time.Millisecond, rtpClock{rate: 48000}.duration(960))
+	assert.Equal(t, -100*time.Millisecond, rtpClock{rate: 90000}.duration(-9000))
+}
+
+func Test_newRTPClock(t *testing.T) {
+	assert.Equal(t, uint32(8000), newRTPClock(webrtc.RTPCodecCapability{ClockRate: 8000}, webrtc.RTPCodecTypeAudio).rate)
+	assert.Equal(t, uint32(defaultAudioClockRate), newRTPClock(webrtc.RTPCodecCapability{}, webrtc.RTPCodecTypeAudio).rate)
+	assert.Equal(t, uint32(defaultVideoClockRate), newRTPClock(webrtc.RTPCodecCapability{}, webrtc.RTPCodecTypeVideo).rate)
+}
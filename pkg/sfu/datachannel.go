@@ -0,0 +1,117 @@
+package sfu
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Relay policies of the data channel labels
+const (
+	// DataChannelRelayBroadcast relays the messages of every peer to the
+	// other peers
+	DataChannelRelayBroadcast = "broadcast"
+	// DataChannelRelayPublisher only relays the messages of the peers that
+	// opened the label, the other peers can only receive
+	DataChannelRelayPublisher = "publisher"
+	// DataChannelRelayNone doesn't relay messages, only the messages sent
+	// with Session.SendMessage are delivered
+	DataChannelRelayNone = "none"
+)
+
+const (
+	// dataChannelAnyLabel configures the labels without their own config
+	dataChannelAnyLabel = "*"
+
+	// dropped data channel messages reasons
+	dropMessageSize    = "size"
+	dropMessageRate    = "rate"
+	dropMessageRelay   = "relay"
+	dropMessageInvalid = "invalid"
+)
+
+// DataChannelConfig is the relay policy of the data channels with a
+// label, "*" applies to the labels without their own config.
+type DataChannelConfig struct {
+	Label string `mapstructure:"label" json:"label"`
+	// Relay is broadcast, publisher or none, broadcast when empty
+	Relay string `mapstructure:"relay" json:"relay,omitempty"`
+	// Targeted messages are DataChannelMessage envelopes delivered to the
+	// peers in To, or to every peer when empty
+	Targeted bool `mapstructure:"targeted" json:"targeted,omitempty"`
+	// MaxMessageSize in bytes, zero means no limits
+	MaxMessageSize int `mapstructure:"maxmessagesize" json:"maxMessageSize,omitempty"`
+	// MaxMessageRate is the max messages per second relayed from a peer,
+	// zero means no limits
+	MaxMessageRate int `mapstructure:"maxmessagerate" json:"maxMessageRate,omitempty"`
+}
+
+func (c DataChannelConfig) validate() error {
+	switch c.Relay {
+	case "", DataChannelRelayBroadcast, DataChannelRelayPublisher, DataChannelRelayNone:
+		return nil
+	}
+	return errInvalidDataChannelRelay
+}
+
+// DataChannelMessage is the envelope of the messages of targeted labels,
+// peers send the Data with the peer ids it's addressed To and receive it
+// with the peer id it comes From.
+type DataChannelMessage struct {
+	From string          `json:"from,omitempty"`
+	To   []string        `json:"to,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// messageLimiter counts the messages relayed from each peer by label
+// within one second windows
+type messageLimiter struct {
+	sync.Mutex
+	windows map[string]map[string]*messageWindow
+}
+
+type messageWindow struct {
+	start int64
+	count int
+}
+
+func newMessageLimiter() *messageLimiter {
+	return &messageLimiter{
+		windows: make(map[string]map[string]*messageWindow),
+	}
+}
+
+// allow returns true if the peer sent less than max messages with the
+// label within the current window
+func (l *messageLimiter) allow(pid, label string, max int, now time.Time) bool {
+	if max <= 0 {
+		return true
+	}
+	l.Lock()
+	defer l.Unlock()
+	labels, ok := l.windows[pid]
+	if !ok {
+		labels = make(map[string]*messageWindow)
+		l.windows[pid] = labels
+	}
+	w, ok := labels[label]
+	if !ok {
+		w = &messageWindow{}
+		labels[label] = w
+	}
+	if ns := now.UnixNano(); ns-w.start >= int64(time.Second) {
+		w.start, w.count = ns, 0
+	}
+	if w.count >= max {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// remove forgets the windows of a peer leaving the session
+func (l *messageLimiter) remove(pid string) {
+	l.Lock()
+	delete(l.windows, pid)
+	l.Unlock()
+}
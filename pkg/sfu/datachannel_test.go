@@ -0,0 +1,128 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageLimiter(t *testing.T) {
+	l := newMessageLimiter()
+	now := time.Unix(100, 0)
+	assert.True(t, l.allow("p1", "chat", 2, now))
+	assert.True(t, l.allow("p1", "chat", 2, now.Add(100*time.Millisecond)))
+	assert.False(t, l.allow("p1", "chat", 2, now.Add(200*time.Millisecond)))
+	// Limits are counted by peer and label
+	assert.True(t, l.allow("p2", "chat", 2, now))
+	assert.True(t, l.allow("p1", "cursor", 2, now))
+	// A new window starts after a second
+	assert.True(t, l.allow("p1", "chat", 2, now.Add(time.Second)))
+	assert.True(t, l.allow("p1", "chat", 0, now.Add(time.Second)))
+
+	l.remove("p1")
+	assert.NotContains(t, l.windows, "p1")
+}
+
+func TestSession_dataChannelConfig(t *testing.T) {
+	s := NewSession("session")
+	assert.Equal(t, DataChannelConfig{Label: "chat"}, s.dataChannelConfig("chat"))
+
+	chat := DataChannelConfig{Label: "chat", Targeted: true}
+	any := DataChannelConfig{Label: "*", Relay: DataChannelRelayNone}
+	s.SetConfig(SessionConfig{DataChannels: []DataChannelConfig{any, chat}})
+	assert.Equal(t, chat, s.dataChannelConfig("chat"))
+	assert.Equal(t, any, s.dataChannelConfig("cursor"))
+}
+
+func TestSession_onMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DataChannelConfig
+		opened bool
+		msgs   []string
+		reason string
+		drops  int
+	}{
+		{
+			name:   "Must relay broadcast messages",
+			config: DataChannelConfig{Label: "chat"},
+			msgs:   []string{"hello"},
+		},
+		{
+			name:   "Must not relay on labels without relay",
+			config: DataChannelConfig{Label: "chat", Relay: DataChannelRelayNone},
+			opened: true,
+			msgs:   []string{"hello"},
+			reason: dropMessageRelay,
+			drops:  1,
+		},
+		{
+			name:   "Must only relay the peers that opened publisher labels",
+			config: DataChannelConfig{Label: "chat", Relay: DataChannelRelayPublisher},
+			msgs:   []string{"hello"},
+			reason: dropMessageRelay,
+			drops:  1,
+		},
+		{
+			name:   "Must relay publisher labels from the peers that opened them",
+			config: DataChannelConfig{Label: "chat", Relay: DataChannelRelayPublisher},
+			opened: true,
+			msgs:   []string{"hello"},
+		},
+		{
+			name:   "Must drop messages too large",
+			config: DataChannelConfig{Label: "chat", MaxMessageSize: 4},
+			msgs:   []string{"hey", "hello"},
+			reason: dropMessageSize,
+			drops:  1,
+		},
+		{
+			name:   "Must drop messages above the rate",
+			config: DataChannelConfig{Label: "chat", MaxMessageRate: 2},
+			msgs:   []string{"1", "2", "3", "4"},
+			reason: dropMessageRate,
+			drops:  2,
+		},
+		{
+			name:   "Must drop invalid targeted messages",
+			config: DataChannelConfig{Label: "chat", Targeted: true},
+			msgs:   []string{`{"to":["p2"],"data":"hello"}`, "hello"},
+			reason: dropMessageInvalid,
+			drops:  1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("session")
+			s.SetConfig(SessionConfig{DataChannels: []DataChannelConfig{tt.config}})
+			assert.NoError(t, s.AddPeer(&Peer{id: "p1"}))
+			assert.NoError(t, s.AddPeer(&Peer{id: "p2"}))
+
+			counters := map[string]float64{}
+			for _, reason := range []string{dropMessageRelay, dropMessageSize, dropMessageRate, dropMessageInvalid} {
+				counters[reason] = testutil.ToFloat64(droppedMessages.WithLabelValues(reason))
+			}
+			for _, msg := range tt.msgs {
+				s.onMessage("p1", "chat", tt.opened, webrtc.DataChannelMessage{IsString: true, Data: []byte(msg)})
+			}
+			for reason, before := range counters {
+				want := 0
+				if reason == tt.reason {
+					want = tt.drops
+				}
+				assert.Equal(t, float64(want), testutil.ToFloat64(droppedMessages.WithLabelValues(reason))-before, reason)
+			}
+		})
+	}
+}
+
+func TestSession_SendMessage(t *testing.T) {
+	s := NewSession("session")
+	assert.NoError(t, s.AddPeer(&Peer{id: "p1", subscriber: &Subscriber{channels: map[string]*webrtc.DataChannel{}}}))
+	assert.Equal(t, errNoDataChannelFound, s.SendMessage("chat", nil, webrtc.DataChannelMessage{IsString: true, Data: []byte("hello")}))
+	assert.Equal(t, errNoDataChannelFound, s.SendMessage("chat", []string{"unknown"}, webrtc.DataChannelMessage{IsString: true, Data: []byte("hello")}))
+}
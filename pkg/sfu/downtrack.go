@@ -1,6 +1,7 @@
 package sfu
 
 import (
+	"io"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,6 +17,9 @@ import (
 	"github.com/pion/webrtc/v3"
 )
 
+// downTrackQueueSize is the max packets queued by a DownTrack before dropping
+const downTrackQueueSize = 256
+
 // DownTrackType determines the type of a track
 type DownTrackType int
 
@@ -40,6 +44,11 @@ type DownTrack struct {
 	trackType           DownTrackType
 	currentSpatialLayer int
 
+	// layerMu guards currentSpatialLayer and the simulcast target spatial
+	// layer, switchMu serializes the spatial layer switches
+	layerMu  sync.Mutex
+	switchMu sync.Mutex
+
 	enabled  atomicBool
 	reSync   atomicBool
 	snOffset uint16
@@ -49,32 +58,55 @@ type DownTrack struct {
 	lastTS   uint32
 
 	simulcast simulcastTrackHelpers
+	probe     *prober
+	pacer     *pacer
 
 	codec          webrtc.RTPCodecCapability
+	clock          rtpClock
 	receiver       Receiver
+	api            *apiChannel
 	transceiver    *webrtc.RTPTransceiver
 	writeStream    webrtc.TrackLocalWriter
+	bufferFactory  *buffer.Factory
 	onCloseHandler func()
 	onBind         func()
 	closeOnce      sync.Once
 
+	// Fan-out queue, written from its own goroutine
+	queue     chan rtp.Packet
+	queueOnce sync.Once
+	done      chan struct{}
+	stopOnce  sync.Once
+
 	// Report helpers
 	octetCount   uint32
 	packetCount  uint32
 	maxPacketTs  uint32
 	lastPacketMs int64
+	// Publisher timestamp and layer of the last packet, mapped to the
+	// publisher sender reports
+	lastInTS  uint32
+	lastLayer int32
 }
 
 // NewDownTrack returns a DownTrack.
 func NewDownTrack(c webrtc.RTPCodecCapability, r Receiver, peerID string) (*DownTrack, error) {
-	return &DownTrack{
+	d := &DownTrack{
 		id:       r.TrackID(),
 		peerID:   peerID,
 		streamID: r.StreamID(),
 		nList:    newNACKList(),
 		receiver: r,
 		codec:    c,
-	}, nil
+		queue:    make(chan rtp.Packet, downTrackQueueSize),
+		done:     make(chan struct{}),
+		simulcast: simulcastTrackHelpers{
+			targetTempLayer:  maxTemporalLayer,
+			currentTempLayer: maxTemporalLayer,
+		},
+	}
+	d.clock = newRTPClock(c, d.Kind())
+	return d, nil
 }
 
 // Bind is called by the PeerConnection after negotiation is complete
@@ -87,10 +119,16 @@ func (d *DownTrack) Bind(t webrtc.TrackLocalContext) (webrtc.RTPCodecParameters,
 		d.payload = uint8(codec.PayloadType)
 		d.writeStream = t.WriteStream()
 		d.mime = strings.ToLower(codec.MimeType)
+		d.clock = newRTPClock(codec.RTPCodecCapability, d.Kind())
 		d.bound.set(true)
 		d.reSync.set(true)
 		d.enabled.set(true)
-		if rr := bufferFactory.GetOrNew(packetio.RTCPBufferPacket, uint32(t.SSRC())).(*buffer.RTCPReader); rr != nil {
+		if d.Kind() == webrtc.RTPCodecTypeVideo && d.receiver.WriteKeyframeCache(d) {
+			log.Debugf("Starting track %s for peer %s from the keyframe cache", d.id, d.peerID)
+		}
+		if d.bufferFactory == nil {
+			log.Warnf("Track %s for peer %s has no buffer factory, rtcp is ignored", d.id, d.peerID)
+		} else if rr := d.bufferFactory.GetOrNew(packetio.RTCPBufferPacket, uint32(t.SSRC())).(*buffer.RTCPReader); rr != nil {
 			rr.OnPacket(func(pkt []byte) {
 				d.handleRTCP(pkt)
 			})
@@ -133,18 +171,102 @@ func (d *DownTrack) Kind() webrtc.RTPCodecType {
 
 // WriteRTP writes a RTP Packet to the DownTrack
 func (d *DownTrack) WriteRTP(p rtp.Packet) error {
+	return d.writeRTP(p, false)
+}
+
+// enqueue queues a RTP Packet to be written to the DownTrack from its own
+// goroutine, so a slow subscriber doesn't block the other ones. The packet
+// is dropped if the queue is full.
+func (d *DownTrack) enqueue(p rtp.Packet) {
+	if !d.enabled.get() || !d.bound.get() {
+		return
+	}
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	d.queueOnce.Do(func() {
+		go d.writeLoop()
+	})
+	select {
+	case d.queue <- p:
+	default:
+		d.drop(dropQueueFull)
+	}
+}
+
+func (d *DownTrack) writeLoop() {
+	for {
+		select {
+		case <-d.done:
+			return
+		case pkt := <-d.queue:
+			if err := d.WriteRTP(pkt); err == io.EOF {
+				current, _ := d.spatialLayers()
+				d.receiver.DeleteDownTrack(current, d.peerID)
+				return
+			}
+		}
+	}
+}
+
+// drop counts a dropped packet, video waits for a keyframe afterwards
+// since the subscriber can't decode the following frames.
+func (d *DownTrack) drop(reason string) {
+	kind := d.Kind()
+	droppedPackets.WithLabelValues(kind.String(), reason).Inc()
+	if kind == webrtc.RTPCodecTypeVideo && !d.reSync.get() {
+		d.reSync.set(true)
+		dropKeyframeRequests.WithLabelValues(reason).Inc()
+	}
+}
+
+// stop ends the DownTrack goroutine, queued packets are discarded
+func (d *DownTrack) stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+}
+
+// retransmitRTP writes a RTP Packet requested by a NACK to the DownTrack
+func (d *DownTrack) retransmitRTP(p rtp.Packet) error {
+	return d.writeRTP(p, true)
+}
+
+func (d *DownTrack) writeRTP(p rtp.Packet, rtx bool) error {
 	if !d.enabled.get() || !d.bound.get() {
 		return nil
 	}
+	priority := pacerVideo
+	if rtx {
+		priority = pacerRetransmission
+	} else if d.Kind() == webrtc.RTPCodecTypeAudio {
+		priority = pacerAudio
+	}
 	switch d.trackType {
 	case SimpleDownTrack:
-		return d.writeSimpleRTP(p)
+		return d.writeSimpleRTP(p, priority)
 	case SimulcastDownTrack:
-		return d.writeSimulcastRTP(p)
+		return d.writeSimulcastRTP(p, priority)
 	}
 	return nil
 }
 
+// write sends the packet to the subscriber, through its pacer if enabled
+func (d *DownTrack) write(hdr *rtp.Header, payload []byte, priority pacerPriority) error {
+	if d.pacer != nil {
+		err := d.pacer.enqueue(d.writeStream, hdr, payload, priority)
+		if err == errPacerQueueFull {
+			d.drop(dropPacerFull)
+			return nil
+		}
+		return err
+	}
+	_, err := d.writeStream.WriteRTP(hdr, payload)
+	return err
+}
+
 func (d *DownTrack) Mute(val bool) {
 	if d.enabled.get() != val {
 		return
@@ -152,6 +274,9 @@ func (d *DownTrack) Mute(val bool) {
 	d.enabled.set(!val)
 	if val {
 		d.reSync.set(val)
+		if d.probe != nil {
+			d.probe.stop()
+		}
 	}
 }
 
@@ -159,6 +284,7 @@ func (d *DownTrack) Mute(val bool) {
 func (d *DownTrack) Close() {
 	d.closeOnce.Do(func() {
 		log.Debugf("Closing sender %s", d.peerID)
+		d.stop()
 		if d.onCloseHandler != nil {
 			d.onCloseHandler()
 		}
@@ -167,16 +293,141 @@ func (d *DownTrack) Close() {
 
 func (d *DownTrack) SwitchSpatialLayer(targetLayer int) {
 	if d.trackType == SimulcastDownTrack {
-		// Don't switch until previous switch is done or canceled
-		if d.currentSpatialLayer != d.simulcast.targetSpatialLayer {
-			return
+		_, _ = d.requestSpatialLayer(targetLayer)
+	}
+}
+
+// requestSpatialLayer switches the simulcast layer, pending is true when
+// the switch waits for a probe of the subscriber bandwidth, it's dropped
+// if the probe fails.
+func (d *DownTrack) requestSpatialLayer(targetLayer int) (pending bool, err error) {
+	if d.trackType != SimulcastDownTrack {
+		return false, errNotSimulcast
+	}
+	d.switchMu.Lock()
+	defer d.switchMu.Unlock()
+	// Don't switch until previous switch is done or canceled
+	current, target := d.spatialLayers()
+	if current != target {
+		return false, errLayerSwitching
+	}
+	if layer, ok := d.receiver.ForcedLayer(); ok && layer != targetLayer {
+		return false, errLayerForced
+	}
+	if targetLayer == current {
+		return false, nil
+	}
+	if d.probe != nil {
+		if targetLayer < current {
+			d.probe.stop()
+		} else if d.probe.start(targetLayer,
+			d.receiver.Bitrate(targetLayer), d.receiver.Bitrate(current), time.Now()) != probeNotNeeded {
+			// Switch once the probe succeeds, or retry after the backoff
+			return true, nil
 		}
-		if err := d.receiver.SubDownTrack(d, targetLayer); err == nil {
-			d.simulcast.targetSpatialLayer = targetLayer
+	}
+	return false, d.switchSpatialLayer(targetLayer)
+}
+
+// switchSpatialLayer subscribes to the target layer, the write loop
+// switches on its next keyframe. Must be called holding switchMu.
+func (d *DownTrack) switchSpatialLayer(targetLayer int) error {
+	if err := d.receiver.SubDownTrack(d, targetLayer); err != nil {
+		return err
+	}
+	d.layerMu.Lock()
+	d.simulcast.targetSpatialLayer = targetLayer
+	d.layerMu.Unlock()
+	return nil
+}
+
+// spatialLayers returns the current and target spatial layers
+func (d *DownTrack) spatialLayers() (current, target int) {
+	d.layerMu.Lock()
+	defer d.layerMu.Unlock()
+	return d.currentSpatialLayer, d.simulcast.targetSpatialLayer
+}
+
+// setSpatialLayer sets the current and target spatial layers of a track
+// not written yet
+func (d *DownTrack) setSpatialLayer(layer int) {
+	d.layerMu.Lock()
+	d.currentSpatialLayer = layer
+	d.simulcast.targetSpatialLayer = layer
+	d.layerMu.Unlock()
+}
+
+// forceSpatialLayer switches to a layer forced by a moderator, canceling
+// a running probe or switch.
+func (d *DownTrack) forceSpatialLayer(layer int) {
+	if d.trackType != SimulcastDownTrack {
+		return
+	}
+	d.switchMu.Lock()
+	defer d.switchMu.Unlock()
+	if d.probe != nil {
+		d.probe.stop()
+	}
+	// The write loop may complete the pending switch meanwhile, cancel it
+	// only if it's still pending
+	d.layerMu.Lock()
+	current, target := d.currentSpatialLayer, d.simulcast.targetSpatialLayer
+	canceled := target != current && target != layer
+	if canceled {
+		d.simulcast.targetSpatialLayer = current
+	}
+	d.layerMu.Unlock()
+	if canceled {
+		d.receiver.DeleteDownTrack(target, d.peerID)
+		target = current
+	}
+	if layer != target {
+		if err := d.switchSpatialLayer(layer); err != nil {
+			log.Errorf("Forcing layer %d of peer %s err: %v", layer, d.peerID, err)
 		}
 	}
 }
 
+// apiEvent pushes an event on the api channel of the subscriber
+func (d *DownTrack) apiEvent(event string, data interface{}) {
+	if d.api != nil {
+		d.api.event(event, data)
+	}
+}
+
+// apiStats returns the stats of the track replied to the api getStats
+func (d *DownTrack) apiStats() APITrackStats {
+	octets, packets := d.getSRStats()
+	current, target := d.spatialLayers()
+	return APITrackStats{
+		StreamID:      d.streamID,
+		TrackID:       d.id,
+		Kind:          d.Kind().String(),
+		MimeType:      d.codec.MimeType,
+		Paused:        !d.enabled.get(),
+		Muted:         d.receiver.Muted(),
+		Layer:         current,
+		TargetLayer:   target,
+		Layers:        d.receiver.Layers(),
+		TemporalLayer: int(atomic.LoadInt32(&d.simulcast.targetTempLayer)),
+		Packets:       packets,
+		Bytes:         octets,
+		Bitrate:       d.receiver.Bitrate(current),
+	}
+}
+
+// SwitchTemporalLayer sets the highest VP8 temporal layer forwarded to
+// change the frame rate, layers are switched on the next frame allowing
+// it. Only applies when temporal layers are enabled in the router config.
+func (d *DownTrack) SwitchTemporalLayer(targetLayer int) {
+	if targetLayer < 0 {
+		targetLayer = 0
+	} else if targetLayer > maxTemporalLayer {
+		targetLayer = maxTemporalLayer
+	}
+	atomic.StoreInt32(&d.simulcast.targetTempLayer, int32(targetLayer))
+}
+
 // OnCloseHandler method to be called on remote tracked removed
 func (d *DownTrack) OnCloseHandler(fn func()) {
 	d.onCloseHandler = fn
@@ -186,33 +437,48 @@ func (d *DownTrack) OnBind(fn func()) {
 	d.onBind = fn
 }
 
-func (d *DownTrack) writeSimpleRTP(pkt rtp.Packet) error {
-	if d.reSync.get() {
+func (d *DownTrack) writeSimpleRTP(pkt rtp.Packet, priority pacerPriority) error {
+	// A new source continues after the time elapsed since the last packet
+	if d.reSync.get() || d.lastSSRC != 0 && d.lastSSRC != pkt.SSRC {
 		if d.Kind() == webrtc.RTPCodecTypeVideo {
 			relay := false
 			// Wait for a keyframe to sync new source
 			switch d.mime {
 			case "video/vp8":
 				vp8Packet := VP8Helper{}
-				if err := vp8Packet.Unmarshal(pkt.Payload); err == nil {
-					relay = vp8Packet.IsKeyFrame
+				if err := vp8Packet.Unmarshal(pkt.Payload); err == nil && vp8Packet.IsKeyFrame {
+					relay = true
+					d.simulcast.resyncVP8(&vp8Packet)
 				}
 			case "video/h264":
-				relay = isH264Keyframe(pkt.Payload)
+				relay = buffer.IsH264Keyframe(pkt.Payload)
+			case "video/vp9":
+				relay = buffer.IsVP9Keyframe(pkt.Payload)
+			default:
+				relay = true
 			}
 			if !relay {
-				d.receiver.SendRTCP([]rtcp.Packet{
-					&rtcp.PictureLossIndication{SenderSSRC: d.ssrc, MediaSSRC: pkt.SSRC},
-				})
+				d.receiver.RequestKeyframe(d.peerID, pkt.SSRC, false)
 				return nil
 			}
 		}
 		d.snOffset = pkt.SequenceNumber - d.lastSN - 1
-		d.tsOffset = pkt.Timestamp - d.lastTS - 1
+		d.tsOffset = pkt.Timestamp - d.lastTS - d.idleTicks()
 		d.lastSSRC = pkt.SSRC
 		d.reSync.set(false)
 	}
 
+	if d.simulcast.temporalEnabled && d.mime == "video/vp8" {
+		pl, skip := setVP8TemporalLayer(pkt.Payload, d)
+		if skip {
+			d.snOffset++
+			return nil
+		}
+		if pl != nil {
+			pkt.Payload = pl
+		}
+	}
+
 	atomic.AddUint32(&d.octetCount, uint32(len(pkt.Payload)))
 	atomic.AddUint32(&d.packetCount, 1)
 
@@ -223,24 +489,29 @@ func (d *DownTrack) writeSimpleRTP(pkt rtp.Packet) error {
 		d.lastSN = newSN
 		atomic.StoreInt64(&d.lastPacketMs, time.Now().UnixNano()/1e6)
 		atomic.StoreUint32(&d.lastTS, newTS)
+		atomic.StoreUint32(&d.lastInTS, pkt.Timestamp)
+		atomic.StoreInt32(&d.lastLayer, int32(d.currentSpatialLayer))
 	}
 	pkt.PayloadType = d.payload
 	pkt.Timestamp = newTS
 	pkt.SequenceNumber = newSN
 	pkt.SSRC = d.ssrc
 
-	_, err := d.writeStream.WriteRTP(&pkt.Header, pkt.Payload)
+	err := d.write(&pkt.Header, pkt.Payload, priority)
 	if err != nil {
 		log.Errorf("Write packet err %v", err)
 	}
 	return err
 }
 
-func (d *DownTrack) writeSimulcastRTP(pkt rtp.Packet) error {
+func (d *DownTrack) writeSimulcastRTP(pkt rtp.Packet, priority pacerPriority) error {
 	// Check if packet SSRC is different from before
 	// if true, the video source changed
-	if d.lastSSRC != pkt.SSRC {
-		if d.currentSpatialLayer == d.simulcast.targetSpatialLayer && d.lastSSRC != 0 {
+	reSync := d.reSync.get()
+	prevLayer, target := d.spatialLayers()
+	layer := prevLayer
+	if d.lastSSRC != pkt.SSRC || reSync {
+		if d.lastSSRC != pkt.SSRC && prevLayer == target && d.lastSSRC != 0 {
 			return nil
 		}
 		relay := false
@@ -248,60 +519,67 @@ func (d *DownTrack) writeSimulcastRTP(pkt rtp.Packet) error {
 		switch d.mime {
 		case "video/vp8":
 			vp8Packet := VP8Helper{}
-			if err := vp8Packet.Unmarshal(pkt.Payload); err == nil {
-				if vp8Packet.IsKeyFrame {
-					relay = true
-					// Set VP8Helper temporal info
-					d.simulcast.temporalSupported = vp8Packet.TemporalSupported
-					d.simulcast.refPicID += vp8Packet.PictureID - d.simulcast.lastPicID
-					d.simulcast.refTlzi += vp8Packet.TL0PICIDX - d.simulcast.lastTlzi
-				}
+			if err := vp8Packet.Unmarshal(pkt.Payload); err == nil && vp8Packet.IsKeyFrame {
+				relay = true
+				d.simulcast.resyncVP8(&vp8Packet)
 			}
 		case "video/h264":
-			relay = isH264Keyframe(pkt.Payload)
+			relay = buffer.IsH264Keyframe(pkt.Payload)
+		case "video/vp9":
+			relay = buffer.IsVP9Keyframe(pkt.Payload)
 		default:
 			log.Warnf("codec payload don't support simulcast: %s", d.codec.MimeType)
 			return nil
 		}
 		// Packet is not a keyframe, discard it
 		if !relay {
-			d.receiver.SendRTCP([]rtcp.Packet{
-				&rtcp.PictureLossIndication{SenderSSRC: d.ssrc, MediaSSRC: pkt.SSRC},
-			})
+			d.receiver.RequestKeyframe(d.peerID, pkt.SSRC, false)
 			return nil
 		}
 		// Switch is done remove sender from previous layer
-		// and update current layer
-		if d.currentSpatialLayer != d.simulcast.targetSpatialLayer {
-			go d.receiver.DeleteDownTrack(d.currentSpatialLayer, d.peerID)
+		// and update current layer, the target may have been canceled
+		// since the packet was checked
+		d.layerMu.Lock()
+		prevLayer, layer = d.currentSpatialLayer, d.simulcast.targetSpatialLayer
+		d.currentSpatialLayer = layer
+		d.layerMu.Unlock()
+		if prevLayer != layer {
+			go d.receiver.DeleteDownTrack(prevLayer, d.peerID)
+			go d.apiEvent(APIEventLayerSwitched, APILayerParams{
+				APITrack: APITrack{StreamID: d.streamID, TrackID: d.id},
+				Layer:    layer,
+			})
 		}
-		d.currentSpatialLayer = d.simulcast.targetSpatialLayer
+		d.reSync.set(false)
 	}
 	// Compute how much time passed between the old RTP pkt
 	// and the current packet, and fix timestamp on source change
 	if !d.simulcast.lTSCalc.IsZero() && d.lastSSRC != pkt.SSRC {
-		tDiff := time.Now().Sub(d.simulcast.lTSCalc)
-		td := uint32((tDiff.Milliseconds() * 90) / 1000)
+		td := d.clock.ticks(time.Since(d.simulcast.lTSCalc))
+		if srTD, ok := d.layerTimestampDelta(prevLayer, layer, pkt.Timestamp); ok {
+			td = srTD
+		}
 		if td == 0 {
 			td = 1
 		}
 		d.tsOffset = pkt.Timestamp - (d.lastTS + td)
 		d.snOffset = pkt.SequenceNumber - d.lastSN - 1
+	} else if reSync && !d.simulcast.lTSCalc.IsZero() {
+		// Packets were dropped, continue after the last sequence number sent
+		d.snOffset = pkt.SequenceNumber - d.lastSN - 1
 	} else if d.simulcast.lTSCalc.IsZero() {
 		d.lastTS = pkt.Timestamp
 		d.lastSN = pkt.SequenceNumber
 	}
-	if d.simulcast.temporalEnabled && d.simulcast.temporalSupported {
-		if d.codec.MimeType == "video/vp8" {
-			pl, skip := setVP8TemporalLayer(pkt.Payload, d)
-			if skip {
-				// Pkt not in temporal layer update sequence number offset to avoid gaps
-				d.snOffset++
-				return nil
-			}
-			if pl != nil {
-				pkt.Payload = pl
-			}
+	if d.simulcast.temporalEnabled && d.mime == "video/vp8" {
+		pl, skip := setVP8TemporalLayer(pkt.Payload, d)
+		if skip {
+			// Pkt not in temporal layer update sequence number offset to avoid gaps
+			d.snOffset++
+			return nil
+		}
+		if pl != nil {
+			pkt.Payload = pl
 		}
 	}
 	atomic.AddUint32(&d.octetCount, uint32(len(pkt.Payload)))
@@ -312,6 +590,8 @@ func (d *DownTrack) writeSimulcastRTP(pkt rtp.Packet) error {
 		d.lastSN = newSN
 		atomic.StoreInt64(&d.lastPacketMs, time.Now().UnixNano()/1e6)
 		atomic.StoreUint32(&d.lastTS, newTS)
+		atomic.StoreUint32(&d.lastInTS, pkt.Timestamp)
+		atomic.StoreInt32(&d.lastLayer, int32(layer))
 	}
 	// Update base
 	d.simulcast.lTSCalc = time.Now()
@@ -322,11 +602,79 @@ func (d *DownTrack) writeSimulcastRTP(pkt rtp.Packet) error {
 	pkt.Header.SSRC = d.ssrc
 	pkt.Header.PayloadType = d.payload
 
-	_, err := d.writeStream.WriteRTP(&pkt.Header, pkt.Payload)
+	err := d.write(&pkt.Header, pkt.Payload, priority)
 	if err != nil {
 		log.Errorf("Write packet err %v", err)
+		return err
 	}
-	return err
+	// Probe between frames, after the last packet of the newest frame
+	if d.probe != nil && pkt.Marker && newSN == d.lastSN {
+		d.writeProbe()
+	}
+	return nil
+}
+
+// writeProbe sends the padding due by a running probe, and switches
+// layer once the probe succeeds
+func (d *DownTrack) writeProbe() {
+	now := time.Now()
+	switch result, layer := d.probe.check(now); result {
+	case probeSucceeded:
+		log.Debugf("Probe succeeded for peer %s, switching to layer %d", d.peerID, layer)
+		d.switchMu.Lock()
+		if current, target := d.spatialLayers(); current == target {
+			if err := d.switchSpatialLayer(layer); err != nil {
+				log.Debugf("Switching peer %s to layer %d err: %v", d.peerID, layer, err)
+			}
+		}
+		d.switchMu.Unlock()
+		return
+	case probeFailed:
+		current, _ := d.spatialLayers()
+		log.Debugf("Probe failed for peer %s, keeping layer %d", d.peerID, current)
+		return
+	case probeIdle:
+		if layer, ok := d.probe.retry(now); ok {
+			d.SwitchSpatialLayer(layer)
+		}
+		return
+	}
+	size := d.probe.padding(now)
+	for i := 0; size > 0 && i < maxPaddingBurst; i++ {
+		n := size
+		if n > maxPaddingSize {
+			n = maxPaddingSize
+		}
+		if err := d.writePaddingRTP(n); err != nil {
+			return
+		}
+		d.probe.sentPadding(n)
+		size -= n
+	}
+}
+
+// writePaddingRTP sends a padding only packet of size bytes, continuing
+// the sequence numbers of the media packets.
+func (d *DownTrack) writePaddingRTP(size int) error {
+	hdr := rtp.Header{
+		Version:        2,
+		Padding:        true,
+		PayloadType:    d.payload,
+		SequenceNumber: d.lastSN + 1,
+		Timestamp:      d.lastTS,
+		SSRC:           d.ssrc,
+	}
+	payload := make([]byte, size)
+	payload[size-1] = byte(size)
+	if err := d.write(&hdr, payload, pacerPadding); err != nil {
+		log.Errorf("Write padding packet err %v", err)
+		return err
+	}
+	// Following media packets continue after the padding
+	d.snOffset--
+	d.lastSN = hdr.SequenceNumber
+	atomic.AddUint32(&d.packetCount, 1)
+	return nil
 }
 
 func (d *DownTrack) handleRTCP(bytes []byte) {
@@ -339,29 +687,31 @@ func (d *DownTrack) handleRTCP(bytes []byte) {
 		log.Errorf("Unmarshal rtcp receiver packets err: %v", err)
 	}
 
-	var fwdPkts []rtcp.Packet
 	pliOnce := true
 	firOnce := true
 	for _, pkt := range pkts {
 		switch p := pkt.(type) {
 		case *rtcp.PictureLossIndication:
 			if pliOnce {
-				p.MediaSSRC = d.lastSSRC
-				p.SenderSSRC = d.lastSSRC
-				fwdPkts = append(fwdPkts, p)
+				d.receiver.RequestKeyframe(d.peerID, d.lastSSRC, false)
 				pliOnce = false
 			}
 		case *rtcp.FullIntraRequest:
 			if firOnce {
-				p.MediaSSRC = d.lastSSRC
-				p.SenderSSRC = d.ssrc
-				fwdPkts = append(fwdPkts, p)
+				d.receiver.RequestKeyframe(d.peerID, d.lastSSRC, true)
 				firOnce = false
 			}
 		case *rtcp.ReceiverReport:
 			if len(p.Reports) > 0 && p.Reports[0].FractionLost > 25 {
 				log.Tracef("Slow link for sender %s, fraction packet lost %.2f", d.peerID, float64(p.Reports[0].FractionLost)/256)
 			}
+			if d.probe != nil && len(p.Reports) > 0 && d.codec.ClockRate > 0 {
+				d.probe.onReport(p.Reports[0].FractionLost, float64(p.Reports[0].Jitter)*1000/float64(d.codec.ClockRate))
+			}
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			if d.probe != nil {
+				d.probe.onEstimate(p.Bitrate)
+			}
 		case *rtcp.TransportLayerNack:
 			log.Tracef("sender got nack: %+v", p)
 			var nackedPackets []uint16
@@ -371,9 +721,59 @@ func (d *DownTrack) handleRTCP(bytes []byte) {
 			d.receiver.RetransmitPackets(d, nackedPackets)
 		}
 	}
-	if len(fwdPkts) > 0 {
-		d.receiver.SendRTCP(fwdPkts)
+}
+
+// idleTicks returns the timestamp units elapsed since the last packet sent,
+// at least one so the timestamps keep increasing after a resync.
+func (d *DownTrack) idleTicks() uint32 {
+	lastPktMs := atomic.LoadInt64(&d.lastPacketMs)
+	if lastPktMs == 0 {
+		return 1
+	}
+	if ticks := d.clock.ticks(time.Duration(time.Now().UnixNano()/1e6-lastPktMs) * time.Millisecond); ticks > 0 {
+		return ticks
+	}
+	return 1
+}
+
+// layerTimestampDelta returns the time between the last packet sent from
+// the previous layer and a packet of the current layer in clock units, from
+// the sender reports of both layers so the sync with the other tracks of
+// the publisher is kept. Returns false if a sender report is missing.
+func (d *DownTrack) layerTimestampDelta(prevLayer, layer int, ts uint32) (uint32, bool) {
+	prev := d.receiver.SenderReport(prevLayer)
+	cur := d.receiver.SenderReport(layer)
+	if prev.Received == 0 || cur.Received == 0 {
+		return 0, false
+	}
+	diff := rtpToTime(cur, ts, d.clock) - rtpToTime(prev, d.lastTS+d.tsOffset, d.clock)
+	return d.clock.ticks(time.Duration(diff)), true
+}
+
+// senderReport builds the sender report of the track at now in ns. The NTP
+// time and timestamp are mapped with the sender report of the publisher
+// track, so the subscriber keeps the tracks of a publisher in sync. Without
+// one, the timestamp is estimated from the time of the last packet.
+func (d *DownTrack) senderReport(now int64) *rtcp.SenderReport {
+	octets, packets := d.getSRStats()
+	sr := &rtcp.SenderReport{
+		SSRC:        d.ssrc,
+		PacketCount: packets,
+		OctetCount:  octets,
+	}
+	lastTS := atomic.LoadUint32(&d.lastTS)
+	pub := d.receiver.SenderReport(int(atomic.LoadInt32(&d.lastLayer)))
+	if pub.Received != 0 {
+		elapsed := now - pub.Received
+		tsOffset := atomic.LoadUint32(&d.lastInTS) - lastTS
+		sr.NTPTime = timeToNtp(ntpToTime(pub.NTPTime) + elapsed)
+		sr.RTPTime = pub.RTPTime + d.clock.ticks(time.Duration(elapsed)) - tsOffset
+		return sr
 	}
+	lastPktMs := atomic.LoadInt64(&d.lastPacketMs)
+	sr.NTPTime = timeToNtp(now)
+	sr.RTPTime = lastTS + d.clock.ticks(time.Duration(now/1e6-lastPktMs)*time.Millisecond)
+	return sr
 }
 
 func (d *DownTrack) getSRStats() (octets, packets uint32) {
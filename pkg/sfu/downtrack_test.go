@@ -0,0 +1,263 @@
+package sfu
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownTrack_enqueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		mime       string
+		wantReSync bool
+	}{
+		{
+			name:       "Must resync video after dropping packets",
+			mime:       webrtc.MimeTypeVP8,
+			wantReSync: true,
+		},
+		{
+			name: "Must only drop audio packets",
+			mime: webrtc.MimeTypeOpus,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dt := &DownTrack{
+				codec: webrtc.RTPCodecCapability{MimeType: tt.mime},
+				queue: make(chan rtp.Packet, 2),
+				done:  make(chan struct{}),
+			}
+			dt.bound.set(true)
+			dt.enabled.set(true)
+			// Keep the writer goroutine from draining the queue
+			dt.queueOnce.Do(func() {})
+
+			dt.enqueue(rtp.Packet{})
+			dt.enqueue(rtp.Packet{})
+			assert.False(t, dt.reSync.get())
+			dt.enqueue(rtp.Packet{})
+			assert.Equal(t, 2, len(dt.queue))
+			assert.Equal(t, tt.wantReSync, dt.reSync.get())
+
+			dt.stop()
+			<-dt.queue
+			dt.enqueue(rtp.Packet{})
+			assert.Equal(t, 1, len(dt.queue))
+		})
+	}
+}
+
+func Test_appendDownTrack(t *testing.T) {
+	a, b, c := &DownTrack{}, &DownTrack{}, &DownTrack{}
+	dts := make([]*DownTrack, 0, 4)
+	dts = append(dts, a)
+	read := dts
+	dts = appendDownTrack(dts, b)
+	dts = appendDownTrack(dts, c)
+	assert.Equal(t, []*DownTrack{a}, read)
+	assert.Equal(t, []*DownTrack{a, b, c}, dts)
+}
+
+func TestDownTrack_senderReport(t *testing.T) {
+	pub := buffer.NewBuffer(1234, nil, nil)
+	recv := &WebRTCReceiver{buffers: []*buffer.Buffer{pub}}
+	dt := &DownTrack{
+		ssrc:     5678,
+		receiver: recv,
+		codec:    webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		clock:    rtpClock{rate: 90000},
+	}
+	// Timestamps are rewritten 1000 lower than the publisher ones
+	dt.lastTS = 9000
+	dt.lastInTS = 10000
+	dt.lastPacketMs = time.Now().UnixNano() / 1e6
+	dt.packetCount = 10
+
+	// Without publisher report, the timestamp is estimated from the last packet
+	now := time.Now().UnixNano()
+	sr := dt.senderReport(now)
+	assert.Equal(t, uint32(5678), sr.SSRC)
+	assert.Equal(t, uint32(10), sr.PacketCount)
+	assert.Equal(t, timeToNtp(now), sr.NTPTime)
+	assert.InDelta(t, 9000, sr.RTPTime, 90*10)
+
+	pubNTP := timeToNtp(time.Unix(1602391458, 0).UnixNano())
+	pub.SetSenderReportData(50000, pubNTP)
+	received := recv.SenderReport(0).Received
+	sr = dt.senderReport(received + int64(time.Second))
+	assert.InDelta(t, time.Unix(1602391459, 0).UnixNano(), ntpToTime(sr.NTPTime), 1)
+	assert.Equal(t, uint32(50000+90000-1000), sr.RTPTime)
+}
+
+func TestDownTrack_layerTimestampDelta(t *testing.T) {
+	low, high := buffer.NewBuffer(1, nil, nil), buffer.NewBuffer(2, nil, nil)
+	recv := &WebRTCReceiver{buffers: []*buffer.Buffer{low, high}}
+	dt := &DownTrack{
+		receiver: recv,
+		codec:    webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		clock:    rtpClock{rate: 90000},
+		lastTS:   1000,
+		tsOffset: 4000,
+	}
+
+	_, ok := dt.layerTimestampDelta(0, 1, 0)
+	assert.False(t, ok)
+
+	// Both layers share the publisher clock, 90000 on the high layer is
+	// 100ms after the 5000 sent from the low layer.
+	ntp := timeToNtp(time.Unix(1602391458, 0).UnixNano())
+	low.SetSenderReportData(5000, ntp)
+	high.SetSenderReportData(81000, ntp)
+	td, ok := dt.layerTimestampDelta(0, 1, 90000)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(9000), td)
+
+	td, ok = dt.layerTimestampDelta(0, 1, 80000)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(0), td)
+}
+
+type headerWriter struct {
+	headers []rtp.Header
+}
+
+func (w *headerWriter) WriteRTP(header *rtp.Header, _ []byte) (int, error) {
+	w.headers = append(w.headers, *header)
+	return 0, nil
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func TestDownTrack_sourceSwitch(t *testing.T) {
+	vp8Keyframe := []byte{0x10, 0x00, 0x9d, 0x01}
+	tests := []struct {
+		name      string
+		codec     webrtc.RTPCodecCapability
+		trackType DownTrackType
+		idle      time.Duration
+	}{
+		{
+			name:      "Audio source switch at 48kHz",
+			codec:     webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000},
+			trackType: SimpleDownTrack,
+			idle:      100 * time.Millisecond,
+		},
+		{
+			name:      "Video simulcast layer switch at 90kHz",
+			codec:     webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+			trackType: SimulcastDownTrack,
+			idle:      200 * time.Millisecond,
+		},
+		{
+			name:      "Audio source switch after a long idle",
+			codec:     webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000},
+			trackType: SimpleDownTrack,
+			idle:      30 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := &headerWriter{}
+			dt := &DownTrack{
+				codec:       tt.codec,
+				mime:        strings.ToLower(tt.codec.MimeType),
+				clock:       rtpClock{rate: tt.codec.ClockRate},
+				trackType:   tt.trackType,
+				receiver:    &WebRTCReceiver{},
+				writeStream: w,
+			}
+			write := func(ssrc uint32, sn uint16, ts uint32) {
+				pkt := rtp.Packet{
+					Header:  rtp.Header{SSRC: ssrc, SequenceNumber: sn, Timestamp: ts},
+					Payload: vp8Keyframe,
+				}
+				if tt.trackType == SimulcastDownTrack {
+					assert.NoError(t, dt.writeSimulcastRTP(pkt, pacerVideo))
+				} else {
+					assert.NoError(t, dt.writeSimpleRTP(pkt, pacerAudio))
+				}
+			}
+
+			write(1, 100, 1000)
+			write(1, 101, 1000+tt.codec.ClockRate/50)
+			assert.Len(t, w.headers, 2)
+			last := w.headers[1]
+
+			// Idle before the new source
+			dt.lastPacketMs -= tt.idle.Milliseconds()
+			dt.simulcast.lTSCalc = dt.simulcast.lTSCalc.Add(-tt.idle)
+			dt.simulcast.targetSpatialLayer = 1
+			write(2, 5000, 3000000000)
+			write(2, 5001, 3000000000+tt.codec.ClockRate/50)
+			assert.Len(t, w.headers, 4)
+
+			want := last.Timestamp + rtpClock{rate: tt.codec.ClockRate}.ticks(tt.idle)
+			// Allow the time taken by the test itself
+			assert.InDelta(t, want, w.headers[2].Timestamp, float64(tt.codec.ClockRate/100))
+			assert.Equal(t, w.headers[2].Timestamp+tt.codec.ClockRate/50, w.headers[3].Timestamp)
+			assert.Equal(t, last.SequenceNumber+1, w.headers[2].SequenceNumber)
+			assert.Equal(t, last.SequenceNumber+2, w.headers[3].SequenceNumber)
+		})
+	}
+}
+
+func TestDownTrack_forceSpatialLayerRace(t *testing.T) {
+	recv := &WebRTCReceiver{
+		isSimulcast: true,
+		upTracks:    []*webrtc.TrackRemote{{}, {}, {}},
+		caches:      make([]*keyframeCache, 3),
+		downTracks:  [][]*DownTrack{{}, {}, {}},
+	}
+	dt := &DownTrack{
+		peerID:      "sub",
+		codec:       webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		mime:        "video/vp8",
+		clock:       rtpClock{rate: 90000},
+		receiver:    recv,
+		writeStream: &headerWriter{},
+	}
+	recv.AddDownTrack(dt, false)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			assert.NoError(t, recv.ForceLayer(i%3))
+		}
+		assert.NoError(t, recv.ForceLayer(2))
+	}()
+	// The write loop completes the switches while the moderator forces
+	// the layers
+	write := func(sn uint16) {
+		pkt := rtp.Packet{
+			Header:  rtp.Header{SSRC: uint32(sn%3) + 1, SequenceNumber: sn, Timestamp: uint32(sn) * 3000},
+			Payload: []byte{0x10, 0x00, 0x9d, 0x01},
+		}
+		assert.NoError(t, dt.writeSimulcastRTP(pkt, pacerVideo))
+	}
+	sn := uint16(0)
+	for running := true; running; sn++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		write(sn)
+	}
+	write(sn)
+
+	current, target := dt.spatialLayers()
+	assert.Equal(t, 2, current)
+	assert.Equal(t, 2, target)
+}
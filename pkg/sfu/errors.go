@@ -3,14 +3,40 @@ package sfu
 import "errors"
 
 var (
+	// config errors
+	errInvalidPortRange         = errors.New("port range must be [min, max] with max - min >= 100")
+	errInvalidBufferTime        = errors.New("maxbuffertime must not be negative")
+	errInvalidLogLevel          = errors.New("log level must be one of trace, debug, info, warn or error")
+	errInvalidNack              = errors.New("maxnacktimes must be in [0, 255] and nackdeadline must not be negative")
 	errPeerConnectionInitFailed = errors.New("pc init failed")
 	errPtNotSupported           = errors.New("payload type not supported")
 	errCreatingDataChannel      = errors.New("failed to create data channel")
+	errUnsupportedCodec         = errors.New("codec not supported")
+	errCodecNotDecodable        = errors.New("codec can't be decoded by every subscriber")
+	errInvalidDataChannelRelay  = errors.New("data channel relay must be one of broadcast, publisher or none")
+	// session errors
+	errCodecNotAllowed     = errors.New("codec not allowed in session")
+	errMaxPublishers       = errors.New("max publishers reached in session")
+	errNoPublisherFound    = errors.New("no publisher found")
+	errInvalidTrackControl = errors.New("invalid track control")
+	errInvalidRole         = errors.New("invalid role")
+	errPeerNotFound        = errors.New("peer not found")
+	errNoDataChannelFound  = errors.New("no data channel found")
 	// router errors
 	errNoReceiverFound = errors.New("no receiver found")
-	// Helpers errors
-	errShortPacket = errors.New("packet is not large enough")
-	errNilPacket   = errors.New("invalid nil packet")
+	// receiver errors
+	errNotSimulcast  = errors.New("track is not simulcast")
+	errLayerNotFound = errors.New("layer not received")
+	errLayerForced   = errors.New("layer forced by a moderator")
+	// api errors
+	errAPIVersion             = errors.New("unsupported api version")
+	errAPIUnknownMethod       = errors.New("unknown api method")
+	errAPIBadParams           = errors.New("invalid api params")
+	errNoTrackFound           = errors.New("no track found")
+	errTemporalLayersDisabled = errors.New("temporal layers disabled")
+	// down track errors
+	errPacerQueueFull = errors.New("pacer queue full")
+	errLayerSwitching = errors.New("layer switch in progress")
 	// buffer errors
 	errPacketNotFound = errors.New("packet not found in cache")
 	errPacketTooOld   = errors.New("packet not found in cache, too old")
@@ -1,12 +1,10 @@
 package sfu
 
 import (
-	"encoding/binary"
 	"strings"
 	"sync/atomic"
 
-	log "github.com/pion/ion-log"
-
+	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -30,198 +28,76 @@ func (b *atomicBool) get() bool {
 }
 
 // VP8Helper is a helper to get temporal data from VP8 packet header
-/*
-	VP8Helper Payload Descriptor
-			0 1 2 3 4 5 6 7                      0 1 2 3 4 5 6 7
-			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
-			|X|R|N|S|R| PID | (REQUIRED)        |X|R|N|S|R| PID | (REQUIRED)
-			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
-		X:  |I|L|T|K| RSV   | (OPTIONAL)   X:   |I|L|T|K| RSV   | (OPTIONAL)
-			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
-		I:  |M| PictureID   | (OPTIONAL)   I:   |M| PictureID   | (OPTIONAL)
-			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
-		L:  |   TL0PICIDX   | (OPTIONAL)        |   PictureID   |
-			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
-		T/K:|TID|Y| KEYIDX  | (OPTIONAL)   L:   |   TL0PICIDX   | (OPTIONAL)
-			+-+-+-+-+-+-+-+-+                   +-+-+-+-+-+-+-+-+
-		T/K:|TID|Y| KEYIDX  | (OPTIONAL)
-			+-+-+-+-+-+-+-+-+
-*/
-type VP8Helper struct {
-	TemporalSupported bool
-	// Optional Header
-	PictureID uint16 /* 8 or 16 bits, picture ID */
-	picIDIdx  uint8
-	mBit      bool
-	TL0PICIDX uint8 /* 8 bits temporal level zero index */
-	tlzIdx    uint8
-
-	// Optional Header If either of the T or K bits are set to 1,
-	// the TID/Y/KEYIDX extension field MUST be present.
-	TID uint8 /* 2 bits temporal layer idx*/
-	// IsKeyFrame is a helper to detect if current packet is a keyframe
-	IsKeyFrame bool
-}
-
-// Unmarshal parses the passed byte slice and stores the result in the VP8Helper this method is called upon
-func (p *VP8Helper) Unmarshal(payload []byte) error {
-	if payload == nil {
-		return errNilPacket
-	}
-
-	payloadLen := len(payload)
-
-	if payloadLen < 4 {
-		return errShortPacket
-	}
-
-	var idx uint8
-	S := payload[idx]&0x10 > 0
-	// Check for extended bit control
-	if payload[idx]&0x80 > 0 {
-		idx++
-		// Check if T is present, if not, no temporal layer is available
-		p.TemporalSupported = payload[idx]&0x20 > 0
-		K := payload[idx]&0x10 > 0
-		L := payload[idx]&0x40 > 0
-		// Check for PictureID
-		if payload[idx]&0x80 > 0 {
-			idx++
-			p.picIDIdx = idx
-			pid := payload[idx] & 0x7f
-			// Check if m is 1, then Picture ID is 15 bits
-			if payload[idx]&0x80 > 0 {
-				idx++
-				p.mBit = true
-				p.PictureID = binary.BigEndian.Uint16([]byte{pid, payload[idx]})
-			} else {
-				p.PictureID = uint16(pid)
-			}
-		}
-		// Check if TL0PICIDX is present
-		if L {
-			idx++
-			p.tlzIdx = idx
-			p.TL0PICIDX = payload[idx]
-		}
-		if p.TemporalSupported || K {
-			idx++
-			p.TID = (payload[idx] & 0xc0) >> 6
-		}
-		if int(idx) >= payloadLen {
-			return errShortPacket
-		}
-		idx++
-		// Check is packet is a keyframe by looking at P bit in vp8 payload
-		p.IsKeyFrame = payload[idx]&0x01 == 0 && S
-	} else {
-		idx++
-		// Check is packet is a keyframe by looking at P bit in vp8 payload
-		p.IsKeyFrame = payload[idx]&0x01 == 0 && S
-	}
-	return nil
-}
+type VP8Helper = buffer.VP8Helper
 
-// setVp8TemporalLayer is a helper to detect and modify accordingly the vp8 payload to reflect
-// temporal changes in the SFU.
+// setVP8TemporalLayer is a helper to detect and modify accordingly the vp8 payload to reflect
+// temporal changes in the SFU. Layers are switched down at the start of any frame and up one
+// layer at a time on layer sync frames, PictureID and TL0PICIDX are rewritten so the dropped
+// frames leave no gaps.
 // VP8Helper temporal layers implemented according https://tools.ietf.org/html/rfc7741
 func setVP8TemporalLayer(pl []byte, s *DownTrack) (payload []byte, skip bool) {
 	var pkt VP8Helper
-	if err := pkt.Unmarshal(pl); err != nil {
+	if err := pkt.Unmarshal(pl); err != nil || !pkt.TemporalSupported || pkt.PictureIDMask() == 0 {
 		return nil, false
 	}
-	// Check if temporal layer is requested
-	if pkt.TID > uint8(s.simulcast.currentTempLayer) {
-		skip = true
-		// Increment references to prevent gaps
-		s.simulcast.refTlzi++
-		s.simulcast.refPicID++
-		return
+	h := &s.simulcast
+	mask := pkt.PictureIDMask()
+
+	switch diff := (pkt.PictureID - h.lastInPicID) & mask; {
+	case !h.picIDSet || diff != 0 && diff <= mask/2:
+		// New frame, layers are only switched on frame boundaries
+		h.picIDSet = true
+		h.lastInPicID = pkt.PictureID
+		target := int(atomic.LoadInt32(&h.targetTempLayer))
+		switch {
+		case pkt.IsKeyFrame || target < h.currentTempLayer:
+			h.currentTempLayer = target
+		case int(pkt.TID) == h.currentTempLayer+1 && pkt.LayerSync && int(pkt.TID) <= target:
+			h.currentTempLayer++
+		}
+		h.dropFrame = int(pkt.TID) > h.currentTempLayer
+		if h.dropFrame {
+			h.refPicID++
+		}
+		skip = h.dropFrame
+	case diff == 0:
+		skip = h.dropFrame
+	default:
+		// Retransmission of an older frame
+		if int(pkt.TID) > h.currentTempLayer {
+			return nil, true
+		}
+		payload = make([]byte, len(pl))
+		copy(payload, pl)
+		pkt.WriteHeader(payload, pkt.PictureID-h.refPicID, pkt.TL0PICIDX-h.refTlzi)
+		return payload, false
+	}
+	if skip {
+		return nil, true
 	}
+
 	// If we are here modify payload
 	payload = make([]byte, len(pl))
 	copy(payload, pl)
-	// Modify last zero index
-	if pkt.tlzIdx > 0 {
-		s.simulcast.lastTlzi = pkt.TL0PICIDX - s.simulcast.refTlzi
-		payload[pkt.tlzIdx] = s.simulcast.lastTlzi
-	}
-	if pkt.picIDIdx > 0 {
-		s.simulcast.lastPicID = pkt.PictureID - s.simulcast.refPicID
-		pid := make([]byte, 2)
-		binary.BigEndian.PutUint16(pid, s.simulcast.lastPicID)
-		payload[pkt.picIDIdx] = pid[0]
-		if pkt.mBit {
-			payload[pkt.picIDIdx] |= 0x80
-			payload[pkt.picIDIdx+1] = pid[1]
-		}
+	h.lastPicID = (pkt.PictureID - h.refPicID) & mask
+	if pkt.HasTL0PICIDX() {
+		h.lastTlzi = pkt.TL0PICIDX - h.refTlzi
 	}
+	pkt.WriteHeader(payload, h.lastPicID, h.lastTlzi)
 	return
 }
 
-// isH264Keyframe detects if h264 payload is a keyframe
-// this code was taken from https://github.com/jech/galene/blob/codecs/rtpconn/rtpreader.go#L45
-// all credits belongs to Juliusz Chroboczek @jech and the awesome Galene SFU
-func isH264Keyframe(payload []byte) bool {
-	if len(payload) < 1 {
-		return false
-	}
-	nalu := payload[0] & 0x1F
-	if nalu == 0 {
-		// reserved
-		return false
-	} else if nalu <= 23 {
-		// simple NALU
-		return nalu == 5
-	} else if nalu == 24 || nalu == 25 || nalu == 26 || nalu == 27 {
-		// STAP-A, STAP-B, MTAP16 or MTAP24
-		i := 1
-		if nalu == 25 || nalu == 26 || nalu == 27 {
-			// skip DON
-			i += 2
-		}
-		for i < len(payload) {
-			if i+2 > len(payload) {
-				return false
-			}
-			length := uint16(payload[i])<<8 |
-				uint16(payload[i+1])
-			i += 2
-			if i+int(length) > len(payload) {
-				return false
-			}
-			offset := 0
-			if nalu == 26 {
-				offset = 3
-			} else if nalu == 27 {
-				offset = 4
-			}
-			if offset >= int(length) {
-				return false
-			}
-			n := payload[i+offset] & 0x1F
-			if n == 5 {
-				return true
-			} else if n >= 24 {
-				// is this legal?
-				log.Warnf("Non-simple NALU within a STAP")
-			}
-			i += int(length)
-		}
-		if i == len(payload) {
-			return false
-		}
-		return false
-	} else if nalu == 28 || nalu == 29 {
-		// FU-A or FU-B
-		if len(payload) < 2 {
-			return false
-		}
-		if (payload[1] & 0x80) == 0 {
-			// not a starting fragment
-			return false
-		}
-		return payload[1]&0x1F == 5
+// isKeyframe detects if the payload starts a keyframe of the codec, false
+// for codecs without keyframe detection
+func isKeyframe(mime string, payload []byte) bool {
+	switch strings.ToLower(mime) {
+	case "video/vp8":
+		vp8Packet := VP8Helper{}
+		return vp8Packet.Unmarshal(payload) == nil && vp8Packet.IsKeyFrame
+	case "video/vp9":
+		return buffer.IsVP9Keyframe(payload)
+	case "video/h264":
+		return buffer.IsH264Keyframe(payload)
 	}
 	return false
 }
@@ -232,6 +108,18 @@ func timeToNtp(ns int64) uint64 {
 	return seconds<<32 | fraction
 }
 
+func ntpToTime(ntp uint64) int64 {
+	seconds := int64(ntp>>32) - ntpEpoch
+	nanos := int64((ntp & 0xffffffff) * 1e9 >> 32)
+	return seconds*1e9 + nanos
+}
+
+// rtpToTime returns the publisher time in ns of a RTP timestamp of the
+// track, according its sender report
+func rtpToTime(sr buffer.SenderReportData, ts uint32, clock rtpClock) int64 {
+	return ntpToTime(sr.NTPTime) + int64(clock.duration(int32(ts-sr.RTPTime)))
+}
+
 // Do a fuzzy find for a codec in the list of codecs
 // Used for lookup up a codec in an existing list to find a match
 func codecParametersFuzzySearch(needle webrtc.RTPCodecParameters, haystack []webrtc.RTPCodecParameters) (webrtc.RTPCodecParameters, error) {
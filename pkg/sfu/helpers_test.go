@@ -5,101 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestVP8Helper_Unmarshal(t *testing.T) {
-	type args struct {
-		payload []byte
-	}
-	tests := []struct {
-		name            string
-		args            args
-		wantErr         bool
-		checkTemporal   bool
-		temporalSupport bool
-		checkKeyFrame   bool
-		keyFrame        bool
-		checkPictureID  bool
-		pictureID       uint16
-		checkTlzIdx     bool
-		tlzIdx          uint8
-		checkTempID     bool
-		temporalID      uint8
-	}{
-		{
-			name:    "Empty or nil payload must return error",
-			args:    args{payload: []byte{}},
-			wantErr: true,
-		},
-		{
-			name:    "Small payloads must return errors",
-			args:    args{payload: []byte{0x0, 0x1, 0x2}},
-			wantErr: true,
-		},
-		{
-			name:            "Temporal must be supported by setting T bit to 1",
-			args:            args{payload: []byte{0xff, 0x20, 0x1, 0x2, 0x3, 0x4}},
-			checkTemporal:   true,
-			temporalSupport: true,
-		},
-		{
-			name:           "Picture must be ID 7 bits by setting M bit to 0 and present by I bit set to 1",
-			args:           args{payload: []byte{0xff, 0xff, 0x11, 0x2, 0x3, 0x4}},
-			checkPictureID: true,
-			pictureID:      17,
-		},
-		{
-			name:           "Picture ID must be 15 bits by setting M bit to 1 and present by I bit set to 1",
-			args:           args{payload: []byte{0xff, 0xff, 0x92, 0x67, 0x3, 0x4, 0x5}},
-			checkPictureID: true,
-			pictureID:      4711,
-		},
-		{
-			name:        "Temporal level zero index must be present if L set to 1",
-			args:        args{payload: []byte{0xff, 0xff, 0xff, 0xfd, 0xb4, 0x4, 0x5}},
-			checkTlzIdx: true,
-			tlzIdx:      180,
-		},
-		{
-			name:        "Temporal index must be present and used if T bit set to 1",
-			args:        args{payload: []byte{0xff, 0xff, 0xff, 0xfd, 0xb4, 0x9f, 0x5, 0x6}},
-			checkTempID: true,
-			temporalID:  2,
-		},
-		{
-			name:          "Check if packet is a keyframe by looking at P bit set to 0",
-			args:          args{payload: []byte{0xff, 0xff, 0xff, 0xfd, 0xb4, 0x9f, 0x94, 0x1}},
-			checkKeyFrame: true,
-			keyFrame:      true,
-		},
-	}
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			p := &VP8Helper{}
-			if err := p.Unmarshal(tt.args.payload); (err != nil) != tt.wantErr {
-				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
-			}
-			if tt.checkTemporal {
-				assert.Equal(t, tt.temporalSupport, p.TemporalSupported)
-			}
-			if tt.checkKeyFrame {
-				assert.Equal(t, tt.keyFrame, p.IsKeyFrame)
-			}
-			if tt.checkPictureID {
-				assert.Equal(t, tt.pictureID, p.PictureID)
-			}
-			if tt.checkTlzIdx {
-				assert.Equal(t, tt.tlzIdx, p.TL0PICIDX)
-			}
-			if tt.checkTempID {
-				assert.Equal(t, tt.temporalID, p.TID)
-			}
-		})
-	}
-}
-
 func Test_setVP8TemporalLayer(t *testing.T) {
 	type args struct {
 		pl []byte
@@ -119,6 +28,7 @@ func Test_setVP8TemporalLayer(t *testing.T) {
 					simulcast: simulcastTrackHelpers{
 						refPicID:         0,
 						currentTempLayer: 2,
+						targetTempLayer:  2,
 						lastPicID:        0,
 						refTlzi:          0,
 						lastTlzi:         0,
@@ -137,6 +47,7 @@ func Test_setVP8TemporalLayer(t *testing.T) {
 					simulcast: simulcastTrackHelpers{
 						refPicID:         32764,
 						currentTempLayer: 3,
+						targetTempLayer:  3,
 						refTlzi:          179,
 					},
 				},
@@ -160,6 +71,122 @@ func Test_setVP8TemporalLayer(t *testing.T) {
 	}
 }
 
+// vp8Payload returns a VP8 payload with 15 bits, or 7 bits if short is
+// set, PictureID, TL0PICIDX and TID/Y fields.
+func vp8Payload(picID uint16, short bool, tl0PicIdx, tid uint8, sync, keyFrame bool) []byte {
+	pl := []byte{0x90, 0xe0}
+	if short {
+		pl = append(pl, byte(picID)&0x7f)
+	} else {
+		pl = append(pl, byte(picID>>8)|0x80, byte(picID))
+	}
+	tidY := tid << 6
+	if sync {
+		tidY |= 0x20
+	}
+	pl = append(pl, tl0PicIdx, tidY)
+	if keyFrame {
+		return append(pl, 0x0, 0x0)
+	}
+	return append(pl, 0x1, 0x0)
+}
+
+func Test_setVP8TemporalLayer_Switching(t *testing.T) {
+	type frame struct {
+		picID     uint16
+		tl0PicIdx uint8
+		tid       uint8
+		sync      bool
+		target    int
+		skip      bool
+		// rewritten values
+		picID2     uint16
+		tl0PicIdx2 uint8
+	}
+	tests := []struct {
+		name   string
+		short  bool
+		frames []frame
+	}{
+		{
+			name: "Must drop upper layers without gaps across 15 bits PictureID wraparound",
+			frames: []frame{
+				{picID: 0x7ffe, tl0PicIdx: 254, tid: 0, target: 1, picID2: 0x7ffe, tl0PicIdx2: 254},
+				{picID: 0x7fff, tl0PicIdx: 254, tid: 2, target: 1, skip: true},
+				{picID: 0x0000, tl0PicIdx: 254, tid: 1, target: 1, picID2: 0x7fff, tl0PicIdx2: 254},
+				{picID: 0x0001, tl0PicIdx: 254, tid: 2, target: 1, skip: true},
+				{picID: 0x0002, tl0PicIdx: 255, tid: 0, target: 1, picID2: 0x0000, tl0PicIdx2: 255},
+				{picID: 0x0003, tl0PicIdx: 255, tid: 2, target: 1, skip: true},
+				{picID: 0x0004, tl0PicIdx: 255, tid: 1, target: 1, picID2: 0x0001, tl0PicIdx2: 255},
+				{picID: 0x0005, tl0PicIdx: 255, tid: 2, target: 1, skip: true},
+				{picID: 0x0006, tl0PicIdx: 0, tid: 0, target: 1, picID2: 0x0002, tl0PicIdx2: 0},
+			},
+		},
+		{
+			name:  "Must drop upper layers without gaps across 7 bits PictureID wraparound",
+			short: true,
+			frames: []frame{
+				{picID: 0x7e, tl0PicIdx: 10, tid: 0, target: 0, picID2: 0x7e, tl0PicIdx2: 10},
+				{picID: 0x7f, tl0PicIdx: 10, tid: 1, target: 0, skip: true},
+				{picID: 0x00, tl0PicIdx: 11, tid: 0, target: 0, picID2: 0x7f, tl0PicIdx2: 11},
+				{picID: 0x01, tl0PicIdx: 11, tid: 1, target: 0, skip: true},
+				{picID: 0x02, tl0PicIdx: 12, tid: 0, target: 0, picID2: 0x00, tl0PicIdx2: 12},
+			},
+		},
+		{
+			name: "Must switch up one layer at a time only on layer sync frames",
+			frames: []frame{
+				{picID: 100, tl0PicIdx: 1, tid: 0, target: 0, picID2: 100, tl0PicIdx2: 1},
+				{picID: 101, tl0PicIdx: 1, tid: 2, target: 2, skip: true},
+				{picID: 102, tl0PicIdx: 1, tid: 1, target: 2, skip: true},
+				{picID: 103, tl0PicIdx: 1, tid: 2, sync: true, target: 2, skip: true},
+				{picID: 104, tl0PicIdx: 2, tid: 0, target: 2, picID2: 101, tl0PicIdx2: 2},
+				{picID: 105, tl0PicIdx: 2, tid: 1, sync: true, target: 2, picID2: 102, tl0PicIdx2: 2},
+				{picID: 106, tl0PicIdx: 2, tid: 2, sync: true, target: 2, picID2: 103, tl0PicIdx2: 2},
+				{picID: 107, tl0PicIdx: 2, tid: 1, target: 0, skip: true},
+				{picID: 108, tl0PicIdx: 3, tid: 0, target: 0, picID2: 104, tl0PicIdx2: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dt := &DownTrack{mime: "video/vp8", simulcast: simulcastTrackHelpers{currentTempLayer: maxTemporalLayer}}
+			for i, f := range tt.frames {
+				dt.SwitchTemporalLayer(f.target)
+				// every frame is sent in two packets
+				for p := 0; p < 2; p++ {
+					payload, skip := setVP8TemporalLayer(vp8Payload(f.picID, tt.short, f.tl0PicIdx, f.tid, f.sync, false), dt)
+					assert.Equal(t, f.skip, skip, "frame %d", i)
+					if skip {
+						continue
+					}
+					var pkt VP8Helper
+					assert.NoError(t, pkt.Unmarshal(payload))
+					assert.Equal(t, f.picID2, pkt.PictureID, "frame %d", i)
+					assert.Equal(t, f.tl0PicIdx2, pkt.TL0PICIDX, "frame %d", i)
+				}
+			}
+		})
+	}
+}
+
+func Test_resyncVP8(t *testing.T) {
+	h := simulcastTrackHelpers{lastPicID: 0x7fff, lastTlzi: 255, targetTempLayer: maxTemporalLayer, currentTempLayer: maxTemporalLayer}
+	var key VP8Helper
+	assert.NoError(t, key.Unmarshal(vp8Payload(500, false, 40, 0, false, true)))
+	assert.True(t, key.IsKeyFrame)
+	h.resyncVP8(&key)
+
+	dt := &DownTrack{mime: "video/vp8", simulcast: h}
+	payload, skip := setVP8TemporalLayer(vp8Payload(500, false, 40, 0, false, true), dt)
+	assert.False(t, skip)
+	var pkt VP8Helper
+	assert.NoError(t, pkt.Unmarshal(payload))
+	assert.Equal(t, uint16(0), pkt.PictureID)
+	assert.Equal(t, uint8(0), pkt.TL0PICIDX)
+}
+
 func Test_timeToNtp(t *testing.T) {
 	type args struct {
 		ns int64
@@ -187,3 +214,42 @@ func Test_timeToNtp(t *testing.T) {
 		})
 	}
 }
+
+func Test_ntpToTime(t *testing.T) {
+	ns := time.Unix(1602391458, 1234).UnixNano()
+	// The NTP fraction has a sub nanosecond resolution
+	assert.InDelta(t, ns, ntpToTime(timeToNtp(ns)), 1)
+}
+
+func Test_rtpToTime(t *testing.T) {
+	sr := buffer.SenderReportData{
+		RTPTime: 4294967000,
+		NTPTime: timeToNtp(time.Unix(1602391458, 0).UnixNano()),
+	}
+	tests := []struct {
+		name      string
+		ts        uint32
+		clockRate uint32
+		want      time.Duration
+	}{
+		{name: "At the report", ts: 4294967000, clockRate: 90000},
+		{name: "After the report across the wraparound", ts: 89704, clockRate: 90000, want: time.Second},
+		{name: "Before the report", ts: 4294967000 - 480, clockRate: 48000, want: -10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := rtpToTime(sr, tt.ts, rtpClock{rate: tt.clockRate}) - time.Unix(1602391458, 0).UnixNano()
+			assert.InDelta(t, int64(tt.want), got, 1)
+		})
+	}
+}
+
+func Test_ridLayer(t *testing.T) {
+	for rid, layer := range map[string]int{"q": 0, "h": 1, "f": 2, "0": 0, "1": 1, "2": 2, "7": 2, "low": 0, "mid": 1, "high": 2, "": 0} {
+		assert.Equal(t, layer, ridLayer(rid, maxSimulcastLayers), rid)
+	}
+	// Layers are capped to the RIDs declared
+	assert.Equal(t, 1, ridLayer("f", 2))
+	assert.Equal(t, 0, ridLayer("7", 0))
+}
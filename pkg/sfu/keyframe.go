@@ -0,0 +1,162 @@
+package sfu
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/pion/ion-log"
+	"github.com/pion/rtcp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultPLIInterval = 500
+	defaultFIRInterval = 1000
+
+	// keyframeRequesterSFU is the requester of the keyframes asked by the
+	// SFU itself, e.g. after too many NACKs or dropped packets
+	keyframeRequesterSFU = "sfu"
+)
+
+var keyframeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sfu",
+	Subsystem: "receiver",
+	Name:      "keyframe_requests_total",
+	Help:      "Keyframe requests for publisher tracks, sent or coalesced with a request already sent.",
+}, []string{"type", "result"})
+
+func init() {
+	prometheus.MustRegister(keyframeRequests)
+}
+
+// KeyframeConfig defines the keyframe requests sent to the publishers
+type KeyframeConfig struct {
+	// PLIInterval is the min interval in ms between PLIs sent for a track
+	PLIInterval int `mapstructure:"pliinterval"`
+	// FIRInterval is the min interval in ms between FIRs sent for a track,
+	// FIRs are sent when a subscriber asks one and the publisher supports it
+	FIRInterval int `mapstructure:"firinterval"`
+}
+
+type keyframeState struct {
+	lastPLI    time.Time
+	lastFIR    time.Time
+	pendingPLI bool
+	pendingFIR bool
+	firSN      uint8
+}
+
+// keyframeRequester throttles the keyframe requests of a publisher track by
+// SSRC, the requests received before the min interval elapsed are coalesced
+// into one sent once it elapses.
+type keyframeRequester struct {
+	sync.Mutex
+	pliInterval time.Duration
+	firInterval time.Duration
+	fir         bool
+	closed      bool
+	send        func([]rtcp.Packet)
+	states      map[uint32]*keyframeState
+	requesters  map[string]uint64
+}
+
+func newKeyframeRequester(c KeyframeConfig, fir bool, send func([]rtcp.Packet)) *keyframeRequester {
+	k := &keyframeRequester{
+		pliInterval: time.Duration(c.PLIInterval) * time.Millisecond,
+		firInterval: time.Duration(c.FIRInterval) * time.Millisecond,
+		fir:         fir,
+		send:        send,
+		states:      make(map[uint32]*keyframeState),
+		requesters:  make(map[string]uint64),
+	}
+	if k.pliInterval <= 0 {
+		k.pliInterval = defaultPLIInterval * time.Millisecond
+	}
+	if k.firInterval <= 0 {
+		k.firInterval = defaultFIRInterval * time.Millisecond
+	}
+	return k
+}
+
+// request asks a keyframe of the ssrc for the requester, with a FIR if
+// asked and supported by the publisher or with a PLI otherwise.
+func (k *keyframeRequester) request(requester string, ssrc uint32, fir bool) {
+	k.Lock()
+	defer k.Unlock()
+	if k.closed {
+		return
+	}
+	fir = fir && k.fir
+	k.requesters[requester]++
+	s := k.states[ssrc]
+	if s == nil {
+		s = &keyframeState{}
+		k.states[ssrc] = s
+	}
+
+	kind, last, interval, pending := "pli", &s.lastPLI, k.pliInterval, &s.pendingPLI
+	if fir {
+		kind, last, interval, pending = "fir", &s.lastFIR, k.firInterval, &s.pendingFIR
+	}
+	if wait := interval - time.Since(*last); wait > 0 {
+		keyframeRequests.WithLabelValues(kind, "coalesced").Inc()
+		if !*pending {
+			*pending = true
+			time.AfterFunc(wait, func() {
+				k.flush(ssrc, fir)
+			})
+		}
+		return
+	}
+	k.sendRequest(ssrc, s, fir)
+}
+
+// flush sends a request coalesced while throttled
+func (k *keyframeRequester) flush(ssrc uint32, fir bool) {
+	k.Lock()
+	defer k.Unlock()
+	s := k.states[ssrc]
+	if k.closed || s == nil {
+		return
+	}
+	if fir && s.pendingFIR || !fir && s.pendingPLI {
+		k.sendRequest(ssrc, s, fir)
+	}
+}
+
+func (k *keyframeRequester) sendRequest(ssrc uint32, s *keyframeState, fir bool) {
+	if fir {
+		s.lastFIR = time.Now()
+		s.pendingFIR = false
+		// A new request uses a new sequence number, RFC 5104 section 4.3.1
+		s.firSN++
+		keyframeRequests.WithLabelValues("fir", "sent").Inc()
+		k.send([]rtcp.Packet{&rtcp.FullIntraRequest{
+			SenderSSRC: ssrc,
+			FIR:        []rtcp.FIREntry{{SSRC: ssrc, SequenceNumber: s.firSN}},
+		}})
+		return
+	}
+	s.lastPLI = time.Now()
+	s.pendingPLI = false
+	keyframeRequests.WithLabelValues("pli", "sent").Inc()
+	k.send([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: ssrc, MediaSSRC: ssrc}})
+}
+
+// counts returns the keyframes asked by requester
+func (k *keyframeRequester) counts() map[string]uint64 {
+	k.Lock()
+	defer k.Unlock()
+	counts := make(map[string]uint64, len(k.requesters))
+	for requester, n := range k.requesters {
+		counts[requester] = n
+	}
+	return counts
+}
+
+func (k *keyframeRequester) stop() {
+	k.Lock()
+	k.closed = true
+	k.Unlock()
+	log.Debugf("Keyframe requests by requester: %v", k.counts())
+}
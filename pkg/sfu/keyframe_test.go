@@ -0,0 +1,74 @@
+package sfu
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentRTCP struct {
+	sync.Mutex
+	pkts []rtcp.Packet
+}
+
+func (s *sentRTCP) send(pkts []rtcp.Packet) {
+	s.Lock()
+	s.pkts = append(s.pkts, pkts...)
+	s.Unlock()
+}
+
+func (s *sentRTCP) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.pkts)
+}
+
+func Test_keyframeRequester(t *testing.T) {
+	sent := &sentRTCP{}
+	k := newKeyframeRequester(KeyframeConfig{PLIInterval: 50, FIRInterval: 50}, true, sent.send)
+
+	// Requests of many subscribers are coalesced
+	k.request("peer1", 1234, false)
+	k.request("peer2", 1234, false)
+	k.request("peer3", 1234, false)
+	assert.Equal(t, 1, sent.count())
+	// Layers are throttled separately
+	k.request("peer1", 5678, false)
+	assert.Equal(t, 2, sent.count())
+	// Coalesced requests are sent once the interval elapsed
+	assert.Eventually(t, func() bool { return sent.count() == 3 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 3, sent.count())
+
+	assert.Equal(t, map[string]uint64{"peer1": 2, "peer2": 1, "peer3": 1}, k.counts())
+
+	k.stop()
+	k.request("peer1", 1234, false)
+	assert.Equal(t, 3, sent.count())
+}
+
+func Test_keyframeRequesterFIR(t *testing.T) {
+	sent := &sentRTCP{}
+	k := newKeyframeRequester(KeyframeConfig{FIRInterval: 1}, true, sent.send)
+
+	k.request("peer1", 1234, true)
+	time.Sleep(5 * time.Millisecond)
+	k.request("peer1", 1234, true)
+	assert.Equal(t, 2, sent.count())
+	for i, pkt := range sent.pkts {
+		fir, ok := pkt.(*rtcp.FullIntraRequest)
+		assert.True(t, ok)
+		assert.Equal(t, []rtcp.FIREntry{{SSRC: 1234, SequenceNumber: uint8(i + 1)}}, fir.FIR)
+	}
+
+	// PLIs are sent to publishers without FIR support
+	sent = &sentRTCP{}
+	k = newKeyframeRequester(KeyframeConfig{}, false, sent.send)
+	k.request("peer1", 1234, true)
+	assert.Equal(t, 1, sent.count())
+	_, ok := sent.pkts[0].(*rtcp.PictureLossIndication)
+	assert.True(t, ok)
+}
@@ -0,0 +1,67 @@
+package sfu
+
+import (
+	"github.com/pion/rtp"
+)
+
+const defaultKeyframeCacheSize = 200
+
+// KeyframeCacheConfig defines the video packets cached by layer to start
+// new subscribers without requesting a keyframe to the publisher
+type KeyframeCacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxPackets cached since the last keyframe, the cache is invalid until
+	// the next keyframe when more packets are received
+	MaxPackets int `mapstructure:"maxpackets"`
+}
+
+// keyframeCache keeps the packets of a layer from its last keyframe, so a
+// new down track can decode from the cached packets and continue with the
+// live ones.
+type keyframeCache struct {
+	mime       string
+	maxPackets int
+	valid      bool
+	packets    []rtp.Packet
+}
+
+func newKeyframeCache(mime string, c KeyframeCacheConfig) *keyframeCache {
+	maxPackets := c.MaxPackets
+	if maxPackets <= 0 {
+		maxPackets = defaultKeyframeCacheSize
+	}
+	// Cached packets have to fit in the down track queue
+	if maxPackets > downTrackQueueSize {
+		maxPackets = downTrackQueueSize
+	}
+	return &keyframeCache{
+		mime:       mime,
+		maxPackets: maxPackets,
+	}
+}
+
+func (c *keyframeCache) push(pkt rtp.Packet) {
+	// A keyframe can start with several packets, e.g. the h264 SPS and
+	// PPS before the IDR, so only a new timestamp resets the cache.
+	if isKeyframe(c.mime, pkt.Payload) && (!c.valid || len(c.packets) == 0 || c.packets[0].Timestamp != pkt.Timestamp) {
+		c.packets = c.packets[:0]
+		c.valid = true
+	}
+	if !c.valid {
+		return
+	}
+	if len(c.packets) >= c.maxPackets {
+		c.packets = c.packets[:0]
+		c.valid = false
+		return
+	}
+	c.packets = append(c.packets, pkt)
+}
+
+// get returns the cached packets, nil if no keyframe is cached
+func (c *keyframeCache) get() []rtp.Packet {
+	if !c.valid {
+		return nil
+	}
+	return c.packets
+}
@@ -0,0 +1,94 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keyframeCache(t *testing.T) {
+	vp8Key := []byte{0x10, 0x00, 0x00, 0x00}
+	vp8Delta := []byte{0x10, 0x01, 0x00, 0x00}
+	h264SPS := []byte{0x67}
+	h264PPS := []byte{0x68}
+	h264IDR := []byte{0x65}
+	h264Slice := []byte{0x41}
+
+	type packet struct {
+		ts      uint32
+		payload []byte
+	}
+	tests := []struct {
+		name    string
+		mime    string
+		max     int
+		packets []packet
+		want    []uint16
+	}{
+		{
+			name:    "Must cache nothing before a keyframe",
+			mime:    webrtc.MimeTypeVP8,
+			packets: []packet{{1, vp8Delta}, {2, vp8Delta}},
+		},
+		{
+			name:    "Must cache from the last keyframe",
+			mime:    webrtc.MimeTypeVP8,
+			packets: []packet{{1, vp8Key}, {2, vp8Delta}, {3, vp8Key}, {3, vp8Delta}, {4, vp8Delta}},
+			want:    []uint16{2, 3, 4},
+		},
+		{
+			name:    "Must keep the h264 parameter sets of a keyframe",
+			mime:    webrtc.MimeTypeH264,
+			packets: []packet{{1, h264Slice}, {2, h264SPS}, {2, h264PPS}, {2, h264IDR}, {3, h264Slice}},
+			want:    []uint16{1, 2, 3, 4},
+		},
+		{
+			name:    "Must skip the cache when too many packets follow a keyframe",
+			mime:    webrtc.MimeTypeVP8,
+			max:     3,
+			packets: []packet{{1, vp8Key}, {2, vp8Delta}, {3, vp8Delta}, {4, vp8Delta}, {5, vp8Delta}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newKeyframeCache(tt.mime, KeyframeCacheConfig{Enabled: true, MaxPackets: tt.max})
+			for i, p := range tt.packets {
+				c.push(rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i), Timestamp: p.ts}, Payload: p.payload})
+			}
+			var sns []uint16
+			for _, pkt := range c.get() {
+				sns = append(sns, pkt.SequenceNumber)
+			}
+			assert.Equal(t, tt.want, sns)
+		})
+	}
+}
+
+func TestWebRTCReceiver_WriteKeyframeCache(t *testing.T) {
+	w := &WebRTCReceiver{
+		kind:          webrtc.RTPCodecTypeVideo,
+		codec:         webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}},
+		keyframeCache: KeyframeCacheConfig{Enabled: true},
+	}
+	w.caches = []*keyframeCache{newKeyframeCache(webrtc.MimeTypeVP8, w.keyframeCache)}
+	w.downTracks = [][]*DownTrack{{}}
+
+	dt := &DownTrack{
+		codec: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8},
+		queue: make(chan rtp.Packet, downTrackQueueSize),
+		done:  make(chan struct{}),
+	}
+	dt.bound.set(true)
+	dt.enabled.set(true)
+	dt.queueOnce.Do(func() {})
+	assert.False(t, w.WriteKeyframeCache(dt))
+
+	w.caches[0].push(rtp.Packet{Header: rtp.Header{SequenceNumber: 1, Timestamp: 1}, Payload: []byte{0x10, 0x00, 0x00, 0x00}})
+	w.caches[0].push(rtp.Packet{Header: rtp.Header{SequenceNumber: 2, Timestamp: 2}, Payload: []byte{0x10, 0x01, 0x00, 0x00}})
+	assert.True(t, w.WriteKeyframeCache(dt))
+	assert.Equal(t, 2, len(dt.queue))
+	assert.Equal(t, uint16(1), (<-dt.queue).SequenceNumber)
+}
@@ -1,6 +1,8 @@
 package sfu
 
 import (
+	"strings"
+
 	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 )
@@ -12,17 +14,25 @@ const (
 	mimeTypeVP9  = "video/vp9"
 )
 
-func getPublisherMediaEngine() (*webrtc.MediaEngine, error) {
-	me := &webrtc.MediaEngine{}
-	if err := me.RegisterCodec(webrtc.RTPCodecParameters{
-		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1", RTCPFeedback: nil},
-		PayloadType:        111,
-	}, webrtc.RTPCodecTypeAudio); err != nil {
-		return nil, err
-	}
+// CodecConfig defines the codecs negotiated with the publishers
+type CodecConfig struct {
+	// Audio and Video are the mime types negotiated in preference order,
+	// e.g. ["video/H264", "video/VP8"], empty negotiates every supported codec.
+	Audio []string `mapstructure:"audio"`
+	Video []string `mapstructure:"video"`
+	// RejectUnsupported rejects published tracks that some subscribers of
+	// the session can't decode, otherwise those subscribers are skipped.
+	RejectUnsupported bool `mapstructure:"rejectunsupported"`
+}
 
-	videoRTCPFeedback := []webrtc.RTCPFeedback{{"goog-remb", ""}, {"ccm", "fir"}, {"nack", ""}, {"nack", "pli"}}
-	for _, codec := range []webrtc.RTPCodecParameters{
+var (
+	videoRTCPFeedback = []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}}
+	// publisherCodecs are the codecs supported by the sfu in default order
+	publisherCodecs = []webrtc.RTPCodecParameters{
+		{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1", RTCPFeedback: nil},
+			PayloadType:        111,
+		},
 		{
 			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeVP8, ClockRate: 90000, RTCPFeedback: videoRTCPFeedback},
 			PayloadType:        96,
@@ -55,9 +65,72 @@ func getPublisherMediaEngine() (*webrtc.MediaEngine, error) {
 			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032", RTCPFeedback: videoRTCPFeedback},
 			PayloadType:        123,
 		},
-	} {
-		if err := me.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
-			return nil, err
+	}
+)
+
+// validate checks every configured codec is supported
+func (c *CodecConfig) validate() error {
+	for _, mime := range append(append([]string{}, c.Audio...), c.Video...) {
+		if len(codecsByMime(mime)) == 0 {
+			return errUnsupportedCodec
+		}
+	}
+	return nil
+}
+
+func codecsByMime(mime string) []webrtc.RTPCodecParameters {
+	var codecs []webrtc.RTPCodecParameters
+	for _, codec := range publisherCodecs {
+		if strings.EqualFold(codec.MimeType, mime) {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+// preferredCodecs returns the supported codecs of the given kind ordered by
+// the codec config, codecs missing in allowed are removed if it isn't empty.
+func preferredCodecs(c CodecConfig, kind webrtc.RTPCodecType, allowed []string) []webrtc.RTPCodecParameters {
+	prefs := c.Video
+	if kind == webrtc.RTPCodecTypeAudio {
+		prefs = c.Audio
+	}
+
+	var codecs []webrtc.RTPCodecParameters
+	if len(prefs) == 0 {
+		for _, codec := range publisherCodecs {
+			if strings.HasPrefix(codec.MimeType, kind.String()+"/") {
+				codecs = append(codecs, codec)
+			}
+		}
+	} else {
+		for _, mime := range prefs {
+			codecs = append(codecs, codecsByMime(mime)...)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return codecs
+	}
+	filtered := codecs[:0]
+	for _, codec := range codecs {
+		for _, mime := range allowed {
+			if strings.EqualFold(codec.MimeType, mime) {
+				filtered = append(filtered, codec)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func getPublisherMediaEngine(c CodecConfig, allowed []string) (*webrtc.MediaEngine, error) {
+	me := &webrtc.MediaEngine{}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		for _, codec := range preferredCodecs(c, kind, allowed) {
+			if err := me.RegisterCodec(codec, kind); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -84,3 +157,33 @@ func getSubscriberMediaEngine() (*webrtc.MediaEngine, error) {
 	me := &webrtc.MediaEngine{}
 	return me, nil
 }
+
+// sdpCodecs returns the mime types of the codecs in the description, in
+// lower case. Returns nil if the description has no audio or video.
+func sdpCodecs(desc webrtc.SessionDescription) map[string]struct{} {
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return nil
+	}
+	var codecs map[string]struct{}
+	for _, md := range parsed.MediaDescriptions {
+		kind := md.MediaName.Media
+		if kind != webrtc.RTPCodecTypeAudio.String() && kind != webrtc.RTPCodecTypeVideo.String() {
+			continue
+		}
+		for _, a := range md.Attributes {
+			if a.Key != "rtpmap" {
+				continue
+			}
+			fields := strings.Fields(a.Value)
+			if len(fields) != 2 {
+				continue
+			}
+			if codecs == nil {
+				codecs = make(map[string]struct{})
+			}
+			codecs[strings.ToLower(kind+"/"+strings.Split(fields[1], "/")[0])] = struct{}{}
+		}
+	}
+	return codecs
+}
@@ -0,0 +1,87 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func mimeTypes(codecs []webrtc.RTPCodecParameters) []string {
+	var mimes []string
+	for _, c := range codecs {
+		if len(mimes) == 0 || mimes[len(mimes)-1] != c.MimeType {
+			mimes = append(mimes, c.MimeType)
+		}
+	}
+	return mimes
+}
+
+func Test_preferredCodecs(t *testing.T) {
+	type args struct {
+		c       CodecConfig
+		kind    webrtc.RTPCodecType
+		allowed []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "Must return every video codec by default",
+			args: args{kind: webrtc.RTPCodecTypeVideo},
+			want: []string{mimeTypeVP8, mimeTypeVP9, mimeTypeH264},
+		},
+		{
+			name: "Must order codecs by preference",
+			args: args{c: CodecConfig{Video: []string{"video/H264", "video/VP8"}}, kind: webrtc.RTPCodecTypeVideo},
+			want: []string{mimeTypeH264, mimeTypeVP8},
+		},
+		{
+			name: "Must remove codecs not allowed",
+			args: args{c: CodecConfig{Video: []string{"video/H264", "video/VP8"}}, kind: webrtc.RTPCodecTypeVideo, allowed: []string{"audio/opus", "video/vp8"}},
+			want: []string{mimeTypeVP8},
+		},
+		{
+			name: "Must return audio codecs",
+			args: args{kind: webrtc.RTPCodecTypeAudio},
+			want: []string{mimeTypeOpus},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mimeTypes(preferredCodecs(tt.args.c, tt.args.kind, tt.args.allowed)))
+		})
+	}
+}
+
+func TestCodecConfig_validate(t *testing.T) {
+	assert.NoError(t, (&CodecConfig{Audio: []string{"audio/opus"}, Video: []string{"video/VP9"}}).validate())
+	assert.Equal(t, errUnsupportedCodec, (&CodecConfig{Video: []string{"video/AV1"}}).validate())
+}
+
+func TestSubscriber_canDecode(t *testing.T) {
+	me := webrtc.MediaEngine{}
+	assert.NoError(t, me.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000},
+		PayloadType:        102,
+	}, webrtc.RTPCodecTypeVideo))
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&me))
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo)
+	assert.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+
+	s := &Subscriber{}
+	assert.True(t, s.canDecode(webrtc.MimeTypeVP8))
+	s.setCodecs(sdpCodecs(offer))
+	assert.True(t, s.canDecode(webrtc.MimeTypeH264))
+	assert.False(t, s.canDecode(webrtc.MimeTypeVP8))
+	// audio codecs are unknown
+	assert.True(t, s.canDecode(webrtc.MimeTypeOpus))
+}
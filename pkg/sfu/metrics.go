@@ -0,0 +1,36 @@
+package sfu
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const (
+	// dropped packets reasons
+	dropQueueFull = "queue"
+	dropPacerFull = "pacer"
+)
+
+var (
+	droppedPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sfu",
+		Subsystem: "downtrack",
+		Name:      "dropped_packets_total",
+		Help:      "Packets dropped before being sent to a subscriber.",
+	}, []string{"kind", "reason"})
+
+	dropKeyframeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sfu",
+		Subsystem: "downtrack",
+		Name:      "drop_keyframe_requests_total",
+		Help:      "Video resyncs waiting for a keyframe after dropping packets.",
+	}, []string{"reason"})
+
+	droppedMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sfu",
+		Subsystem: "datachannel",
+		Name:      "dropped_messages_total",
+		Help:      "Data channel messages not relayed by the session policy.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(droppedPackets, dropKeyframeRequests, droppedMessages)
+}
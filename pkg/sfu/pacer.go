@@ -0,0 +1,189 @@
+package sfu
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/pion/ion-log"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	pacerInterval = 5 * time.Millisecond
+	// pacerMaxBurst is the max time worth of bitrate sent at once
+	pacerMaxBurst = 40 * time.Millisecond
+
+	defaultPacerBitrate   = 3000
+	defaultPacerQueueSize = 500
+)
+
+// PacerConfig defines the outbound pacing of the subscribers
+type PacerConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Bitrate is the target output rate of a subscriber in kbps
+	Bitrate uint64 `mapstructure:"bitrate"`
+	// QueueSize is the max packets queued by priority
+	QueueSize int `mapstructure:"queuesize"`
+}
+
+type pacerPriority int
+
+// Packets of a higher priority are sent first
+const (
+	pacerAudio pacerPriority = iota
+	pacerRetransmission
+	pacerVideo
+	pacerPadding
+	pacerPriorities
+)
+
+type pacedPacket struct {
+	stream  webrtc.TrackLocalWriter
+	header  rtp.Header
+	payload []byte
+}
+
+// pacer queues the packets of a subscriber by priority, and sends them
+// to the subscriber at a target rate from its own goroutine, so bursts
+// are smoothed and slow subscribers don't block the publishers fan-out.
+type pacer struct {
+	sync.Mutex
+	queues    [pacerPriorities][]pacedPacket
+	queueSize int
+	bitrate   uint64
+	budget    int64
+	lastSend  time.Time
+	closed    bool
+	notify    chan struct{}
+	done      chan struct{}
+}
+
+func newPacer(c PacerConfig) *pacer {
+	p := &pacer{
+		queueSize: c.QueueSize,
+		bitrate:   c.Bitrate * 1000,
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	if p.queueSize <= 0 {
+		p.queueSize = defaultPacerQueueSize
+	}
+	if p.bitrate == 0 {
+		p.bitrate = defaultPacerBitrate * 1000
+	}
+	go p.run()
+	return p
+}
+
+// enqueue copies the packet to the queue of its priority, the packet is
+// dropped with errPacerQueueFull if the queue is full.
+func (p *pacer) enqueue(stream webrtc.TrackLocalWriter, hdr *rtp.Header, payload []byte, priority pacerPriority) error {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return io.EOF
+	}
+	if len(p.queues[priority]) >= p.queueSize {
+		p.Unlock()
+		return errPacerQueueFull
+	}
+	pkt := pacedPacket{
+		stream:  stream,
+		header:  *hdr,
+		payload: make([]byte, len(payload)),
+	}
+	copy(pkt.payload, payload)
+	if len(hdr.Extensions) > 0 {
+		pkt.header.Extensions = nil
+		for _, id := range hdr.GetExtensionIDs() {
+			if err := pkt.header.SetExtension(id, append([]byte(nil), hdr.GetExtension(id)...)); err != nil {
+				log.Errorf("Copy paced packet extension err %v", err)
+			}
+		}
+	}
+	p.queues[priority] = append(p.queues[priority], pkt)
+	p.Unlock()
+
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// dequeue returns the next packet to send within the budget, audio is
+// sent regardless of the budget.
+func (p *pacer) dequeue() (pacedPacket, bool) {
+	p.Lock()
+	defer p.Unlock()
+	for i := range p.queues {
+		q := p.queues[i]
+		if len(q) == 0 {
+			continue
+		}
+		if pacerPriority(i) != pacerAudio && p.budget <= 0 {
+			return pacedPacket{}, false
+		}
+		pkt := q[0]
+		q[0] = pacedPacket{}
+		p.queues[i] = q[1:]
+		p.budget -= int64(pkt.header.MarshalSize() + len(pkt.payload))
+		return pkt, true
+	}
+	return pacedPacket{}, false
+}
+
+// refill adds the budget earned since the last send
+func (p *pacer) refill(now time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	elapsed := now.Sub(p.lastSend)
+	if p.lastSend.IsZero() || elapsed > pacerMaxBurst {
+		elapsed = pacerMaxBurst
+	}
+	p.lastSend = now
+	maxBudget := int64(p.bitrate) * int64(pacerMaxBurst) / int64(time.Second) / 8
+	p.budget += int64(p.bitrate) * int64(elapsed) / int64(time.Second) / 8
+	if p.budget > maxBudget {
+		p.budget = maxBudget
+	}
+}
+
+func (p *pacer) run() {
+	ticker := time.NewTicker(pacerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.notify:
+		case <-ticker.C:
+		}
+		p.refill(time.Now())
+		for {
+			pkt, ok := p.dequeue()
+			if !ok {
+				break
+			}
+			if _, err := pkt.stream.WriteRTP(&pkt.header, pkt.payload); err != nil && err != io.ErrClosedPipe {
+				log.Errorf("Write paced packet err %v", err)
+			}
+		}
+	}
+}
+
+// stop drops the queued packets and stops sending
+func (p *pacer) stop() {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for i := range p.queues {
+		p.queues[i] = nil
+	}
+	close(p.done)
+}
@@ -0,0 +1,101 @@
+package sfu
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+type pacedWriter struct {
+	sync.Mutex
+	sns []uint16
+}
+
+func (w *pacedWriter) WriteRTP(header *rtp.Header, _ []byte) (int, error) {
+	w.Lock()
+	w.sns = append(w.sns, header.SequenceNumber)
+	w.Unlock()
+	return 0, nil
+}
+
+func (w *pacedWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *pacedWriter) written() []uint16 {
+	w.Lock()
+	defer w.Unlock()
+	return append([]uint16(nil), w.sns...)
+}
+
+func Test_pacerPriority(t *testing.T) {
+	w := &pacedWriter{}
+	p := &pacer{queueSize: 10, bitrate: 1000000}
+	payload := make([]byte, 100)
+	for i, priority := range []pacerPriority{pacerPadding, pacerVideo, pacerRetransmission, pacerAudio, pacerVideo} {
+		assert.NoError(t, p.enqueue(w, &rtp.Header{SequenceNumber: uint16(i)}, payload, priority))
+	}
+
+	// No budget, only audio is sent
+	var sent []uint16
+	for pkt, ok := p.dequeue(); ok; pkt, ok = p.dequeue() {
+		sent = append(sent, pkt.header.SequenceNumber)
+	}
+	assert.Equal(t, []uint16{3}, sent)
+
+	now := time.Now()
+	p.refill(now)
+	for pkt, ok := p.dequeue(); ok; pkt, ok = p.dequeue() {
+		sent = append(sent, pkt.header.SequenceNumber)
+	}
+	assert.Equal(t, []uint16{3, 2, 1, 4, 0}, sent)
+}
+
+func Test_pacerBudget(t *testing.T) {
+	w := &pacedWriter{}
+	p := &pacer{queueSize: 100, bitrate: 800000}
+	payload := make([]byte, 988)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, p.enqueue(w, &rtp.Header{SequenceNumber: uint16(i)}, payload, pacerVideo))
+	}
+	now := time.Now()
+	p.lastSend = now
+	// 10ms at 800kbps is 1000 bytes, one packet
+	p.refill(now.Add(10 * time.Millisecond))
+	count := 0
+	for _, ok := p.dequeue(); ok; _, ok = p.dequeue() {
+		count++
+	}
+	assert.Equal(t, 1, count)
+
+	// Budget is capped to the max burst
+	p.refill(now.Add(time.Second))
+	for _, ok := p.dequeue(); ok; _, ok = p.dequeue() {
+		count++
+	}
+	assert.Equal(t, 5, count)
+}
+
+func Test_pacerQueue(t *testing.T) {
+	w := &pacedWriter{}
+	p := newPacer(PacerConfig{Enabled: true, QueueSize: 2})
+	p.Lock()
+	for i := 0; i < 3; i++ {
+		p.queues[pacerVideo] = append(p.queues[pacerVideo], pacedPacket{stream: w})
+	}
+	p.Unlock()
+	assert.Equal(t, errPacerQueueFull, p.enqueue(w, &rtp.Header{}, nil, pacerVideo))
+
+	assert.NoError(t, p.enqueue(w, &rtp.Header{SequenceNumber: 7}, nil, pacerAudio))
+	assert.Eventually(t, func() bool {
+		sns := w.written()
+		return len(sns) > 0 && sns[0] == 7
+	}, time.Second, pacerInterval)
+
+	p.stop()
+	assert.Equal(t, io.EOF, p.enqueue(w, &rtp.Header{}, nil, pacerAudio))
+}
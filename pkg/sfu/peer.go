@@ -23,14 +23,54 @@ var (
 	ErrNoTransportEstablished = errors.New("no rtc transport exists for this Peer")
 	// ErrOfferIgnored if offer received in unstable state
 	ErrOfferIgnored = errors.New("offered ignored")
+	// ErrSessionUnavailable if the provider doesn't accept new peers
+	ErrSessionUnavailable = errors.New("session unavailable")
+	// ErrSessionFull if the session reached its max peers
+	ErrSessionFull = errors.New("session is full")
+	// ErrSessionExists if the session is created twice
+	ErrSessionExists = errors.New("session already exists")
+	// ErrInvalidToken if the join token is missing, expired or badly signed
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrPermissionDenied if the role of the peer doesn't allow the action
+	ErrPermissionDenied = errors.New("permission denied")
 )
 
 // SessionProvider provides the session to the sfu.Peer{}
 // This allows the sfu.SFU{} implementation to be customized / wrapped by another package
+// A nil session refuses the join.
 type SessionProvider interface {
 	GetSession(sid string) (*Session, WebRTCTransportConfig)
 }
 
+// SessionCreator can be implemented by a SessionProvider to create
+// sessions with their own policy, used by the first peer joining with
+// a config.
+type SessionCreator interface {
+	CreateSession(sid string, c SessionConfig) (*Session, error)
+}
+
+// SessionLocator can be implemented by a SessionProvider running in a
+// cluster, peers joining a session owned by another node are redirected.
+type SessionLocator interface {
+	LocateSession(sid string) string
+}
+
+// TokenVerifier can be implemented by a SessionProvider to grant roles
+// with join tokens, an empty role gives the session default role.
+type TokenVerifier interface {
+	VerifyToken(sid, token string) (Role, error)
+}
+
+// SessionRedirectError is returned on join when the session lives in another node
+type SessionRedirectError struct {
+	SID  string
+	Node string
+}
+
+func (e *SessionRedirectError) Error() string {
+	return fmt.Sprintf("session %s lives on node %s", e.SID, e.Node)
+}
+
 // Peer represents a pair peer connection
 type Peer struct {
 	sync.Mutex
@@ -39,10 +79,14 @@ type Peer struct {
 	provider   SessionProvider
 	publisher  *Publisher
 	subscriber *Subscriber
+	role       Role
 
-	OnOffer                    func(*webrtc.SessionDescription)
-	OnIceCandidate             func(*webrtc.ICECandidateInit, int)
-	OnICEConnectionStateChange func(webrtc.ICEConnectionState)
+	// Signal handlers, guarded by the peer lock
+	onOffer                    func(*webrtc.SessionDescription)
+	onIceCandidate             func(*webrtc.ICECandidateInit, int)
+	onICEConnectionStateChange func(webrtc.ICEConnectionState)
+	onMigrate                  func()
+	onTrackEvent               func(TrackEvent)
 
 	remoteAnswerPending bool
 	negotiationPending  bool
@@ -57,11 +101,55 @@ func NewPeer(provider SessionProvider) *Peer {
 
 // Join initializes this peer for a given sessionID (takes an SDPOffer)
 func (p *Peer) Join(sid string, sdp webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	return p.join(sid, sdp, "", nil, false)
+}
+
+// JoinWithConfig joins the session like Join, the session is created
+// with the given policy if this is the first peer joining it. The policy
+// is trusted, it must not come from the client.
+func (p *Peer) JoinWithConfig(sid string, sdp webrtc.SessionDescription, c SessionConfig) (*webrtc.SessionDescription, error) {
+	return p.join(sid, sdp, "", &c, true)
+}
+
+// JoinWithToken joins the session with a token granting the role of the
+// peer, c is the policy sent by the client, nil if none. The policy is
+// only applied if the token grants the host role.
+func (p *Peer) JoinWithToken(sid string, sdp webrtc.SessionDescription, token string, c *SessionConfig) (*webrtc.SessionDescription, error) {
+	return p.join(sid, sdp, token, c, false)
+}
+
+func (p *Peer) join(sid string, sdp webrtc.SessionDescription, token string, c *SessionConfig, trusted bool) (*webrtc.SessionDescription, error) {
 	if p.publisher != nil {
 		log.Debugf("peer already exists")
 		return nil, ErrTransportExists
 	}
 
+	if l, ok := p.provider.(SessionLocator); ok {
+		if node := l.LocateSession(sid); node != "" {
+			return nil, &SessionRedirectError{SID: sid, Node: node}
+		}
+	}
+
+	if v, ok := p.provider.(TokenVerifier); ok {
+		role, err := v.VerifyToken(sid, token)
+		if err != nil {
+			return nil, err
+		}
+		p.role = role
+	}
+
+	// Only hosts can set the policy of the sessions they create
+	if c != nil && !trusted && p.role != RoleHost {
+		log.Debugf("Ignoring session %s config of a peer not host", sid)
+		c = nil
+	}
+
+	if creator, ok := p.provider.(SessionCreator); ok && c != nil {
+		if _, err := creator.CreateSession(sid, *c); err != nil && err != ErrSessionExists {
+			return nil, err
+		}
+	}
+
 	pid := cuid.New()
 	p.id = pid
 	var (
@@ -70,6 +158,9 @@ func (p *Peer) Join(sid string, sdp webrtc.SessionDescription) (*webrtc.SessionD
 	)
 
 	p.session, cfg = p.provider.GetSession(sid)
+	if p.session == nil {
+		return nil, ErrSessionUnavailable
+	}
 
 	p.subscriber, err = NewSubscriber(pid, cfg)
 	if err != nil {
@@ -97,9 +188,9 @@ func (p *Peer) Join(sid string, sdp webrtc.SessionDescription) (*webrtc.SessionD
 		}
 
 		p.remoteAnswerPending = true
-		if p.OnOffer != nil {
+		if p.onOffer != nil {
 			log.Infof("peer %s send offer", p.id)
-			p.OnOffer(&offer)
+			p.onOffer(&offer)
 		}
 	})
 
@@ -109,31 +200,57 @@ func (p *Peer) Join(sid string, sdp webrtc.SessionDescription) (*webrtc.SessionD
 			return
 		}
 
-		if p.OnIceCandidate != nil {
+		p.Lock()
+		fn := p.onIceCandidate
+		p.Unlock()
+		if fn != nil {
 			json := c.ToJSON()
-			p.OnIceCandidate(&json, subscriber)
+			fn(&json, subscriber)
+		}
+	})
+
+	p.subscriber.api.onSubscribe(func(pid string, subscribe bool) error {
+		if subscribe {
+			return p.session.SubscribeTo(p, pid)
 		}
+		return p.session.UnsubscribeFrom(p, pid)
 	})
 
+	// the offer tells the codecs the remote end supports for its subscriber too
+	p.subscriber.setCodecs(sdpCodecs(sdp))
+
 	p.publisher.OnICECandidate(func(c *webrtc.ICECandidate) {
 		log.Debugf("on ice candidate called")
 		if c == nil {
 			return
 		}
 
-		if p.OnIceCandidate != nil {
+		p.Lock()
+		fn := p.onIceCandidate
+		p.Unlock()
+		if fn != nil {
 			json := c.ToJSON()
-			p.OnIceCandidate(&json, publisher)
+			fn(&json, publisher)
 		}
 	})
 
 	p.publisher.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
-		if p.OnICEConnectionStateChange != nil {
-			p.OnICEConnectionStateChange(s)
+		p.Lock()
+		fn := p.onICEConnectionStateChange
+		p.Unlock()
+		if fn != nil {
+			fn(s)
 		}
 	})
 
-	p.session.AddPeer(p)
+	if err := p.session.AddPeer(p); err != nil {
+		p.publisher.Close()
+		if err := p.subscriber.Close(); err != nil {
+			log.Errorf("Closing subscriber err: %v", err)
+		}
+		p.publisher, p.subscriber = nil, nil
+		return nil, err
+	}
 
 	log.Infof("peer %s join session %s", p.id, sid)
 
@@ -165,6 +282,9 @@ func (p *Peer) Answer(sdp webrtc.SessionDescription) (*webrtc.SessionDescription
 	if err != nil {
 		return nil, fmt.Errorf("error creating answer: %v", err)
 	}
+	if codecs := sdpCodecs(sdp); codecs != nil {
+		p.subscriber.setCodecs(codecs)
+	}
 
 	log.Infof("peer %s send answer", p.id)
 
@@ -213,6 +333,118 @@ func (p *Peer) Trickle(candidate webrtc.ICECandidateInit, target int) error {
 	return nil
 }
 
+// ID returns the peer id, empty before joining
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// Session returns the session joined by the peer
+func (p *Peer) Session() *Session {
+	return p.session
+}
+
+// Role returns the role of the peer in its session
+func (p *Peer) Role() Role {
+	if p.session == nil {
+		return p.role
+	}
+	return p.session.Role(p.id)
+}
+
+// ControlTrack applies a track control of the peer to a track of another
+// peer, the peer role must allow muting others.
+func (p *Peer) ControlTrack(c TrackControl) error {
+	if p.session == nil {
+		return ErrNoTransportEstablished
+	}
+	if !p.session.Permissions(p.id).Mute {
+		return ErrPermissionDenied
+	}
+	return p.session.ControlTrack(c)
+}
+
+// Kick removes another peer from the session, the peer role must allow it
+func (p *Peer) Kick(pid string) error {
+	if p.session == nil {
+		return ErrNoTransportEstablished
+	}
+	if !p.session.Permissions(p.id).Kick {
+		return ErrPermissionDenied
+	}
+	return p.session.Kick(pid)
+}
+
+// SetRole changes the role of another peer, only hosts can change roles
+func (p *Peer) SetRole(pid string, role Role) error {
+	if p.session == nil {
+		return ErrNoTransportEstablished
+	}
+	if p.session.Role(p.id) != RoleHost {
+		return ErrPermissionDenied
+	}
+	return p.session.SetRole(pid, role)
+}
+
+// OnOffer sets the handler called with the offers of the subscriber
+// renegotiations
+func (p *Peer) OnOffer(f func(*webrtc.SessionDescription)) {
+	p.Lock()
+	p.onOffer = f
+	p.Unlock()
+}
+
+// OnIceCandidate sets the handler called with the local ICE candidates of
+// the publisher and subscriber transports
+func (p *Peer) OnIceCandidate(f func(*webrtc.ICECandidateInit, int)) {
+	p.Lock()
+	p.onIceCandidate = f
+	p.Unlock()
+}
+
+// OnICEConnectionStateChange sets the handler called when the publisher
+// ICE connection state changes
+func (p *Peer) OnICEConnectionStateChange(f func(webrtc.ICEConnectionState)) {
+	p.Lock()
+	p.onICEConnectionStateChange = f
+	p.Unlock()
+}
+
+// OnMigrate sets the handler called when the node is draining and the
+// peer should reconnect to another node.
+func (p *Peer) OnMigrate(f func()) {
+	p.Lock()
+	p.onMigrate = f
+	p.Unlock()
+}
+
+// OnTrackEvent sets the handler called when a moderator controls a track
+// published by the peer.
+func (p *Peer) OnTrackEvent(f func(TrackEvent)) {
+	p.Lock()
+	p.onTrackEvent = f
+	p.Unlock()
+}
+
+func (p *Peer) trackEvent(e TrackEvent) {
+	p.Lock()
+	fn := p.onTrackEvent
+	p.Unlock()
+	if fn != nil {
+		log.Infof("peer %s track %s %s", p.id, e.TrackID, e.Type)
+		fn(e)
+	}
+}
+
+func (p *Peer) migrate() {
+	p.Lock()
+	fn := p.onMigrate
+	p.Unlock()
+	if fn != nil {
+		log.Infof("peer %s asked to migrate", p.id)
+		fn()
+	}
+}
+
 // Close shuts down the peer connection and sends true to the done channel
 func (p *Peer) Close() error {
 	if p.session != nil {
@@ -0,0 +1,221 @@
+package sfu
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxPaddingSize is the largest padding a RTP packet can carry
+	maxPaddingSize = 255
+	// maxPaddingBurst caps the padding packets sent after a frame
+	maxPaddingBurst = 32
+
+	defaultProbeDuration   = 1000
+	defaultProbeMaxBitrate = 1000
+	defaultProbeMaxLoss    = 0.05
+	defaultProbeMaxDelay   = 30
+	// probeBackoff is the number of probe durations to wait before probing
+	// again after a failed probe
+	probeBackoff = 5
+)
+
+// ProbeConfig defines the bandwidth probing done with padding packets
+// before switching a subscriber to a higher simulcast layer
+type ProbeConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Duration of a probe in ms
+	Duration int `mapstructure:"duration" json:"duration,omitempty"`
+	// MaxBitrate caps the padding bitrate in kbps
+	MaxBitrate uint64 `mapstructure:"maxbitrate" json:"maxBitrate,omitempty"`
+	// MaxLoss aborts the probe when the subscriber reports a higher fraction lost
+	MaxLoss float64 `mapstructure:"maxloss" json:"maxLoss,omitempty"`
+	// MaxDelay aborts the probe when the subscriber jitter grows more than MaxDelay ms
+	MaxDelay int `mapstructure:"maxdelay" json:"maxDelay,omitempty"`
+}
+
+type probeResult int
+
+const (
+	probeIdle probeResult = iota
+	probeRunning
+	probeSucceeded
+	probeFailed
+)
+
+// probeStart is the outcome of a probe start
+type probeStart int
+
+const (
+	// probeNotNeeded means the layer can be switched to without probing
+	probeNotNeeded probeStart = iota
+	// probeStarted means the layer is switched to once the probe succeeds
+	probeStarted
+	// probeDeferred means a probe failed recently, the layer is retried
+	// once the backoff is over
+	probeDeferred
+)
+
+// prober sends padding at a controlled rate to check if a subscriber has
+// the bandwidth for a higher layer, the probe fails when the subscriber
+// reports loss, a growing jitter or a lower estimate than needed.
+type prober struct {
+	sync.Mutex
+	duration   time.Duration
+	maxBitrate uint64
+	maxLoss    float64
+	maxDelay   float64
+
+	running    bool
+	failed     bool
+	failedAt   time.Time
+	deferred   bool
+	retryLayer int
+	layer      int
+	bitrate    uint64
+	target     uint64
+	startedAt  time.Time
+	sent       uint64
+	jitter     float64
+	baseJitter float64
+}
+
+func newProber(c ProbeConfig) *prober {
+	p := &prober{
+		duration:   time.Duration(c.Duration) * time.Millisecond,
+		maxBitrate: c.MaxBitrate * 1000,
+		maxLoss:    c.MaxLoss,
+		maxDelay:   float64(c.MaxDelay),
+	}
+	if p.duration <= 0 {
+		p.duration = defaultProbeDuration * time.Millisecond
+	}
+	if p.maxBitrate == 0 {
+		p.maxBitrate = defaultProbeMaxBitrate * 1000
+	}
+	if p.maxLoss <= 0 {
+		p.maxLoss = defaultProbeMaxLoss
+	}
+	if p.maxDelay <= 0 {
+		p.maxDelay = defaultProbeMaxDelay
+	}
+	return p
+}
+
+// start begins probing the bitrate the subscriber needs to receive the
+// layer, target and current are the bitrates of the target and current
+// layers, zero if unknown.
+func (p *prober) start(layer int, target, current uint64, now time.Time) probeStart {
+	p.Lock()
+	defer p.Unlock()
+	if p.running {
+		p.layer = layer
+		return probeStarted
+	}
+	if !p.failedAt.IsZero() && now.Sub(p.failedAt) < probeBackoff*p.duration {
+		p.deferred = true
+		p.retryLayer = layer
+		return probeDeferred
+	}
+	p.deferred = false
+	p.bitrate = p.maxBitrate
+	if target > 0 && current > 0 {
+		if target <= current {
+			return probeNotNeeded
+		}
+		if target-current < p.bitrate {
+			p.bitrate = target - current
+		}
+	}
+	p.running = true
+	p.failed = false
+	p.layer = layer
+	p.target = target
+	p.startedAt = now
+	p.sent = 0
+	p.baseJitter = p.jitter
+	return probeStarted
+}
+
+// retry returns the layer deferred during the backoff once it's over
+func (p *prober) retry(now time.Time) (int, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.deferred || p.running || now.Sub(p.failedAt) < probeBackoff*p.duration {
+		return 0, false
+	}
+	p.deferred = false
+	return p.retryLayer, true
+}
+
+// stop cancels a running or deferred probe
+func (p *prober) stop() {
+	p.Lock()
+	p.running = false
+	p.deferred = false
+	p.Unlock()
+}
+
+// padding returns the padding bytes due to keep the probing bitrate
+func (p *prober) padding(now time.Time) int {
+	p.Lock()
+	defer p.Unlock()
+	if !p.running || p.failed {
+		return 0
+	}
+	due := p.bitrate * uint64(now.Sub(p.startedAt)) / uint64(time.Second) / 8
+	if due <= p.sent {
+		return 0
+	}
+	return int(due - p.sent)
+}
+
+func (p *prober) sentPadding(n int) {
+	p.Lock()
+	p.sent += uint64(n)
+	p.Unlock()
+}
+
+// onReport updates the probe with the fraction lost and jitter in ms of
+// a subscriber receiver report
+func (p *prober) onReport(fractionLost uint8, jitter float64) {
+	p.Lock()
+	defer p.Unlock()
+	p.jitter = jitter
+	if !p.running {
+		return
+	}
+	if float64(fractionLost)/256 > p.maxLoss || jitter-p.baseJitter > p.maxDelay {
+		p.failed = true
+	}
+}
+
+// onEstimate updates the probe with the subscriber estimated bitrate, the
+// estimate covers every track of the subscriber so it only fails probes.
+func (p *prober) onEstimate(bitrate uint64) {
+	p.Lock()
+	defer p.Unlock()
+	if p.running && p.target > 0 && bitrate < p.target {
+		p.failed = true
+	}
+}
+
+// check returns the state of the probe and the layer probed, the probe
+// ends once succeeded or failed is returned.
+func (p *prober) check(now time.Time) (probeResult, int) {
+	p.Lock()
+	defer p.Unlock()
+	switch {
+	case !p.running:
+		return probeIdle, 0
+	case p.failed:
+		p.running = false
+		p.failedAt = now
+		return probeFailed, p.layer
+	case now.Sub(p.startedAt) >= p.duration:
+		p.running = false
+		p.failedAt = time.Time{}
+		return probeSucceeded, p.layer
+	}
+	return probeRunning, p.layer
+}
@@ -0,0 +1,141 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_prober(t *testing.T) {
+	config := ProbeConfig{Enabled: true, Duration: 1000, MaxBitrate: 800, MaxLoss: 0.05, MaxDelay: 30}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		target  uint64
+		current uint64
+		events  func(p *prober)
+		elapsed time.Duration
+		want    probeResult
+	}{
+		{
+			name:    "Must succeed without rising loss or delay",
+			target:  1500000,
+			current: 500000,
+			events: func(p *prober) {
+				p.onReport(0, 12)
+				p.onEstimate(2000000)
+			},
+			elapsed: time.Second,
+			want:    probeSucceeded,
+		},
+		{
+			name:    "Must keep running until the duration elapsed",
+			target:  1500000,
+			current: 500000,
+			elapsed: 500 * time.Millisecond,
+			want:    probeRunning,
+		},
+		{
+			name:    "Must abort on loss",
+			target:  1500000,
+			current: 500000,
+			events: func(p *prober) {
+				p.onReport(64, 10)
+			},
+			elapsed: 200 * time.Millisecond,
+			want:    probeFailed,
+		},
+		{
+			name:    "Must abort on rising delay",
+			target:  1500000,
+			current: 500000,
+			events: func(p *prober) {
+				p.onReport(0, 60)
+			},
+			elapsed: 200 * time.Millisecond,
+			want:    probeFailed,
+		},
+		{
+			name:    "Must abort on low estimate",
+			target:  1500000,
+			current: 500000,
+			events: func(p *prober) {
+				p.onEstimate(1000000)
+			},
+			elapsed: 200 * time.Millisecond,
+			want:    probeFailed,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProber(config)
+			p.onReport(0, 10)
+			assert.Equal(t, probeStarted, p.start(2, tt.target, tt.current, now))
+			if tt.events != nil {
+				tt.events(p)
+			}
+			result, layer := p.check(now.Add(tt.elapsed))
+			assert.Equal(t, tt.want, result)
+			assert.Equal(t, 2, layer)
+		})
+	}
+}
+
+func Test_proberPadding(t *testing.T) {
+	now := time.Now()
+	p := newProber(ProbeConfig{Enabled: true, MaxBitrate: 800})
+	assert.Equal(t, 0, p.padding(now))
+
+	// Padding fills the gap between layers
+	assert.Equal(t, probeStarted, p.start(1, 700000, 500000, now))
+	assert.Equal(t, 2500, p.padding(now.Add(100*time.Millisecond)))
+	p.sentPadding(2000)
+	assert.Equal(t, 500, p.padding(now.Add(100*time.Millisecond)))
+	p.stop()
+	assert.Equal(t, 0, p.padding(now.Add(200*time.Millisecond)))
+
+	// Padding is capped to the max bitrate
+	assert.Equal(t, probeStarted, p.start(1, 0, 0, now))
+	assert.Equal(t, 10000, p.padding(now.Add(100*time.Millisecond)))
+
+	// No probe needed to switch to a lower bitrate layer
+	p.stop()
+	assert.Equal(t, probeNotNeeded, p.start(1, 500000, 700000, now))
+}
+
+func Test_proberBackoff(t *testing.T) {
+	now := time.Now()
+	p := newProber(ProbeConfig{Enabled: true, Duration: 100})
+	assert.Equal(t, probeStarted, p.start(1, 0, 0, now))
+	p.onReport(255, 0)
+	result, _ := p.check(now)
+	assert.Equal(t, probeFailed, result)
+
+	// Don't probe again right after a failure, the layer is retried after
+	// the backoff
+	assert.Equal(t, probeDeferred, p.start(1, 0, 0, now.Add(200*time.Millisecond)))
+	result, _ = p.check(now.Add(200 * time.Millisecond))
+	assert.Equal(t, probeIdle, result)
+	_, ok := p.retry(now.Add(200 * time.Millisecond))
+	assert.False(t, ok)
+	layer, ok := p.retry(now.Add(time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 1, layer)
+	_, ok = p.retry(now.Add(time.Second))
+	assert.False(t, ok)
+
+	assert.Equal(t, probeStarted, p.start(1, 0, 0, now.Add(time.Second)))
+	result, _ = p.check(now.Add(time.Second))
+	assert.Equal(t, probeRunning, result)
+
+	// Stopping cancels a deferred layer
+	p.onReport(255, 0)
+	p.check(now.Add(time.Second))
+	assert.Equal(t, probeDeferred, p.start(2, 0, 0, now.Add(time.Second)))
+	p.stop()
+	_, ok = p.retry(now.Add(2 * time.Second))
+	assert.False(t, ok)
+}
@@ -1,10 +1,12 @@
 package sfu
 
 import (
+	"encoding/json"
 	"sync"
 	"sync/atomic"
 
 	log "github.com/pion/ion-log"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -15,6 +17,15 @@ type Publisher struct {
 	router     Router
 	session    *Session
 	candidates []webrtc.ICECandidateInit
+	// relayTracks describes the tracks by mid when the remote end is a relay
+	relayTracks map[string]RelayTrack
+	// relayChannel sends the layer requests back to the relay, the last
+	// request of each track is kept to be sent once the channel opens
+	relayMu      sync.Mutex
+	relayChannel *webrtc.DataChannel
+	relayLayers  map[string]RelayLayers
+	// rejectUnsupported rejects tracks some subscribers can't decode
+	rejectUnsupported bool
 
 	onTrackHandler                    func(*webrtc.TrackRemote, *webrtc.RTPReceiver)
 	onICEConnectionStateChangeHandler atomic.Value // func(webrtc.ICEConnectionState)
@@ -24,7 +35,7 @@ type Publisher struct {
 
 // NewPublisher creates a new Publisher
 func NewPublisher(session *Session, id string, cfg WebRTCTransportConfig) (*Publisher, error) {
-	me, err := getPublisherMediaEngine()
+	me, err := getPublisherMediaEngine(cfg.codecs, session.Config().AllowedCodecs)
 	if err != nil {
 		log.Errorf("NewPeer error: %v", err)
 		return nil, errPeerConnectionInitFailed
@@ -39,15 +50,50 @@ func NewPublisher(session *Session, id string, cfg WebRTCTransportConfig) (*Publ
 	}
 
 	p := &Publisher{
-		id:      id,
-		pc:      pc,
-		session: session,
-		router:  newRouter(pc, id, cfg.router),
+		id:                id,
+		pc:                pc,
+		session:           session,
+		router:            newRouter(pc, id, session.routerConfig(cfg.router), cfg.bufferFactory),
+		rejectUnsupported: cfg.codecs.RejectUnsupported,
 	}
 
 	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 		log.Debugf("Peer %s got remote track id: %s mediaSSRC: %d rid :%s streamID: %s", p.id, track.ID(), track.SSRC(), track.RID(), track.StreamID())
-		if r, pub := p.router.AddReceiver(receiver, track); pub {
+		md := p.mediaDescription(receiver)
+		layer, simulcast := p.ridLayer(md, track.RID()), len(track.RID()) > 0
+		screen := isScreenShare(md)
+		if p.relayTracks != nil {
+			if rt, ok := p.relayTracks[p.mid(receiver)]; ok {
+				layer, simulcast = rt.Layer, rt.Simulcast
+			}
+		}
+		// relayed tracks were already admitted by the origin node
+		if p.relayTracks == nil {
+			err := p.session.allowTrack(p.id, screen, track.Codec())
+			if peers := p.session.cannotDecode(p.id, track.Codec().MimeType); err == nil && len(peers) > 0 {
+				log.Warnf("Peer %s track %s codec %s can't be decoded by peers %v", p.id, track.ID(), track.Codec().MimeType, peers)
+				if p.rejectUnsupported {
+					err = errCodecNotDecodable
+				}
+			}
+			if err != nil {
+				log.Warnf("Peer %s track %s rejected: %v", p.id, track.ID(), err)
+				if err := receiver.Stop(); err != nil {
+					log.Errorf("Stopping rejected track err: %v", err)
+				}
+				return
+			}
+		}
+		r, pub := p.router.AddReceiver(receiver, track, layer, simulcast)
+		if wr, ok := r.(*WebRTCReceiver); ok && screen {
+			wr.screenShare.set(true)
+		}
+		if wr, ok := r.(*WebRTCReceiver); ok && p.relayTracks != nil && simulcast {
+			wr.onIdleLayers(func(seq uint64, layers []int) {
+				p.requestLayers(RelayLayers{StreamID: r.StreamID(), TrackID: r.TrackID(), Paused: layers, seq: seq})
+			})
+		}
+		if pub {
 			p.session.Publish(p.router, r)
 		}
 	})
@@ -57,6 +103,17 @@ func NewPublisher(session *Session, id string, cfg WebRTCTransportConfig) (*Publ
 			// terminate api data channel
 			return
 		}
+		if dc.Label() == relayChannelLabel && p.relayTracks != nil {
+			dc.OnOpen(func() {
+				p.relayMu.Lock()
+				p.relayChannel = dc
+				for _, l := range p.relayLayers {
+					p.sendLayers(l)
+				}
+				p.relayMu.Unlock()
+			})
+			return
+		}
 		p.session.AddDatachannel(id, dc)
 	})
 
@@ -70,8 +127,8 @@ func NewPublisher(session *Session, id string, cfg WebRTCTransportConfig) (*Publ
 			p.Close()
 		}
 
-		if handler, ok := p.onICEConnectionStateChangeHandler.Load().(func()); ok && handler != nil {
-			handler()
+		if handler, ok := p.onICEConnectionStateChangeHandler.Load().(func(webrtc.ICEConnectionState)); ok && handler != nil {
+			handler(connectionState)
 		}
 	})
 
@@ -98,6 +155,85 @@ func (p *Publisher) Answer(offer webrtc.SessionDescription) (webrtc.SessionDescr
 	return answer, nil
 }
 
+// requestLayers asks the relay to pause the layers of a track not used by
+// the local subscribers
+func (p *Publisher) requestLayers(l RelayLayers) {
+	p.relayMu.Lock()
+	defer p.relayMu.Unlock()
+	if p.relayLayers == nil {
+		p.relayLayers = make(map[string]RelayLayers)
+	}
+	key := l.StreamID + " " + l.TrackID
+	if last, ok := p.relayLayers[key]; ok && last.seq >= l.seq {
+		// A newer report was already sent
+		return
+	}
+	p.relayLayers[key] = l
+	if p.relayChannel != nil {
+		p.sendLayers(l)
+	}
+}
+
+func (p *Publisher) sendLayers(l RelayLayers) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		log.Errorf("Marshal relay layers err: %v", err)
+		return
+	}
+	if err := p.relayChannel.SendText(string(data)); err != nil {
+		log.Errorf("Sending relay layers err: %v", err)
+	}
+}
+
+// mid returns the media id of the transceiver owning the given receiver
+func (p *Publisher) mid(receiver *webrtc.RTPReceiver) string {
+	for _, t := range p.pc.GetTransceivers() {
+		if t.Receiver() == receiver {
+			return t.Mid()
+		}
+	}
+	return ""
+}
+
+// mediaDescription returns the media section of the receiver in the
+// remote description, nil if not found
+func (p *Publisher) mediaDescription(receiver *webrtc.RTPReceiver) *sdp.MediaDescription {
+	desc := p.pc.RemoteDescription()
+	if desc == nil {
+		return nil
+	}
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return nil
+	}
+	mid := p.mid(receiver)
+	for _, md := range parsed.MediaDescriptions {
+		if m, _ := md.Attribute("mid"); m == mid {
+			return md
+		}
+	}
+	return nil
+}
+
+// ridLayer returns the spatial layer of a simulcast RID as declared in
+// the receiver media section
+func (p *Publisher) ridLayer(md *sdp.MediaDescription, rid string) int {
+	if rid == "" {
+		return 0
+	}
+	layers := maxSimulcastLayers
+	if md != nil {
+		declared := simulcastLayers(md)
+		if layer, ok := declared[rid]; ok {
+			return layer
+		}
+		if len(declared) > 0 {
+			layers = len(declared)
+		}
+	}
+	return ridLayer(rid, layers)
+}
+
 // GetRouter returns router with mediaSSRC
 func (p *Publisher) GetRouter() Router {
 	return p.router
@@ -2,8 +2,8 @@ package sfu
 
 import (
 	"io"
+	"reflect"
 	"sync"
-	"time"
 
 	"github.com/gammazero/workerpool"
 	"github.com/pion/ion-sfu/pkg/buffer"
@@ -19,42 +19,68 @@ type Receiver interface {
 	Codec() webrtc.RTPCodecParameters
 	Kind() webrtc.RTPCodecType
 	SSRC(layer int) uint32
-	AddUpTrack(track *webrtc.TrackRemote, buffer *buffer.Buffer)
+	Layers() int
+	Bitrate(layer int) uint64
+	SenderReport(layer int) buffer.SenderReportData
+	IsSimulcast() bool
+	AddUpTrack(track *webrtc.TrackRemote, buffer *buffer.Buffer, layer int)
 	AddDownTrack(track *DownTrack, bestQualityFirst bool)
 	SubDownTrack(track *DownTrack, layer int) error
+	WriteKeyframeCache(track *DownTrack) bool
 	RetransmitPackets(track *DownTrack, packets []uint16)
 	DeleteDownTrack(layer int, id string)
 	OnCloseHandler(fn func())
 	SendRTCP(p []rtcp.Packet)
+	RequestKeyframe(requester string, ssrc uint32, fir bool)
 	SetRTCPCh(ch chan []rtcp.Packet)
+	Mute(val bool)
+	Muted() bool
+	ForceLayer(layer int) error
+	ForcedLayer() (int, bool)
+	Stop()
 }
 
 // WebRTCReceiver receives a video track
 type WebRTCReceiver struct {
 	sync.Mutex
-	rtcpMu sync.RWMutex
 
 	peerID         string
 	trackID        string
 	streamID       string
 	kind           webrtc.RTPCodecType
 	bandwidth      uint64
-	lastPli        int64
+	keyframes      *keyframeRequester
 	stream         string
 	receiver       *webrtc.RTPReceiver
 	codec          webrtc.RTPCodecParameters
 	rtcpCh         chan []rtcp.Packet
-	buffers        [3]*buffer.Buffer
-	upTracks       [3]*webrtc.TrackRemote
-	downTracks     [3][]*DownTrack
+	buffers        []*buffer.Buffer
+	upTracks       []*webrtc.TrackRemote
+	downTracks     [][]*DownTrack
+	keyframeCache  KeyframeCacheConfig
+	caches         []*keyframeCache
 	nackWorker     *workerpool.WorkerPool
 	isSimulcast    bool
+	running        int
 	onCloseHandler func()
+
+	// Moderator controls, applied to every subscriber
+	muted       atomicBool
+	screenShare atomicBool
+	forced      bool
+	forcedLayer int
+	stopped     bool
+
+	// idle are the received layers without down tracks, reported to
+	// onIdle with an increasing idleSeq when they change
+	idle    []int
+	idleSeq uint64
+	onIdle  func(seq uint64, layers []int)
 }
 
 // NewWebRTCReceiver creates a new webrtc track receivers
-func NewWebRTCReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, pid string) Receiver {
-	return &WebRTCReceiver{
+func NewWebRTCReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, pid string, simulcast bool) Receiver {
+	w := &WebRTCReceiver{
 		peerID:      pid,
 		receiver:    receiver,
 		trackID:     track.ID(),
@@ -62,10 +88,42 @@ func NewWebRTCReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote,
 		codec:       track.Codec(),
 		kind:        track.Kind(),
 		nackWorker:  workerpool.New(1),
-		isSimulcast: len(track.RID()) > 0,
+		isSimulcast: simulcast,
+	}
+	w.keyframes = newKeyframeRequester(KeyframeConfig{}, w.supportsFIR(), w.writeRTCP)
+	return w
+}
+
+// setConfig applies the router config, must be called before adding the
+// up tracks
+func (w *WebRTCReceiver) setConfig(c RouterConfig) {
+	w.keyframeCache = c.KeyframeCache
+	w.keyframes = newKeyframeRequester(c.Keyframe, w.supportsFIR(), w.writeRTCP)
+}
+
+// setMaxBandwidth applies the router maxbandwidth to the layers already
+// received
+func (w *WebRTCReceiver) setMaxBandwidth(bitrate uint64) {
+	w.Lock()
+	buffers := append([]*buffer.Buffer(nil), w.buffers...)
+	w.Unlock()
+	for _, buff := range buffers {
+		if buff != nil {
+			buff.SetMaxBitrate(bitrate)
+		}
 	}
 }
 
+// supportsFIR returns true if the publisher negotiated FIR feedback
+func (w *WebRTCReceiver) supportsFIR() bool {
+	for _, fb := range w.codec.RTCPFeedback {
+		if fb.Type == "ccm" && fb.Parameter == "fir" {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *WebRTCReceiver) StreamID() string {
 	return w.streamID
 }
@@ -75,12 +133,51 @@ func (w *WebRTCReceiver) TrackID() string {
 }
 
 func (w *WebRTCReceiver) SSRC(layer int) uint32 {
-	if track := w.upTracks[layer]; track != nil {
-		return uint32(track.SSRC())
+	w.Lock()
+	defer w.Unlock()
+	if layer < len(w.upTracks) && w.upTracks[layer] != nil {
+		return uint32(w.upTracks[layer].SSRC())
 	}
 	return 0
 }
 
+// Layers returns the number of spatial layers, including the layers
+// not received yet below the highest one
+func (w *WebRTCReceiver) Layers() int {
+	w.Lock()
+	defer w.Unlock()
+	return len(w.upTracks)
+}
+
+// Bitrate returns the incoming bitrate of a layer in bps, zero if the
+// layer isn't received or not measured yet
+func (w *WebRTCReceiver) Bitrate(layer int) uint64 {
+	w.Lock()
+	if layer < 0 || layer >= len(w.buffers) || w.buffers[layer] == nil {
+		w.Unlock()
+		return 0
+	}
+	buff := w.buffers[layer]
+	w.Unlock()
+	return buff.Bitrate()
+}
+
+// SenderReport returns the last sender report of the layer
+func (w *WebRTCReceiver) SenderReport(layer int) buffer.SenderReportData {
+	w.Lock()
+	if layer < 0 || layer >= len(w.buffers) || w.buffers[layer] == nil {
+		w.Unlock()
+		return buffer.SenderReportData{}
+	}
+	buff := w.buffers[layer]
+	w.Unlock()
+	return buff.SenderReport()
+}
+
+func (w *WebRTCReceiver) IsSimulcast() bool {
+	return w.isSimulcast
+}
+
 func (w *WebRTCReceiver) Codec() webrtc.RTPCodecParameters {
 	return w.codec
 }
@@ -89,25 +186,35 @@ func (w *WebRTCReceiver) Kind() webrtc.RTPCodecType {
 	return w.kind
 }
 
-func (w *WebRTCReceiver) AddUpTrack(track *webrtc.TrackRemote, buff *buffer.Buffer) {
-	var layer int
-
-	switch track.RID() {
-	case fullResolution:
-		layer = 2
-	case halfResolution:
-		layer = 1
-	default:
-		layer = 0
+func (w *WebRTCReceiver) AddUpTrack(track *webrtc.TrackRemote, buff *buffer.Buffer, layer int) {
+	w.Lock()
+	for len(w.upTracks) <= layer {
+		w.upTracks = append(w.upTracks, nil)
+		w.buffers = append(w.buffers, nil)
+		w.downTracks = append(w.downTracks, nil)
+		w.caches = append(w.caches, nil)
+	}
+	if w.keyframeCache.Enabled && w.kind == webrtc.RTPCodecTypeVideo {
+		w.caches[layer] = newKeyframeCache(w.codec.MimeType, w.keyframeCache)
 	}
-
 	w.upTracks[layer] = track
 	w.buffers[layer] = buff
 	w.downTracks[layer] = make([]*DownTrack, 0, 10)
-	go w.writeRTP(layer)
+	w.running++
+	w.Unlock()
+	w.idleLayersChanged()
+	go w.writeRTP(layer, buff)
 }
 
 func (w *WebRTCReceiver) AddDownTrack(track *DownTrack, bestQualityFirst bool) {
+	defer w.idleLayersChanged()
+	w.Lock()
+	defer w.Unlock()
+
+	if w.stopped {
+		return
+	}
+
 	layer := 0
 	if w.isSimulcast {
 		for i, t := range w.upTracks {
@@ -118,30 +225,56 @@ func (w *WebRTCReceiver) AddDownTrack(track *DownTrack, bestQualityFirst bool) {
 				}
 			}
 		}
-		track.currentSpatialLayer = layer
-		track.simulcast.targetSpatialLayer = layer
+		if w.forced {
+			layer = w.forcedLayer
+		}
+		track.setSpatialLayer(layer)
 		track.trackType = SimulcastDownTrack
 	} else {
 		track.trackType = SimpleDownTrack
 	}
 
-	w.Lock()
-	w.downTracks[layer] = append(w.downTracks[layer], track)
-	w.Unlock()
+	if layer < len(w.downTracks) {
+		w.downTracks[layer] = appendDownTrack(w.downTracks[layer], track)
+	}
 }
 
 func (w *WebRTCReceiver) SubDownTrack(track *DownTrack, layer int) error {
+	defer w.idleLayersChanged()
 	w.Lock()
-	if dts := w.downTracks[layer]; dts != nil {
-		w.downTracks[layer] = append(dts, track)
-	} else {
-		w.Unlock()
+	defer w.Unlock()
+	if layer < 0 || layer >= len(w.downTracks) || w.downTracks[layer] == nil || w.stopped {
 		return errNoReceiverFound
 	}
-	w.Unlock()
+	if w.forced && layer != w.forcedLayer {
+		return errLayerForced
+	}
+	w.downTracks[layer] = appendDownTrack(w.downTracks[layer], track)
+	w.writeKeyframeCache(track, layer)
 	return nil
 }
 
+// WriteKeyframeCache writes the packets cached since the last keyframe of
+// the track layer to the track, so it starts without waiting for the next
+// keyframe. Returns false if there is no keyframe cached.
+func (w *WebRTCReceiver) WriteKeyframeCache(track *DownTrack) bool {
+	layer, _ := track.spatialLayers()
+	w.Lock()
+	defer w.Unlock()
+	return w.writeKeyframeCache(track, layer)
+}
+
+func (w *WebRTCReceiver) writeKeyframeCache(track *DownTrack, layer int) bool {
+	if layer < 0 || layer >= len(w.caches) || w.caches[layer] == nil {
+		return false
+	}
+	pkts := w.caches[layer].get()
+	for _, pkt := range pkts {
+		track.enqueue(pkt)
+	}
+	return len(pkts) > 0
+}
+
 // OnCloseHandler method to be called on remote tracked removed
 func (w *WebRTCReceiver) OnCloseHandler(fn func()) {
 	w.onCloseHandler = fn
@@ -150,6 +283,10 @@ func (w *WebRTCReceiver) OnCloseHandler(fn func()) {
 // DeleteDownTrack removes a DownTrack from a Receiver
 func (w *WebRTCReceiver) DeleteDownTrack(layer int, id string) {
 	w.Lock()
+	if layer >= len(w.downTracks) {
+		w.Unlock()
+		return
+	}
 	idx := -1
 	for i, dt := range w.downTracks[layer] {
 		if dt.peerID == id {
@@ -161,22 +298,201 @@ func (w *WebRTCReceiver) DeleteDownTrack(layer int, id string) {
 		w.Unlock()
 		return
 	}
-	w.downTracks[layer][idx] = w.downTracks[layer][len(w.downTracks[layer])-1]
-	w.downTracks[layer][len(w.downTracks[layer])-1] = nil
-	w.downTracks[layer] = w.downTracks[layer][:len(w.downTracks[layer])-1]
+	dts := make([]*DownTrack, 0, len(w.downTracks[layer])-1)
+	dts = append(dts, w.downTracks[layer][:idx]...)
+	w.downTracks[layer] = append(dts, w.downTracks[layer][idx+1:]...)
+	w.Unlock()
+	w.idleLayersChanged()
+}
+
+// onIdleLayers sets the handler called with the received layers without
+// down tracks when they change, the relays pause them. The handler runs
+// without the receiver locks, reports older than the last handled seq
+// are stale.
+func (w *WebRTCReceiver) onIdleLayers(fn func(seq uint64, layers []int)) {
+	w.Lock()
+	w.onIdle = fn
+	w.Unlock()
+}
+
+func (w *WebRTCReceiver) idleLayersChanged() {
+	w.Lock()
+	if w.onIdle == nil {
+		w.Unlock()
+		return
+	}
+	idle := make([]int, 0, len(w.upTracks))
+	for layer, t := range w.upTracks {
+		if t != nil && len(w.downTracks[layer]) == 0 {
+			idle = append(idle, layer)
+		}
+	}
+	if reflect.DeepEqual(idle, w.idle) {
+		w.Unlock()
+		return
+	}
+	for _, layer := range idle {
+		// Newly paused layers restart without the cached keyframe
+		if !containsLayer(w.idle, layer) && w.caches[layer] != nil {
+			w.caches[layer] = newKeyframeCache(w.codec.MimeType, w.keyframeCache)
+		}
+	}
+	w.idle = idle
+	w.idleSeq++
+	seq, fn := w.idleSeq, w.onIdle
 	w.Unlock()
+	fn(seq, idle)
+}
+
+func containsLayer(layers []int, layer int) bool {
+	for _, l := range layers {
+		if l == layer {
+			return true
+		}
+	}
+	return false
 }
 
+// Mute stops forwarding the track to every subscriber, video resumes on
+// the next keyframe once unmuted.
+func (w *WebRTCReceiver) Mute(val bool) {
+	if w.muted.get() == val {
+		return
+	}
+	w.muted.set(val)
+	event := APIEventTrackMuted
+	if !val {
+		event = APIEventTrackUnmuted
+	}
+	for _, dt := range w.allDownTracks() {
+		if !val {
+			dt.reSync.set(true)
+		}
+		dt.apiEvent(event, APITrack{StreamID: dt.streamID, TrackID: dt.id})
+	}
+}
+
+// Muted returns true if the track is muted for every subscriber
+func (w *WebRTCReceiver) Muted() bool {
+	return w.muted.get()
+}
+
+// isScreenShareReceiver returns true if the track of the receiver was
+// negotiated as a screen share
+func isScreenShareReceiver(r Receiver) bool {
+	wr, ok := r.(*WebRTCReceiver)
+	return ok && wr.screenShare.get()
+}
+
+// ForceLayer switches every subscriber to a simulcast layer and keeps them
+// there until released with a negative layer.
+func (w *WebRTCReceiver) ForceLayer(layer int) error {
+	if !w.isSimulcast {
+		return errNotSimulcast
+	}
+	w.Lock()
+	if layer < 0 {
+		w.forced = false
+		w.Unlock()
+		return nil
+	}
+	if layer >= len(w.upTracks) || w.upTracks[layer] == nil {
+		w.Unlock()
+		return errLayerNotFound
+	}
+	w.forced = true
+	w.forcedLayer = layer
+	w.Unlock()
+
+	for _, dt := range w.allDownTracks() {
+		dt.forceSpatialLayer(layer)
+	}
+	return nil
+}
+
+// ForcedLayer returns the layer forced by a moderator, if any
+func (w *WebRTCReceiver) ForcedLayer() (int, bool) {
+	w.Lock()
+	defer w.Unlock()
+	return w.forcedLayer, w.forced
+}
+
+// Stop stops forwarding the track for good, the down tracks are removed
+// from the subscribers.
+func (w *WebRTCReceiver) Stop() {
+	w.Lock()
+	if w.stopped {
+		w.Unlock()
+		return
+	}
+	w.stopped = true
+	w.Unlock()
+
+	for _, dt := range w.allDownTracks() {
+		dt.Close()
+	}
+}
+
+// allDownTracks returns the down tracks of every layer, a down track
+// switching layer is returned once.
+func (w *WebRTCReceiver) allDownTracks() []*DownTrack {
+	w.Lock()
+	defer w.Unlock()
+	seen := make(map[*DownTrack]struct{})
+	var dts []*DownTrack
+	for _, layer := range w.downTracks {
+		for _, dt := range layer {
+			if _, ok := seen[dt]; !ok {
+				seen[dt] = struct{}{}
+				dts = append(dts, dt)
+			}
+		}
+	}
+	return dts
+}
+
+// appendDownTrack returns a copy of the down tracks with the track added,
+// the down tracks slices are copied on write so they are read without
+// holding the lock while fanning out packets.
+func appendDownTrack(dts []*DownTrack, track *DownTrack) []*DownTrack {
+	return append(dts[:len(dts):len(dts)], track)
+}
+
+// SendRTCP sends RTCP packets to the publisher, keyframe requests are
+// throttled as requested by the SFU.
 func (w *WebRTCReceiver) SendRTCP(p []rtcp.Packet) {
-	if _, ok := p[0].(*rtcp.PictureLossIndication); ok {
-		w.rtcpMu.Lock()
-		defer w.rtcpMu.Unlock()
-		if time.Now().UnixNano()-w.lastPli < 500e6 {
-			return
+	fwd := make([]rtcp.Packet, 0, len(p))
+	for _, pkt := range p {
+		switch pkt := pkt.(type) {
+		case *rtcp.PictureLossIndication:
+			w.RequestKeyframe(keyframeRequesterSFU, pkt.MediaSSRC, false)
+		case *rtcp.FullIntraRequest:
+			for _, fir := range pkt.FIR {
+				w.RequestKeyframe(keyframeRequesterSFU, fir.SSRC, true)
+			}
+		default:
+			fwd = append(fwd, pkt)
 		}
-		w.lastPli = time.Now().UnixNano()
 	}
+	if len(fwd) > 0 {
+		w.writeRTCP(fwd)
+	}
+}
+
+// RequestKeyframe asks the publisher a keyframe of the ssrc layer for the
+// requester, requests are throttled and coalesced by layer. A FIR is sent
+// if asked and supported by the publisher, a PLI otherwise.
+func (w *WebRTCReceiver) RequestKeyframe(requester string, ssrc uint32, fir bool) {
+	w.keyframes.request(requester, ssrc, fir)
+}
+
+// KeyframeRequests returns the keyframes asked by requester, the peer id of
+// the subscribers or "sfu".
+func (w *WebRTCReceiver) KeyframeRequests() map[string]uint64 {
+	return w.keyframes.counts()
+}
 
+func (w *WebRTCReceiver) writeRTCP(p []rtcp.Packet) {
 	w.rtcpCh <- p
 }
 
@@ -185,10 +501,19 @@ func (w *WebRTCReceiver) SetRTCPCh(ch chan []rtcp.Packet) {
 }
 
 func (w *WebRTCReceiver) RetransmitPackets(track *DownTrack, packets []uint16) {
+	layer, _ := track.spatialLayers()
+	w.Lock()
+	if layer >= len(w.buffers) || w.buffers[layer] == nil {
+		w.Unlock()
+		return
+	}
+	buff := w.buffers[layer]
+	w.Unlock()
+
 	w.nackWorker.Submit(func() {
 		pktBuff := packetFactory.Get().([]byte)
 		for _, sn := range packets {
-			i, err := w.buffers[track.currentSpatialLayer].GetPacket(pktBuff, sn)
+			i, err := buff.GetPacket(pktBuff, sn)
 			if err != nil {
 				if err == io.EOF {
 					break
@@ -199,7 +524,7 @@ func (w *WebRTCReceiver) RetransmitPackets(track *DownTrack, packets []uint16) {
 			if err = pkt.Unmarshal(pktBuff[:i]); err != nil {
 				continue
 			}
-			if err = track.WriteRTP(pkt); err == io.EOF {
+			if err = track.retransmitRTP(pkt); err == io.EOF {
 				break
 			}
 		}
@@ -207,22 +532,36 @@ func (w *WebRTCReceiver) RetransmitPackets(track *DownTrack, packets []uint16) {
 	})
 }
 
-func (w *WebRTCReceiver) writeRTP(layer int) {
+func (w *WebRTCReceiver) writeRTP(layer int, buff *buffer.Buffer) {
 	defer func() {
 		w.closeTracks(layer)
+		w.Lock()
+		w.running--
+		last := w.running == 0
+		w.Unlock()
+		// The requester, nack worker and receiver are shared by the layers
+		if !last {
+			return
+		}
+		w.keyframes.stop()
 		w.nackWorker.Stop()
 		if w.onCloseHandler != nil {
 			w.onCloseHandler()
 		}
 	}()
-	for pkt := range w.buffers[layer].PacketChan() {
+	for pkt := range buff.PacketChan() {
 		w.Lock()
-		for _, dt := range w.downTracks[layer] {
-			if err := dt.WriteRTP(pkt); err == io.EOF {
-				go w.DeleteDownTrack(layer, dt.id)
-			}
+		if w.caches[layer] != nil {
+			w.caches[layer].push(pkt)
 		}
+		dts := w.downTracks[layer]
 		w.Unlock()
+		if w.muted.get() {
+			continue
+		}
+		for _, dt := range dts {
+			dt.enqueue(pkt)
+		}
 	}
 }
 
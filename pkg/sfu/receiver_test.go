@@ -2,7 +2,12 @@ package sfu
 
 import (
 	"testing"
+	"time"
 
+	"github.com/gammazero/workerpool"
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,3 +35,186 @@ func TestWebRTCReceiver_OnCloseHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestWebRTCReceiver_ForceLayer(t *testing.T) {
+	tests := []struct {
+		name       string
+		simulcast  bool
+		layer      int
+		current    int
+		target     int
+		want       error
+		wantLayers [3]int
+	}{
+		{
+			name:       "Must switch subscribers to the forced layer",
+			simulcast:  true,
+			layer:      0,
+			current:    2,
+			target:     2,
+			wantLayers: [3]int{1, 0, 1},
+		},
+		{
+			name:       "Must cancel a switch in progress",
+			simulcast:  true,
+			layer:      2,
+			current:    2,
+			target:     1,
+			wantLayers: [3]int{0, 0, 1},
+		},
+		{
+			name:       "Must release the forced layer",
+			simulcast:  true,
+			layer:      -1,
+			current:    2,
+			target:     2,
+			wantLayers: [3]int{0, 0, 1},
+		},
+		{
+			name:       "Must not force a layer not received",
+			simulcast:  true,
+			layer:      3,
+			current:    2,
+			target:     2,
+			want:       errLayerNotFound,
+			wantLayers: [3]int{0, 0, 1},
+		},
+		{
+			name:       "Must not force a layer of a simple track",
+			layer:      0,
+			current:    2,
+			target:     2,
+			want:       errNotSimulcast,
+			wantLayers: [3]int{0, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := &WebRTCReceiver{
+				isSimulcast: tt.simulcast,
+				upTracks:    []*webrtc.TrackRemote{{}, {}, {}},
+				caches:      make([]*keyframeCache, 3),
+				downTracks:  [][]*DownTrack{{}, {}, {}},
+			}
+			dt := &DownTrack{peerID: "sub", receiver: w, trackType: SimulcastDownTrack, currentSpatialLayer: tt.current}
+			dt.simulcast.targetSpatialLayer = tt.target
+			w.downTracks[tt.current] = []*DownTrack{dt}
+			if tt.target != tt.current {
+				w.downTracks[tt.target] = []*DownTrack{dt}
+			}
+
+			assert.Equal(t, tt.want, w.ForceLayer(tt.layer))
+			for i, n := range tt.wantLayers {
+				assert.Len(t, w.downTracks[i], n)
+			}
+			if tt.want == nil && tt.layer >= 0 {
+				assert.Equal(t, tt.layer, dt.simulcast.targetSpatialLayer)
+				assert.Equal(t, errLayerForced, w.SubDownTrack(dt, 1))
+			}
+		})
+	}
+}
+
+func TestWebRTCReceiver_MuteStop(t *testing.T) {
+	w := &WebRTCReceiver{downTracks: make([][]*DownTrack, 1)}
+	dt := &DownTrack{peerID: "sub", receiver: w, done: make(chan struct{})}
+	w.downTracks[0] = []*DownTrack{dt}
+
+	w.Mute(true)
+	assert.True(t, w.Muted())
+	assert.False(t, dt.reSync.get())
+	w.Mute(false)
+	assert.False(t, w.Muted())
+	assert.True(t, dt.reSync.get())
+
+	closed := false
+	dt.OnCloseHandler(func() { closed = true })
+	w.Stop()
+	assert.True(t, closed)
+	w.AddDownTrack(&DownTrack{}, false)
+	assert.Len(t, w.downTracks[0], 1)
+	assert.Equal(t, errNoReceiverFound, w.SubDownTrack(&DownTrack{}, 0))
+}
+
+func TestWebRTCReceiver_idleLayers(t *testing.T) {
+	w := &WebRTCReceiver{
+		isSimulcast: true,
+		upTracks:    []*webrtc.TrackRemote{{}, nil, {}},
+		caches:      make([]*keyframeCache, 3),
+		downTracks:  [][]*DownTrack{{}, nil, {}},
+	}
+	var reported [][]int
+	var seqs []uint64
+	w.onIdleLayers(func(seq uint64, layers []int) {
+		seqs = append(seqs, seq)
+		reported = append(reported, layers)
+	})
+
+	dt := &DownTrack{peerID: "sub"}
+	w.AddDownTrack(dt, true)
+	assert.NoError(t, w.SubDownTrack(dt, 0))
+	// Layers not received yet are never reported idle
+	w.DeleteDownTrack(2, "sub")
+	w.DeleteDownTrack(2, "sub")
+	assert.Equal(t, [][]int{{0}, {}, {2}}, reported)
+	assert.Equal(t, []uint64{1, 2, 3}, seqs)
+}
+
+func TestWebRTCReceiver_idleLayersCaches(t *testing.T) {
+	w := &WebRTCReceiver{
+		upTracks:   []*webrtc.TrackRemote{{}, {}, {}},
+		caches:     make([]*keyframeCache, 3),
+		downTracks: [][]*DownTrack{{{}}, {{}}, {}},
+	}
+	w.onIdleLayers(func(uint64, []int) {})
+	w.idleLayersChanged()
+	assert.Equal(t, []int{2}, w.idle)
+
+	cached := []*keyframeCache{newKeyframeCache("", KeyframeCacheConfig{}), newKeyframeCache("", KeyframeCacheConfig{}), newKeyframeCache("", KeyframeCacheConfig{})}
+	copy(w.caches, cached)
+	w.downTracks[1] = nil
+	w.idleLayersChanged()
+	assert.Equal(t, []int{1, 2}, w.idle)
+	// Only the newly idle layer drops its cache
+	assert.Same(t, cached[0], w.caches[0])
+	assert.NotSame(t, cached[1], w.caches[1])
+	assert.Same(t, cached[2], w.caches[2])
+}
+
+func TestWebRTCReceiver_writeRTP(t *testing.T) {
+	w := &WebRTCReceiver{
+		isSimulcast: true,
+		nackWorker:  workerpool.New(1),
+	}
+	w.keyframes = newKeyframeRequester(KeyframeConfig{}, false, func([]rtcp.Packet) {})
+	closed := make(chan struct{})
+	w.OnCloseHandler(func() { close(closed) })
+
+	var buffs []*buffer.Buffer
+	for layer := 0; layer < 2; layer++ {
+		buff := buffer.NewBuffer(uint32(layer), nil, nil)
+		buff.OnClose(func() {})
+		buffs = append(buffs, buff)
+		w.AddUpTrack(&webrtc.TrackRemote{}, buff, layer)
+	}
+
+	// The remaining layer still requests keyframes
+	assert.NoError(t, buffs[0].Close())
+	assert.Eventually(t, func() bool {
+		w.Lock()
+		defer w.Unlock()
+		return w.running == 1
+	}, time.Second, 10*time.Millisecond)
+	w.RequestKeyframe(keyframeRequesterSFU, 1, false)
+	assert.Equal(t, uint64(1), w.KeyframeRequests()[keyframeRequesterSFU])
+
+	assert.NoError(t, buffs[1].Close())
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("receiver not closed after the last layer")
+	}
+	w.RequestKeyframe(keyframeRequesterSFU, 1, false)
+	assert.Equal(t, uint64(1), w.KeyframeRequests()[keyframeRequesterSFU])
+}
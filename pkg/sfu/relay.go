@@ -0,0 +1,244 @@
+package sfu
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/lucsky/cuid"
+	log "github.com/pion/ion-log"
+	"github.com/pion/webrtc/v3"
+)
+
+// relayChannelLabel is the data channel of a relay connection carrying the
+// layer requests from the remote node
+const relayChannelLabel = "ion-sfu-relay"
+
+// RelayTrack describes a track forwarded over a relay connection. Every
+// layer of a simulcast track is relayed as an independent track.
+type RelayTrack struct {
+	Mid       string `json:"mid"`
+	TrackID   string `json:"trackId"`
+	StreamID  string `json:"streamId"`
+	Layer     int    `json:"layer"`
+	Simulcast bool   `json:"simulcast"`
+}
+
+// RelaySignal is the message exchanged between two SFU nodes to
+// establish a relay connection. ICE candidates are gathered before
+// the description is returned, so no trickle is needed.
+type RelaySignal struct {
+	Description webrtc.SessionDescription `json:"description"`
+	Tracks      []RelayTrack              `json:"tracks,omitempty"`
+}
+
+// RelayLayers is sent by the remote node when the simulcast layers of a
+// relayed track used by its subscribers change. The origin node pauses the
+// Paused layers and forwards the other ones.
+type RelayLayers struct {
+	StreamID string `json:"streamId"`
+	TrackID  string `json:"trackId"`
+	Paused   []int  `json:"paused"`
+
+	// seq orders the idle layer reports of the origin receiver
+	seq uint64
+}
+
+// RelayPeer forwards the tracks of local receivers to a session living
+// in another SFU node. The remote node accepts the relay with
+// SFU.AcceptRelay and exposes the tracks as a regular publisher, NACKs
+// and keyframe requests from the remote subscribers flow back through
+// the relay to the origin publisher, and the simulcast layers no remote
+// subscriber uses are paused. Relays only run over WebRTC, plain RTP+RTCP
+// links aren't supported.
+type RelayPeer struct {
+	sync.Mutex
+	id     string
+	sub    *Subscriber
+	tracks []RelayTrack
+	dts    map[*DownTrack]int
+}
+
+// NewRelayPeer creates a new RelayPeer
+func NewRelayPeer(cfg WebRTCTransportConfig) (*RelayPeer, error) {
+	id := cuid.New()
+	sub, err := NewSubscriber(id, cfg)
+	if err != nil {
+		return nil, err
+	}
+	sub.OnNegotiationNeeded(func() {})
+
+	r := &RelayPeer{
+		id:  id,
+		sub: sub,
+		dts: make(map[*DownTrack]int),
+	}
+	dc, err := sub.pc.CreateDataChannel(relayChannelLabel, nil)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var l RelayLayers
+		if err := json.Unmarshal(msg.Data, &l); err != nil {
+			log.Errorf("Unmarshal relay layers err: %v", err)
+			return
+		}
+		r.setLayers(l)
+	})
+	return r, nil
+}
+
+// ID returns the relay id
+func (r *RelayPeer) ID() string {
+	return r.id
+}
+
+// AddReceiver relays every available layer of the receiver, receivers
+// must be added before the relay offer is created.
+func (r *RelayPeer) AddReceiver(recv Receiver) error {
+	r.Lock()
+	defer r.Unlock()
+
+	codec := recv.Codec()
+	if err := r.sub.me.RegisterCodec(codec, recv.Kind()); err != nil {
+		return err
+	}
+
+	for layer := 0; layer < recv.Layers(); layer++ {
+		if recv.SSRC(layer) == 0 {
+			continue
+		}
+		dt, err := NewDownTrack(webrtc.RTPCodecCapability{
+			MimeType:     codec.MimeType,
+			ClockRate:    codec.ClockRate,
+			Channels:     codec.Channels,
+			SDPFmtpLine:  codec.SDPFmtpLine,
+			RTCPFeedback: []webrtc.RTCPFeedback{{Type: "nack"}, {Type: "nack", Parameter: "pli"}},
+		}, recv, r.id)
+		if err != nil {
+			return err
+		}
+		dt.bufferFactory = r.sub.bufferFactory
+		if dt.transceiver, err = r.sub.pc.AddTransceiverFromTrack(dt, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		}); err != nil {
+			return err
+		}
+		dt.trackType = SimpleDownTrack
+		dt.setSpatialLayer(layer)
+		dt.OnBind(func() {})
+		dt.OnCloseHandler(func() {
+			if err := r.sub.pc.RemoveTrack(dt.transceiver.Sender()); err != nil {
+				log.Errorf("Error closing relay track: %v", err)
+			}
+		})
+		r.sub.AddDownTrack(recv.StreamID(), dt)
+		if err := recv.SubDownTrack(dt, layer); err != nil {
+			return err
+		}
+		r.dts[dt] = len(r.tracks)
+		r.tracks = append(r.tracks, RelayTrack{
+			TrackID:   recv.TrackID(),
+			StreamID:  recv.StreamID(),
+			Layer:     layer,
+			Simulcast: recv.IsSimulcast(),
+		})
+	}
+	return nil
+}
+
+// Offer creates the relay offer to be sent to the remote node
+func (r *RelayPeer) Offer() (RelaySignal, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	gatherComplete := webrtc.GatheringCompletePromise(r.sub.pc)
+	if _, err := r.sub.CreateOffer(); err != nil {
+		return RelaySignal{}, err
+	}
+	<-gatherComplete
+
+	for dt, idx := range r.dts {
+		r.tracks[idx].Mid = dt.transceiver.Mid()
+	}
+	tracks := make([]RelayTrack, len(r.tracks))
+	copy(tracks, r.tracks)
+
+	return RelaySignal{
+		Description: *r.sub.pc.LocalDescription(),
+		Tracks:      tracks,
+	}, nil
+}
+
+// setLayers pauses the layers of a simulcast track not used by the
+// subscribers of the remote node
+func (r *RelayPeer) setLayers(l RelayLayers) {
+	r.Lock()
+	defer r.Unlock()
+	for dt, idx := range r.dts {
+		t := r.tracks[idx]
+		if !t.Simulcast || t.StreamID != l.StreamID || t.TrackID != l.TrackID {
+			continue
+		}
+		paused := false
+		for _, layer := range l.Paused {
+			if layer == t.Layer {
+				paused = true
+				break
+			}
+		}
+		dt.Mute(paused)
+	}
+}
+
+// SetAnswer sets the answer returned by the remote node
+func (r *RelayPeer) SetAnswer(answer RelaySignal) error {
+	return r.sub.SetRemoteDescription(answer.Description)
+}
+
+// Close the relay connection
+func (r *RelayPeer) Close() error {
+	return r.sub.Close()
+}
+
+// AcceptRelay answers a relay offer from a remote node, the relayed
+// tracks are published to every peer of the session.
+func (s *Session) AcceptRelay(offer RelaySignal, cfg WebRTCTransportConfig) (RelaySignal, error) {
+	pub, err := NewPublisher(s, cuid.New(), cfg)
+	if err != nil {
+		return RelaySignal{}, err
+	}
+
+	pub.relayTracks = make(map[string]RelayTrack, len(offer.Tracks))
+	for _, t := range offer.Tracks {
+		pub.relayTracks[t.Mid] = t
+	}
+
+	pub.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		switch state {
+		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
+			s.RemoveRelay(pub.id)
+		}
+	})
+
+	s.AddRelay(pub)
+
+	gatherComplete := webrtc.GatheringCompletePromise(pub.pc)
+	if _, err := pub.Answer(offer.Description); err != nil {
+		s.RemoveRelay(pub.id)
+		pub.Close()
+		return RelaySignal{}, err
+	}
+	<-gatherComplete
+
+	return RelaySignal{Description: *pub.pc.LocalDescription()}, nil
+}
+
+// AcceptRelay answers a relay offer from a remote node for the given session
+func (s *SFU) AcceptRelay(sid string, offer RelaySignal) (RelaySignal, error) {
+	session, cfg := s.GetSession(sid)
+	if session == nil {
+		return RelaySignal{}, ErrSessionUnavailable
+	}
+	return session.AcceptRelay(offer, cfg)
+}
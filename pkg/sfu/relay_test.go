@@ -0,0 +1,119 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func waitForReceiver(t *testing.T, router Router, trackID string) Receiver {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if recv, ok := router.GetReceivers()[trackID]; ok {
+			return recv
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("receiver %s not found", trackID)
+	return nil
+}
+
+func TestRelayPeer_AcceptRelay(t *testing.T) {
+	s, err := NewSFU(Config{})
+	assert.NoError(t, err)
+
+	me := webrtc.MediaEngine{}
+	assert.NoError(t, me.RegisterDefaultCodecs())
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&me))
+	remote, err := api.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer remote.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	senders := addMedia(done, t, remote, []media{{kind: "video", id: "stream1", tid: "video1"}})
+
+	origin, cfg := s.GetSession("origin")
+	pub, err := NewPublisher(origin, "publisher", cfg)
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	offer, err := remote.CreateOffer(nil)
+	assert.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(remote)
+	assert.NoError(t, remote.SetLocalDescription(offer))
+	<-gatherComplete
+	answer, err := pub.Answer(*remote.LocalDescription())
+	assert.NoError(t, err)
+	assert.NoError(t, remote.SetRemoteDescription(answer))
+	close(senders[0].start)
+
+	recv := waitForReceiver(t, pub.GetRouter(), "video1")
+
+	relay, err := NewRelayPeer(cfg)
+	assert.NoError(t, err)
+	defer relay.Close()
+	assert.NoError(t, relay.AddReceiver(recv))
+
+	relayOffer, err := relay.Offer()
+	assert.NoError(t, err)
+	assert.Len(t, relayOffer.Tracks, 1)
+	assert.NotEmpty(t, relayOffer.Tracks[0].Mid)
+
+	relayAnswer, err := s.AcceptRelay("edge", relayOffer)
+	assert.NoError(t, err)
+	assert.NoError(t, relay.SetAnswer(relayAnswer))
+
+	edge, _ := s.GetSession("edge")
+	edge.mu.RLock()
+	assert.Len(t, edge.relays, 1)
+	var relayPub *Publisher
+	for _, p := range edge.relays {
+		relayPub = p
+	}
+	edge.mu.RUnlock()
+
+	relayed := waitForReceiver(t, relayPub.GetRouter(), "video1")
+	assert.Equal(t, "stream1", relayed.StreamID())
+	assert.False(t, relayed.IsSimulcast())
+}
+
+func TestRelayPeer_setLayers(t *testing.T) {
+	r := &RelayPeer{dts: make(map[*DownTrack]int)}
+	for i, rt := range []RelayTrack{
+		{TrackID: "video", StreamID: "stream", Layer: 0, Simulcast: true},
+		{TrackID: "video", StreamID: "stream", Layer: 1, Simulcast: true},
+		{TrackID: "audio", StreamID: "stream"},
+	} {
+		dt := &DownTrack{}
+		dt.enabled.set(true)
+		r.dts[dt] = i
+		r.tracks = append(r.tracks, rt)
+	}
+	enabled := func() []bool {
+		e := make([]bool, len(r.tracks))
+		for dt, idx := range r.dts {
+			e[idx] = dt.enabled.get()
+		}
+		return e
+	}
+
+	r.setLayers(RelayLayers{StreamID: "stream", TrackID: "video", Paused: []int{1}})
+	assert.Equal(t, []bool{true, false, true}, enabled())
+	r.setLayers(RelayLayers{StreamID: "stream", TrackID: "audio", Paused: []int{0}})
+	assert.Equal(t, []bool{true, false, true}, enabled())
+	r.setLayers(RelayLayers{StreamID: "stream", TrackID: "video", Paused: []int{0}})
+	assert.Equal(t, []bool{false, true, true}, enabled())
+}
+
+func TestPublisher_requestLayersOrder(t *testing.T) {
+	p := &Publisher{}
+	p.requestLayers(RelayLayers{StreamID: "stream", TrackID: "video", Paused: []int{0}, seq: 2})
+	// Stale reports are dropped
+	p.requestLayers(RelayLayers{StreamID: "stream", TrackID: "video", Paused: []int{}, seq: 1})
+	assert.Equal(t, []int{0}, p.relayLayers["stream video"].Paused)
+	p.requestLayers(RelayLayers{StreamID: "stream", TrackID: "video", Paused: []int{1}, seq: 3})
+	assert.Equal(t, []int{1}, p.relayLayers["stream video"].Paused)
+}
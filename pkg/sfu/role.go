@@ -0,0 +1,81 @@
+package sfu
+
+import "github.com/pion/sdp/v3"
+
+// Role of a peer in a session, set at join with a token or by a host
+type Role string
+
+const (
+	// RoleHost can do everything, including moderating other peers
+	RoleHost Role = "host"
+	// RolePresenter can publish tracks, share its screen and send data
+	// channel messages
+	RolePresenter Role = "presenter"
+	// RoleSharer is an attendee that can share its screen
+	RoleSharer Role = "sharer"
+	// RoleAttendee can only subscribe and send data channel messages
+	RoleAttendee Role = "attendee"
+)
+
+// screenShareContent is the RFC 4796 content of the video media sections
+// of screen shares, declared with a=content:slides in the publisher offer
+const screenShareContent = "slides"
+
+// Permissions are the actions allowed to a peer by its role
+type Permissions struct {
+	// Publish allows publishing camera and microphone tracks
+	Publish bool
+	// ScreenShare allows publishing the video tracks negotiated as screen
+	// shares
+	ScreenShare bool
+	// DataChannel allows sending data channel messages to other peers
+	DataChannel bool
+	// Mute allows muting, forcing the layer of or stopping the tracks of
+	// other peers
+	Mute bool
+	// Kick allows removing other peers from the session
+	Kick bool
+}
+
+// Valid returns true for the known roles
+func (r Role) Valid() bool {
+	switch r {
+	case RoleHost, RolePresenter, RoleSharer, RoleAttendee:
+		return true
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by the role
+func (r Role) Permissions() Permissions {
+	switch r {
+	case RoleHost:
+		return Permissions{Publish: true, ScreenShare: true, DataChannel: true, Mute: true, Kick: true}
+	case RolePresenter:
+		return Permissions{Publish: true, ScreenShare: true, DataChannel: true}
+	case RoleSharer:
+		return Permissions{ScreenShare: true, DataChannel: true}
+	case RoleAttendee:
+		return Permissions{DataChannel: true}
+	}
+	return Permissions{}
+}
+
+// canPublish returns true if the track can be published, screen is true
+// for the tracks negotiated as screen shares
+func (p Permissions) canPublish(screen bool) bool {
+	if screen {
+		return p.ScreenShare
+	}
+	return p.Publish
+}
+
+// isScreenShare returns true if the media section is a video negotiated as
+// a screen share, the stream and track ids chosen by the client don't count
+func isScreenShare(md *sdp.MediaDescription) bool {
+	if md == nil || md.MediaName.Media != "video" {
+		return false
+	}
+	content, _ := md.Attribute("content")
+	return content == screenShareContent
+}
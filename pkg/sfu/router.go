@@ -13,16 +13,22 @@ import (
 // Router defines a track rtp/rtcp router
 type Router interface {
 	ID() string
-	AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote) (Receiver, bool)
+	AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, layer int, simulcast bool) (Receiver, bool)
 	AddDownTracks(s *Subscriber, r Receiver) error
+	GetReceivers() map[string]Receiver
 	Stop()
 }
 
 // RouterConfig defines router configurations
 type RouterConfig struct {
-	MaxBandwidth  uint64          `mapstructure:"maxbandwidth"`
-	MaxBufferTime int             `mapstructure:"maxbuffertime"`
-	Simulcast     SimulcastConfig `mapstructure:"simulcast"`
+	MaxBandwidth  uint64              `mapstructure:"maxbandwidth"`
+	MaxBufferTime int                 `mapstructure:"maxbuffertime"`
+	MaxNackTimes  int                 `mapstructure:"maxnacktimes"`
+	NackDeadline  int                 `mapstructure:"nackdeadline"`
+	Simulcast     SimulcastConfig     `mapstructure:"simulcast"`
+	Pacer         PacerConfig         `mapstructure:"pacer"`
+	KeyframeCache KeyframeCacheConfig `mapstructure:"keyframecache"`
+	Keyframe      KeyframeConfig      `mapstructure:"keyframe"`
 }
 
 type router struct {
@@ -33,10 +39,12 @@ type router struct {
 	rtcpCh    chan []rtcp.Packet
 	config    RouterConfig
 	receivers map[string]Receiver
+	// bufferFactory of the publisher peer connection
+	bufferFactory *buffer.Factory
 }
 
 // newRouter for routing rtp/rtcp packets
-func newRouter(peer *webrtc.PeerConnection, id string, config RouterConfig) Router {
+func newRouter(peer *webrtc.PeerConnection, id string, config RouterConfig, bufferFactory *buffer.Factory) Router {
 	ch := make(chan []rtcp.Packet, 10)
 	r := &router{
 		id:        id,
@@ -45,6 +53,8 @@ func newRouter(peer *webrtc.PeerConnection, id string, config RouterConfig) Rout
 		rtcpCh:    ch,
 		config:    config,
 		receivers: make(map[string]Receiver),
+
+		bufferFactory: bufferFactory,
 	}
 
 	r.twcc.onFeedback = func(packet []rtcp.Packet) {
@@ -63,18 +73,28 @@ func (r *router) Stop() {
 	close(r.rtcpCh)
 }
 
-func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote) (Receiver, bool) {
+// setConfig updates the router config, the new config applies to the
+// tracks published and subscribed afterwards, and the maxbandwidth to the
+// tracks already published.
+func (r *router) setConfig(config RouterConfig) {
+	r.Lock()
+	r.config = config
+	r.Unlock()
+	for _, recv := range r.GetReceivers() {
+		if wr, ok := recv.(*WebRTCReceiver); ok {
+			wr.setMaxBandwidth(config.MaxBandwidth)
+		}
+	}
+}
+
+func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRemote, layer int, simulcast bool) (Receiver, bool) {
 	r.Lock()
 	defer r.Unlock()
 
 	publish := false
 	trackID := track.ID()
 
-	buff, rtcpReader := bufferFactory.GetBufferPair(uint32(track.SSRC()))
-
-	buff.OnFeedback(func(fb []rtcp.Packet) {
-		r.rtcpCh <- fb
-	})
+	buff, rtcpReader := r.bufferFactory.GetBufferPair(uint32(track.SSRC()))
 
 	buff.OnTransportWideCC(func(sn uint16, timeNS int64, marker bool) {
 		r.twcc.push(sn, timeNS, marker)
@@ -96,7 +116,10 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 
 	recv := r.receivers[trackID]
 	if recv == nil {
-		recv = NewWebRTCReceiver(receiver, track, r.id)
+		recv = NewWebRTCReceiver(receiver, track, r.id, simulcast)
+		if wr, ok := recv.(*WebRTCReceiver); ok {
+			wr.setConfig(r.config)
+		}
 		r.receivers[trackID] = recv
 		recv.SetRTCPCh(r.rtcpCh)
 		recv.OnCloseHandler(func() {
@@ -105,7 +128,10 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 		publish = true
 	}
 
-	recv.AddUpTrack(track, buff)
+	// Keyframe requests of the buffer are throttled with the subscribers ones
+	buff.OnFeedback(recv.SendRTCP)
+
+	recv.AddUpTrack(track, buff, layer)
 
 	if r.twcc.mSSRC == 0 {
 		r.twcc.tccLastReport = time.Now().UnixNano()
@@ -113,13 +139,26 @@ func (r *router) AddReceiver(receiver *webrtc.RTPReceiver, track *webrtc.TrackRe
 	}
 
 	buff.Bind(receiver.GetParameters(), buffer.Options{
-		BufferTime: r.config.MaxBufferTime,
-		MaxBitRate: r.config.MaxBandwidth,
+		BufferTime:   r.config.MaxBufferTime,
+		MaxBitRate:   r.config.MaxBandwidth,
+		MaxNackTimes: r.config.MaxNackTimes,
+		NackDeadline: r.config.NackDeadline,
 	})
 
 	return recv, publish
 }
 
+// GetReceivers returns a copy of the receivers published by this router
+func (r *router) GetReceivers() map[string]Receiver {
+	r.RLock()
+	defer r.RUnlock()
+	receivers := make(map[string]Receiver, len(r.receivers))
+	for id, recv := range r.receivers {
+		receivers[id] = recv
+	}
+	return receivers
+}
+
 // AddWebRTCSender to router
 func (r *router) AddDownTracks(s *Subscriber, recv Receiver) error {
 	r.Lock()
@@ -152,6 +191,10 @@ func (r *router) addDownTrack(sub *Subscriber, recv Receiver) error {
 	}
 
 	codec := recv.Codec()
+	if !sub.canDecode(codec.MimeType) {
+		log.Warnf("Skipping track %s for peer %s, can't decode %s", recv.TrackID(), sub.id, codec.MimeType)
+		return nil
+	}
 	if err := sub.me.RegisterCodec(codec, recv.Kind()); err != nil {
 		return err
 	}
@@ -161,11 +204,12 @@ func (r *router) addDownTrack(sub *Subscriber, recv Receiver) error {
 		ClockRate:    codec.ClockRate,
 		Channels:     codec.Channels,
 		SDPFmtpLine:  codec.SDPFmtpLine,
-		RTCPFeedback: []webrtc.RTCPFeedback{{"goog-remb", ""}, {"nack", ""}, {"nack", "pli"}},
+		RTCPFeedback: []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}},
 	}, recv, sub.id)
 	if err != nil {
 		return err
 	}
+	outTrack.bufferFactory = sub.bufferFactory
 	// Create webrtc sender for the peer we are sending track to
 	if outTrack.transceiver, err = sub.pc.AddTransceiverFromTrack(outTrack, webrtc.RTPTransceiverInit{
 		Direction: webrtc.RTPTransceiverDirectionSendonly,
@@ -186,6 +230,12 @@ func (r *router) addDownTrack(sub *Subscriber, recv Receiver) error {
 		go sub.sendStreamDownTracksReports(recv.StreamID())
 	})
 
+	outTrack.pacer = sub.pacer
+	outTrack.api = sub.api
+	outTrack.simulcast.temporalEnabled = r.config.Simulcast.EnableTemporalLayer
+	if r.config.Simulcast.Probe.Enabled && recv.IsSimulcast() {
+		outTrack.probe = newProber(r.config.Simulcast.Probe)
+	}
 	sub.AddDownTrack(recv.StreamID(), outTrack)
 	recv.AddDownTrack(outTrack, r.config.Simulcast.BestQualityFirst)
 	return nil
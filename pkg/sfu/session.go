@@ -1,18 +1,76 @@
 package sfu
 
 import (
+	"encoding/json"
+	"strings"
 	"sync"
+	"time"
 
 	log "github.com/pion/ion-log"
 	"github.com/pion/webrtc/v3"
 )
 
+// SessionConfig defines the policy of a session, zero values mean no
+// limits and the defaults of the sfu config.
+type SessionConfig struct {
+	// MaxPeers is the max number of peers joined to the session
+	MaxPeers int `mapstructure:"maxpeers" json:"maxPeers,omitempty"`
+	// MaxPublishers is the max number of peers publishing tracks
+	MaxPublishers int `mapstructure:"maxpublishers" json:"maxPublishers,omitempty"`
+	// MaxBandwidth caps the router maxbandwidth in kbps
+	MaxBandwidth uint64 `mapstructure:"maxbandwidth" json:"maxBandwidth,omitempty"`
+	// Simulcast overrides the router simulcast config
+	Simulcast *SimulcastConfig `mapstructure:"simulcast" json:"simulcast,omitempty"`
+	// AllowedCodecs are the mime types that can be published, e.g. "video/VP8"
+	AllowedCodecs []string `mapstructure:"allowedcodecs" json:"allowedCodecs,omitempty"`
+	// DisableAutoSubscribe stops subscribing peers to every track of the
+	// session, subscriptions are made with Session.SubscribeTo instead.
+	DisableAutoSubscribe bool `mapstructure:"disableautosubscribe" json:"disableAutoSubscribe,omitempty"`
+	// DisableDataChannelRelay stops relaying data channels between peers
+	DisableDataChannelRelay bool `mapstructure:"disabledatachannelrelay" json:"disableDataChannelRelay,omitempty"`
+	// DataChannels are the relay policies of the data channel labels
+	DataChannels []DataChannelConfig `mapstructure:"datachannels" json:"dataChannels,omitempty"`
+	// DefaultRole is the role of the peers joining without one, presenter
+	// when empty.
+	DefaultRole Role `mapstructure:"defaultrole" json:"defaultRole,omitempty"`
+}
+
+// Track events sent to the publisher of a track controlled by a moderator
+const (
+	TrackMuted   = "mute"
+	TrackUnmuted = "unmute"
+	TrackLayer   = "layer"
+	TrackStopped = "stop"
+)
+
+// TrackEvent tells a publisher a moderator changed how its track is
+// forwarded, Layer is the forced simulcast layer or -1 once released.
+type TrackEvent struct {
+	Type    string `json:"type"`
+	TrackID string `json:"trackId"`
+	Layer   int    `json:"layer"`
+}
+
+// TrackControl is a moderator request on a published track, Type is one
+// of the track events.
+type TrackControl struct {
+	PeerID  string `json:"peerId"`
+	TrackID string `json:"trackId"`
+	Type    string `json:"type"`
+	Layer   int    `json:"layer"`
+}
+
 // Session represents a set of peers. Transports inside a session
 // are automatically subscribed to each other.
 type Session struct {
 	id             string
 	mu             sync.RWMutex
+	config         SessionConfig
 	peers          map[string]*Peer
+	roles          map[string]Role
+	publishers     map[string]struct{}
+	relays         map[string]*Publisher
+	limiter        *messageLimiter
 	onCloseHandler func()
 	closed         bool
 }
@@ -20,17 +78,56 @@ type Session struct {
 // NewSession creates a new session
 func NewSession(id string) *Session {
 	return &Session{
-		id:     id,
-		peers:  make(map[string]*Peer),
-		closed: false,
+		id:         id,
+		peers:      make(map[string]*Peer),
+		roles:      make(map[string]Role),
+		publishers: make(map[string]struct{}),
+		relays:     make(map[string]*Publisher),
+		limiter:    newMessageLimiter(),
+		closed:     false,
+	}
+}
+
+// Config returns the session policy
+func (s *Session) Config() SessionConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// SetConfig sets the session policy, limits apply to the peers and
+// tracks added afterwards.
+func (s *Session) SetConfig(c SessionConfig) {
+	s.mu.Lock()
+	s.config = c
+	s.mu.Unlock()
+}
+
+// routerConfig applies the session policy to the sfu router config
+func (s *Session) routerConfig(c RouterConfig) RouterConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.config.MaxBandwidth != 0 && (c.MaxBandwidth == 0 || s.config.MaxBandwidth < c.MaxBandwidth) {
+		c.MaxBandwidth = s.config.MaxBandwidth
 	}
+	if s.config.Simulcast != nil {
+		c.Simulcast = *s.config.Simulcast
+	}
+	return c
 }
 
-// AddPublisher adds a transport to the session
-func (s *Session) AddPeer(peer *Peer) {
+// AddPeer adds a transport to the session, fails when the session is full
+func (s *Session) AddPeer(peer *Peer) error {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config.MaxPeers > 0 && len(s.peers) >= s.config.MaxPeers {
+		return ErrSessionFull
+	}
 	s.peers[peer.id] = peer
-	s.mu.Unlock()
+	if peer.role != "" {
+		s.roles[peer.id] = peer.role
+	}
+	return nil
 }
 
 // RemovePeer removes a transport from the session
@@ -38,36 +135,263 @@ func (s *Session) RemovePeer(pid string) {
 	s.mu.Lock()
 	log.Infof("RemovePeer %s from session %s", pid, s.id)
 	delete(s.peers, pid)
-	s.mu.Unlock()
-
+	delete(s.roles, pid)
+	delete(s.publishers, pid)
 	// Close session if no peers
-	if len(s.peers) == 0 && s.onCloseHandler != nil && !s.closed {
-		s.onCloseHandler()
+	closing := len(s.peers) == 0 && !s.closed
+	if closing {
 		s.closed = true
 	}
+	onClose := s.onCloseHandler
+	s.mu.Unlock()
+	s.limiter.remove(pid)
+
+	if closing {
+		s.closeRelays()
+		if onClose != nil {
+			onClose()
+		}
+	}
 }
 
-func (s *Session) onMessage(origin, label string, msg webrtc.DataChannelMessage) {
+// Role returns the role of a peer, the default role if none was granted
+func (s *Session) Role(pid string) Role {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	for pid, p := range s.peers {
-		if origin == pid {
+	return s.role(pid)
+}
+
+func (s *Session) role(pid string) Role {
+	if r, ok := s.roles[pid]; ok {
+		return r
+	}
+	if s.config.DefaultRole != "" {
+		return s.config.DefaultRole
+	}
+	return RolePresenter
+}
+
+// Permissions returns the permissions granted to a peer by its role
+func (s *Session) Permissions(pid string) Permissions {
+	return s.Role(pid).Permissions()
+}
+
+// permissions returns the permissions of a peer, relays are allowed
+// everything as their tracks were admitted by the origin node.
+func (s *Session) permissions(pid string) Permissions {
+	if _, ok := s.relays[pid]; ok {
+		return RoleHost.Permissions()
+	}
+	return s.role(pid).Permissions()
+}
+
+// SetRole changes the role of a peer, the published tracks the new role
+// doesn't allow are stopped.
+func (s *Session) SetRole(pid string, role Role) error {
+	if !role.Valid() {
+		return errInvalidRole
+	}
+	s.mu.Lock()
+	p, ok := s.peers[pid]
+	if !ok {
+		s.mu.Unlock()
+		return errPeerNotFound
+	}
+	log.Infof("Peer %s role set to %s in session %s", pid, role, s.id)
+	s.roles[pid] = role
+	s.mu.Unlock()
+
+	if p.publisher == nil {
+		return nil
+	}
+	perms := role.Permissions()
+	for trackID, recv := range p.publisher.GetRouter().GetReceivers() {
+		if perms.canPublish(isScreenShareReceiver(recv)) {
 			continue
 		}
+		if err := s.StopTrack(pid, trackID); err != nil {
+			log.Errorf("Stopping track %s of peer %s err: %v", trackID, pid, err)
+		}
+	}
+	return nil
+}
 
-		dc := p.subscriber.channels[label]
-		if dc != nil && dc.ReadyState() == webrtc.DataChannelStateOpen {
-			if msg.IsString {
-				if err := dc.SendText(string(msg.Data)); err != nil {
-					log.Errorf("Sending dc message err: %v", err)
-				}
-			} else {
-				if err := dc.Send(msg.Data); err != nil {
-					log.Errorf("Sending dc message err: %v", err)
-				}
+// Kick closes a peer and removes it from the session
+func (s *Session) Kick(pid string) error {
+	s.mu.RLock()
+	p, ok := s.peers[pid]
+	s.mu.RUnlock()
+	if !ok {
+		return errPeerNotFound
+	}
+	log.Infof("Kicking peer %s from session %s", pid, s.id)
+	return p.Close()
+}
+
+// AddRelay adds a relay publisher to the session, the tracks received
+// from the relay are published to every peer of the session
+func (s *Session) AddRelay(relay *Publisher) {
+	s.mu.Lock()
+	s.relays[relay.id] = relay
+	s.mu.Unlock()
+}
+
+// RemoveRelay removes a relay publisher from the session
+func (s *Session) RemoveRelay(id string) {
+	s.mu.Lock()
+	log.Infof("RemoveRelay %s from session %s", id, s.id)
+	delete(s.relays, id)
+	s.mu.Unlock()
+}
+
+// allowTrack checks the session policy and the peer role before publishing
+// a track of the given peer, the peer counts as a publisher once a track is
+// allowed.
+func (s *Session) allowTrack(pid string, screen bool, codec webrtc.RTPCodecParameters) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.permissions(pid).canPublish(screen) {
+		return ErrPermissionDenied
+	}
+	if len(s.config.AllowedCodecs) > 0 {
+		allowed := false
+		for _, mime := range s.config.AllowedCodecs {
+			if strings.EqualFold(mime, codec.MimeType) {
+				allowed = true
+				break
 			}
 		}
+		if !allowed {
+			return errCodecNotAllowed
+		}
+	}
+	if _, ok := s.publishers[pid]; ok {
+		return nil
+	}
+	if s.config.MaxPublishers > 0 && len(s.publishers) >= s.config.MaxPublishers {
+		return errMaxPublishers
+	}
+	s.publishers[pid] = struct{}{}
+	return nil
+}
+
+// cannotDecode returns the peers, other than the publisher, whose
+// subscriber can't decode the given codec.
+func (s *Session) cannotDecode(pid, mime string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var peers []string
+	for id, p := range s.peers {
+		if id != pid && p.subscriber != nil && !p.subscriber.canDecode(mime) {
+			peers = append(peers, id)
+		}
+	}
+	return peers
+}
+
+// dataChannelConfig returns the relay policy of a label
+func (s *Session) dataChannelConfig(label string) DataChannelConfig {
+	c := DataChannelConfig{Label: label}
+	for _, dc := range s.config.DataChannels {
+		if dc.Label == label {
+			return dc
+		}
+		if dc.Label == dataChannelAnyLabel {
+			c = dc
+		}
+	}
+	return c
+}
+
+// onMessage relays a message received from a peer following the label
+// policy, opened is true if the peer opened the channel itself.
+func (s *Session) onMessage(origin, label string, opened bool, msg webrtc.DataChannelMessage) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.permissions(origin).DataChannel {
+		return
+	}
+
+	c := s.dataChannelConfig(label)
+	switch {
+	case c.Relay == DataChannelRelayNone, c.Relay == DataChannelRelayPublisher && !opened:
+		droppedMessages.WithLabelValues(dropMessageRelay).Inc()
+		return
+	case c.MaxMessageSize > 0 && len(msg.Data) > c.MaxMessageSize:
+		droppedMessages.WithLabelValues(dropMessageSize).Inc()
+		return
+	case !s.limiter.allow(origin, label, c.MaxMessageRate, time.Now()):
+		droppedMessages.WithLabelValues(dropMessageRate).Inc()
+		return
+	}
+
+	var to []string
+	if c.Targeted {
+		var m DataChannelMessage
+		if err := json.Unmarshal(msg.Data, &m); err != nil {
+			log.Debugf("Invalid targeted message from peer %s on %s: %v", origin, label, err)
+			droppedMessages.WithLabelValues(dropMessageInvalid).Inc()
+			return
+		}
+		data, err := json.Marshal(DataChannelMessage{From: origin, Data: m.Data})
+		if err != nil {
+			log.Errorf("Marshal targeted message err: %v", err)
+			return
+		}
+		to, msg.Data = m.To, data
 	}
+	s.sendMessage(origin, label, to, msg)
+}
+
+// SendMessage sends a message from the server on the label channel of the
+// peers in to, or of every peer when empty. Messages are sent as given,
+// also on targeted labels.
+func (s *Session) SendMessage(label string, to []string, msg webrtc.DataChannelMessage) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.sendMessage("", label, to, msg) == 0 {
+		return errNoDataChannelFound
+	}
+	return nil
+}
+
+// sendMessage sends a message on the label channel of the peers in to, or
+// of every peer but the origin when empty. Returns the peers reached, the
+// session must be locked.
+func (s *Session) sendMessage(origin, label string, to []string, msg webrtc.DataChannelMessage) int {
+	peers := s.peers
+	if len(to) > 0 {
+		peers = make(map[string]*Peer, len(to))
+		for _, pid := range to {
+			if p, ok := s.peers[pid]; ok {
+				peers[pid] = p
+			}
+		}
+	}
+
+	sent := 0
+	for pid, p := range peers {
+		if origin == pid || p.subscriber == nil {
+			continue
+		}
+
+		dc := p.subscriber.channels[label]
+		if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+			continue
+		}
+		var err error
+		if msg.IsString {
+			err = dc.SendText(string(msg.Data))
+		} else {
+			err = dc.Send(msg.Data)
+		}
+		if err != nil {
+			log.Errorf("Sending dc message err: %v", err)
+			continue
+		}
+		sent++
+	}
+	return sent
 }
 
 func (s *Session) AddDatachannel(owner string, dc *webrtc.DataChannel) {
@@ -76,12 +400,21 @@ func (s *Session) AddDatachannel(owner string, dc *webrtc.DataChannel) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	if s.config.DisableDataChannelRelay {
+		return
+	}
+
 	s.peers[owner].subscriber.channels[label] = dc
 
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		s.onMessage(owner, label, msg)
+		s.onMessage(owner, label, true, msg)
 	})
 
+	// Peers not allowed to send messages only receive on their channel
+	if !s.permissions(owner).DataChannel {
+		return
+	}
+
 	for pid, p := range s.peers {
 		// Don't add to self
 		if owner == pid {
@@ -96,7 +429,7 @@ func (s *Session) AddDatachannel(owner string, dc *webrtc.DataChannel) {
 
 		pid := pid
 		n.OnMessage(func(msg webrtc.DataChannelMessage) {
-			s.onMessage(pid, label, msg)
+			s.onMessage(pid, label, false, msg)
 		})
 
 		p.subscriber.negotiate()
@@ -109,6 +442,14 @@ func (s *Session) Publish(router Router, r Receiver) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	if s.config.DisableAutoSubscribe {
+		return
+	}
+	if !s.permissions(router.ID()).canPublish(isScreenShareReceiver(r)) {
+		log.Warnf("Peer %s not allowed to publish stream %s", router.ID(), r.StreamID())
+		return
+	}
+
 	for pid, p := range s.peers {
 		// Don't sub to self
 		if router.ID() == pid {
@@ -129,15 +470,16 @@ func (s *Session) Subscribe(peer *Peer) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	subdChans := false
+	subdChans := s.config.DisableDataChannelRelay
 	for pid, p := range s.peers {
 		if pid == peer.id {
 			continue
 		}
-		err := p.publisher.GetRouter().AddDownTracks(peer.subscriber, nil)
-		if err != nil {
-			log.Errorf("Subscribing to router err: %v", err)
-			continue
+		if !s.config.DisableAutoSubscribe {
+			if err := p.publisher.GetRouter().AddDownTracks(peer.subscriber, nil); err != nil {
+				log.Errorf("Subscribing to router err: %v", err)
+				continue
+			}
 		}
 
 		if !subdChans {
@@ -151,7 +493,7 @@ func (s *Session) Subscribe(peer *Peer) {
 				}
 
 				n.OnMessage(func(msg webrtc.DataChannelMessage) {
-					s.onMessage(peer.id, label, msg)
+					s.onMessage(peer.id, label, false, msg)
 				})
 			}
 			subdChans = true
@@ -159,6 +501,183 @@ func (s *Session) Subscribe(peer *Peer) {
 			peer.subscriber.negotiate()
 		}
 	}
+
+	if s.config.DisableAutoSubscribe {
+		return
+	}
+	for _, relay := range s.relays {
+		if err := relay.GetRouter().AddDownTracks(peer.subscriber, nil); err != nil {
+			log.Errorf("Subscribing to relay router err: %v", err)
+		}
+	}
+}
+
+// SubscribeTo subscribes the peer to every track published by the peer
+// or relay with the given id, used when auto subscribe is disabled.
+func (s *Session) SubscribeTo(peer *Peer, pid string) error {
+	router := s.publisherRouter(pid)
+	if router == nil || pid == peer.id {
+		return errNoPublisherFound
+	}
+	return router.AddDownTracks(peer.subscriber, nil)
+}
+
+// UnsubscribeFrom removes the tracks published by the peer or relay with
+// the given id from the peer subscriber.
+func (s *Session) UnsubscribeFrom(peer *Peer, pid string) error {
+	router := s.publisherRouter(pid)
+	if router == nil || pid == peer.id {
+		return errNoPublisherFound
+	}
+	for _, recv := range router.GetReceivers() {
+		peer.subscriber.removeDownTracks(recv)
+	}
+	return nil
+}
+
+// publisherRouter returns the router of a peer or relay, nil if not found
+func (s *Session) publisherRouter(pid string) Router {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.peers[pid]; ok && p.publisher != nil {
+		return p.publisher.GetRouter()
+	} else if relay, ok := s.relays[pid]; ok {
+		return relay.GetRouter()
+	}
+	return nil
+}
+
+// publishedTrack returns the publisher peer and the receiver of a track
+func (s *Session) publishedTrack(pid, trackID string) (*Peer, Router, Receiver, error) {
+	s.mu.RLock()
+	p, ok := s.peers[pid]
+	s.mu.RUnlock()
+	if !ok || p.publisher == nil {
+		return nil, nil, nil, errNoPublisherFound
+	}
+	router := p.publisher.GetRouter()
+	recv, ok := router.GetReceivers()[trackID]
+	if !ok {
+		return nil, nil, nil, errNoReceiverFound
+	}
+	return p, router, recv, nil
+}
+
+// MuteTrack stops or resumes forwarding a published track to every
+// subscriber, the publisher is notified.
+func (s *Session) MuteTrack(pid, trackID string, mute bool) error {
+	p, _, recv, err := s.publishedTrack(pid, trackID)
+	if err != nil {
+		return err
+	}
+	if recv.Muted() == mute {
+		return nil
+	}
+	recv.Mute(mute)
+	e := TrackEvent{Type: TrackUnmuted, TrackID: trackID}
+	if mute {
+		e.Type = TrackMuted
+	}
+	p.trackEvent(e)
+	return nil
+}
+
+// SetTrackLayer forces the simulcast layer sent to every subscriber of a
+// published track, a negative layer gives the choice back to subscribers.
+func (s *Session) SetTrackLayer(pid, trackID string, layer int) error {
+	p, _, recv, err := s.publishedTrack(pid, trackID)
+	if err != nil {
+		return err
+	}
+	if err := recv.ForceLayer(layer); err != nil {
+		return err
+	}
+	if layer < 0 {
+		layer = -1
+	}
+	p.trackEvent(TrackEvent{Type: TrackLayer, TrackID: trackID, Layer: layer})
+	return nil
+}
+
+// StopTrack stops forwarding a published track for good, the track is
+// removed from the subscribers and the publisher is notified to unpublish it.
+func (s *Session) StopTrack(pid, trackID string) error {
+	p, r, recv, err := s.publishedTrack(pid, trackID)
+	if err != nil {
+		return err
+	}
+	if r, ok := r.(*router); ok {
+		r.deleteReceiver(trackID)
+	}
+	recv.Stop()
+	p.trackEvent(TrackEvent{Type: TrackStopped, TrackID: trackID})
+	return nil
+}
+
+// ControlTrack applies a moderator request received from signalling
+func (s *Session) ControlTrack(c TrackControl) error {
+	switch c.Type {
+	case TrackMuted, TrackUnmuted:
+		return s.MuteTrack(c.PeerID, c.TrackID, c.Type == TrackMuted)
+	case TrackLayer:
+		return s.SetTrackLayer(c.PeerID, c.TrackID, c.Layer)
+	case TrackStopped:
+		return s.StopTrack(c.PeerID, c.TrackID)
+	}
+	return errInvalidTrackControl
+}
+
+func (s *Session) copyPeers() []*Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, p := range s.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func (s *Session) copyRelays() []*Publisher {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	relays := make([]*Publisher, 0, len(s.relays))
+	for _, r := range s.relays {
+		relays = append(relays, r)
+	}
+	return relays
+}
+
+// routers returns the routers of every publisher and relay of the session
+func (s *Session) routers() []Router {
+	var routers []Router
+	for _, p := range s.copyPeers() {
+		p.Lock()
+		if p.publisher != nil {
+			routers = append(routers, p.publisher.GetRouter())
+		}
+		p.Unlock()
+	}
+	for _, r := range s.copyRelays() {
+		routers = append(routers, r.GetRouter())
+	}
+	return routers
+}
+
+// Close closes every peer and relay of the session
+func (s *Session) Close() {
+	for _, p := range s.copyPeers() {
+		if err := p.Close(); err != nil {
+			log.Errorf("Closing peer %s err: %v", p.id, err)
+		}
+	}
+	s.closeRelays()
+}
+
+func (s *Session) closeRelays() {
+	for _, r := range s.copyRelays() {
+		s.RemoveRelay(r.id)
+		r.Close()
+	}
 }
 
 // Transports returns peers in this session
@@ -170,5 +689,7 @@ func (s *Session) Peers() map[string]*Peer {
 
 // OnClose is called when the session is closed
 func (s *Session) OnClose(f func()) {
+	s.mu.Lock()
 	s.onCloseHandler = f
+	s.mu.Unlock()
 }
@@ -0,0 +1,338 @@
+package sfu
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession_allowTrack(t *testing.T) {
+	vp8 := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}}
+	h264 := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}}
+
+	type publish struct {
+		pid   string
+		codec webrtc.RTPCodecParameters
+		want  error
+	}
+	tests := []struct {
+		name    string
+		config  SessionConfig
+		publish []publish
+	}{
+		{
+			name: "Must allow every track without policy",
+			publish: []publish{
+				{pid: "p1", codec: vp8},
+				{pid: "p2", codec: h264},
+			},
+		},
+		{
+			name:   "Must reject codecs not allowed",
+			config: SessionConfig{AllowedCodecs: []string{"video/vp8"}},
+			publish: []publish{
+				{pid: "p1", codec: vp8},
+				{pid: "p1", codec: h264, want: errCodecNotAllowed},
+			},
+		},
+		{
+			name:   "Must limit the publishers",
+			config: SessionConfig{MaxPublishers: 1},
+			publish: []publish{
+				{pid: "p1", codec: vp8},
+				{pid: "p1", codec: h264},
+				{pid: "p2", codec: vp8, want: errMaxPublishers},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("session")
+			s.SetConfig(tt.config)
+			for _, p := range tt.publish {
+				assert.Equal(t, p.want, s.allowTrack(p.pid, false, p.codec))
+			}
+		})
+	}
+}
+
+func TestSession_routerConfig(t *testing.T) {
+	s := NewSession("session")
+	global := RouterConfig{MaxBandwidth: 1500, MaxBufferTime: 1000}
+	assert.Equal(t, global, s.routerConfig(global))
+
+	s.SetConfig(SessionConfig{MaxBandwidth: 500, Simulcast: &SimulcastConfig{BestQualityFirst: true}})
+	c := s.routerConfig(global)
+	assert.Equal(t, uint64(500), c.MaxBandwidth)
+	assert.Equal(t, 1000, c.MaxBufferTime)
+	assert.True(t, c.Simulcast.BestQualityFirst)
+
+	s.SetConfig(SessionConfig{MaxBandwidth: 3000})
+	assert.Equal(t, uint64(1500), s.routerConfig(global).MaxBandwidth)
+}
+
+func TestSFU_CreateSession(t *testing.T) {
+	s, err := NewSFU(Config{})
+	assert.NoError(t, err)
+
+	session, err := s.CreateSession("session1", SessionConfig{MaxPeers: 1})
+	assert.NoError(t, err)
+	_, err = s.CreateSession("session1", SessionConfig{})
+	assert.Equal(t, ErrSessionExists, err)
+
+	assert.NoError(t, session.AddPeer(&Peer{id: "peer1"}))
+	p := NewPeer(s)
+	_, err = p.JoinWithConfig("session1", webrtc.SessionDescription{}, SessionConfig{})
+	assert.Equal(t, ErrSessionFull, err)
+	assert.Equal(t, 1, session.Config().MaxPeers)
+	assert.Nil(t, p.publisher)
+}
+
+func TestSession_ControlTrack(t *testing.T) {
+	s := NewSession("session")
+	w := &WebRTCReceiver{trackID: "video", downTracks: make([][]*DownTrack, 1)}
+	r := &router{id: "pub", receivers: map[string]Receiver{"video": w}}
+	var events []TrackEvent
+	pub := &Peer{id: "pub", session: s, publisher: &Publisher{id: "pub", router: r}}
+	pub.OnTrackEvent(func(e TrackEvent) {
+		events = append(events, e)
+	})
+	assert.NoError(t, s.AddPeer(pub))
+
+	tests := []struct {
+		name    string
+		control TrackControl
+		want    error
+		event   *TrackEvent
+	}{
+		{
+			name:    "Must mute the track",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: TrackMuted},
+			event:   &TrackEvent{Type: TrackMuted, TrackID: "video"},
+		},
+		{
+			name:    "Must not notify a track already muted",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: TrackMuted},
+		},
+		{
+			name:    "Must unmute the track",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: TrackUnmuted},
+			event:   &TrackEvent{Type: TrackUnmuted, TrackID: "video"},
+		},
+		{
+			name:    "Must not force a layer of a simple track",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: TrackLayer, Layer: 1},
+			want:    errNotSimulcast,
+		},
+		{
+			name:    "Must reject unknown controls",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: "pause"},
+			want:    errInvalidTrackControl,
+		},
+		{
+			name:    "Must reject unknown publishers",
+			control: TrackControl{PeerID: "sub", TrackID: "video", Type: TrackMuted},
+			want:    errNoPublisherFound,
+		},
+		{
+			name:    "Must stop the track",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: TrackStopped},
+			event:   &TrackEvent{Type: TrackStopped, TrackID: "video"},
+		},
+		{
+			name:    "Must reject stopped tracks",
+			control: TrackControl{PeerID: "pub", TrackID: "video", Type: TrackMuted},
+			want:    errNoReceiverFound,
+		},
+	}
+	for _, tt := range tests {
+		events = nil
+		assert.Equal(t, tt.want, s.ControlTrack(tt.control), tt.name)
+		if tt.event != nil {
+			assert.Equal(t, []TrackEvent{*tt.event}, events, tt.name)
+		} else {
+			assert.Empty(t, events, tt.name)
+		}
+	}
+}
+
+func TestSession_roles(t *testing.T) {
+	vp8 := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}}
+
+	s := NewSession("session")
+	assert.NoError(t, s.AddPeer(&Peer{id: "host", role: RoleHost}))
+	assert.NoError(t, s.AddPeer(&Peer{id: "presenter"}))
+	assert.NoError(t, s.AddPeer(&Peer{id: "attendee", role: RoleAttendee}))
+
+	assert.Equal(t, RoleHost, s.Role("host"))
+	assert.Equal(t, RolePresenter, s.Role("presenter"))
+	assert.Equal(t, ErrPermissionDenied, s.allowTrack("attendee", false, vp8))
+	assert.Equal(t, ErrPermissionDenied, s.allowTrack("attendee", true, vp8))
+	assert.NoError(t, s.allowTrack("presenter", true, vp8))
+	assert.NoError(t, s.AddPeer(&Peer{id: "sharer", role: RoleSharer}))
+	assert.Equal(t, ErrPermissionDenied, s.allowTrack("sharer", false, vp8))
+	assert.NoError(t, s.allowTrack("sharer", true, vp8))
+	assert.True(t, s.Permissions("attendee").DataChannel)
+	assert.False(t, s.Permissions("presenter").Kick)
+
+	assert.Equal(t, errInvalidRole, s.SetRole("presenter", "admin"))
+	assert.Equal(t, errPeerNotFound, s.SetRole("unknown", RoleHost))
+	assert.NoError(t, s.SetRole("presenter", RoleAttendee))
+	assert.Equal(t, ErrPermissionDenied, s.allowTrack("presenter", false, vp8))
+
+	s.SetConfig(SessionConfig{DefaultRole: RoleAttendee})
+	assert.NoError(t, s.AddPeer(&Peer{id: "late"}))
+	assert.Equal(t, RoleAttendee, s.Role("late"))
+
+	// Only peers allowed by their role can moderate
+	host := &Peer{id: "host", session: s}
+	attendee := &Peer{id: "attendee", session: s}
+	assert.Equal(t, ErrPermissionDenied, attendee.Kick("late"))
+	assert.Equal(t, ErrPermissionDenied, attendee.SetRole("late", RoleHost))
+	assert.Equal(t, ErrPermissionDenied, attendee.ControlTrack(TrackControl{PeerID: "host", TrackID: "video", Type: TrackMuted}))
+	assert.NoError(t, host.SetRole("late", RolePresenter))
+	assert.Equal(t, RolePresenter, s.Role("late"))
+	assert.Equal(t, errNoPublisherFound, host.ControlTrack(TrackControl{PeerID: "late", TrackID: "video", Type: TrackMuted}))
+}
+
+func TestSession_screenShare(t *testing.T) {
+	offer := `v=0
+o=- 0 0 IN IP4 127.0.0.1
+s=-
+t=0 0
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:0
+a=msid:screen-1 camera
+a=rtpmap:96 VP8/90000
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:1
+a=content:slides
+a=msid:stream screen
+a=rtpmap:96 VP8/90000
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=mid:2
+a=content:slides
+a=rtpmap:111 opus/48000/2
+`
+	parsed, err := (&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}).Unmarshal()
+	assert.NoError(t, err)
+	camera, screen, audio := parsed.MediaDescriptions[0], parsed.MediaDescriptions[1], parsed.MediaDescriptions[2]
+
+	// The stream id doesn't make a camera a screen share
+	assert.False(t, isScreenShare(camera))
+	assert.True(t, isScreenShare(screen))
+	assert.False(t, isScreenShare(audio))
+	assert.False(t, isScreenShare(nil))
+
+	vp8 := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}}
+	s := NewSession("session")
+	assert.NoError(t, s.AddPeer(&Peer{id: "attendee", role: RoleAttendee}))
+	assert.NoError(t, s.AddPeer(&Peer{id: "sharer", role: RoleSharer}))
+	assert.Equal(t, ErrPermissionDenied, s.allowTrack("attendee", isScreenShare(camera), vp8))
+	assert.Equal(t, ErrPermissionDenied, s.allowTrack("sharer", isScreenShare(camera), vp8))
+	assert.NoError(t, s.allowTrack("sharer", isScreenShare(screen), vp8))
+}
+
+func TestSession_SetRoleStopsTracks(t *testing.T) {
+	s := NewSession("session")
+	camera := &WebRTCReceiver{trackID: "camera", streamID: "stream", downTracks: [][]*DownTrack{{}}}
+	screen := &WebRTCReceiver{trackID: "screen", streamID: "stream", downTracks: [][]*DownTrack{{}}}
+	screen.screenShare.set(true)
+	r := &router{id: "pub", receivers: map[string]Receiver{"camera": camera, "screen": screen}}
+	pub := &Peer{id: "pub", publisher: &Publisher{id: "pub", router: r}}
+	var events []TrackEvent
+	pub.OnTrackEvent(func(e TrackEvent) { events = append(events, e) })
+	assert.NoError(t, s.AddPeer(pub))
+
+	// A sharer keeps sharing its screen, the camera is stopped
+	assert.NoError(t, s.SetRole("pub", RoleSharer))
+	assert.Equal(t, []TrackEvent{{Type: TrackStopped, TrackID: "camera"}}, events)
+	assert.True(t, camera.stopped)
+	assert.False(t, screen.stopped)
+	assert.Len(t, r.GetReceivers(), 1)
+
+	assert.NoError(t, s.SetRole("pub", RoleAttendee))
+	assert.True(t, screen.stopped)
+	assert.Empty(t, r.GetReceivers())
+}
+
+func TestSession_UnsubscribeFrom(t *testing.T) {
+	s := NewSession("session")
+	w := &WebRTCReceiver{trackID: "video", streamID: "stream", downTracks: [][]*DownTrack{{}}}
+	pub := &Peer{id: "pub", publisher: &Publisher{id: "pub", router: &router{id: "pub", receivers: map[string]Receiver{"video": w}}}}
+	sub := &Peer{id: "sub", subscriber: &Subscriber{id: "sub", tracks: make(map[string][]*DownTrack)}}
+	assert.NoError(t, s.AddPeer(pub))
+	assert.NoError(t, s.AddPeer(sub))
+
+	dt := &DownTrack{id: "video", peerID: "sub", streamID: "stream", receiver: w, done: make(chan struct{})}
+	other := &DownTrack{id: "audio", peerID: "sub", streamID: "stream", receiver: &WebRTCReceiver{}}
+	w.downTracks[0] = []*DownTrack{dt}
+	sub.subscriber.tracks["stream"] = []*DownTrack{dt, other}
+
+	assert.Equal(t, errNoPublisherFound, s.UnsubscribeFrom(sub, "unknown"))
+	assert.Equal(t, errNoPublisherFound, s.UnsubscribeFrom(pub, "pub"))
+	assert.NoError(t, s.UnsubscribeFrom(sub, "pub"))
+	assert.Equal(t, []*DownTrack{other}, sub.subscriber.GetDownTracks("stream"))
+	assert.Empty(t, w.downTracks[0])
+	select {
+	case <-dt.done:
+	default:
+		t.Fatal("down track not closed")
+	}
+}
+
+func TestSession_RemovePeer(t *testing.T) {
+	s, err := NewSFU(Config{})
+	assert.NoError(t, err)
+	session, cfg := s.GetSession("session")
+	relay, err := NewPublisher(session, "relay", cfg)
+	assert.NoError(t, err)
+	session.AddRelay(relay)
+	assert.NoError(t, session.AddPeer(&Peer{id: "peer"}))
+
+	session.RemovePeer("peer")
+	assert.Empty(t, session.copyRelays())
+	assert.Equal(t, webrtc.PeerConnectionStateClosed, relay.pc.ConnectionState())
+	assert.Nil(t, s.getSession("session"))
+}
+
+func TestPeer_handlersConcurrent(t *testing.T) {
+	p := NewPeer(nil)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.OnMigrate(func() {})
+		p.OnTrackEvent(func(TrackEvent) {})
+	}()
+	p.migrate()
+	p.trackEvent(TrackEvent{})
+	wg.Wait()
+
+	migrated := false
+	p.OnMigrate(func() { migrated = true })
+	p.migrate()
+	assert.True(t, migrated)
+}
+
+func TestSession_RemovePeerConcurrent(t *testing.T) {
+	s := NewSession("session")
+	closed := 0
+	s.OnClose(func() { closed++ })
+	var wg sync.WaitGroup
+	for _, pid := range []string{"p1", "p2"} {
+		assert.NoError(t, s.AddPeer(&Peer{id: pid}))
+	}
+	for _, pid := range []string{"p1", "p2"} {
+		wg.Add(1)
+		go func(pid string) {
+			defer wg.Done()
+			s.RemovePeer(pid)
+		}(pid)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, closed)
+}
@@ -1,12 +1,19 @@
 package sfu
 
 import (
+	"context"
+	"math"
 	"math/rand"
+	"net"
+	"reflect"
 	"runtime"
 	"sync"
 	"time"
 
+	"github.com/lucsky/cuid"
+	"github.com/pion/ice/v2"
 	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/ion-sfu/pkg/registry"
 
 	"github.com/pion/webrtc/v3"
 
@@ -30,11 +37,16 @@ type WebRTCTransportConfig struct {
 	configuration webrtc.Configuration
 	setting       webrtc.SettingEngine
 	router        RouterConfig
+	codecs        CodecConfig
+	tcpMux        *ice.TCPMuxDefault
+	// bufferFactory holds the rtp/rtcp buffers of this transport config
+	bufferFactory *buffer.Factory
 }
 
 // WebRTCConfig defines parameters for ice
 type WebRTCConfig struct {
 	ICEPortRange []uint16          `mapstructure:"portrange"`
+	ICETCPPort   int               `mapstructure:"icetcpport"`
 	ICEServers   []ICEServerConfig `mapstructure:"iceserver"`
 	Candidates   Candidates        `mapstructure:"candidates"`
 	SDPSemantics string            `mapstructure:"sdpsemantics"`
@@ -43,28 +55,105 @@ type WebRTCConfig struct {
 // Config for base SFU
 type Config struct {
 	SFU struct {
-		Ballast int64 `mapstructure:"ballast"`
+		Ballast int64  `mapstructure:"ballast"`
+		NodeID  string `mapstructure:"nodeid"`
+		// DrainTimeout is the max time in seconds to wait for the sessions
+		// to close on shutdown before closing the remaining peers.
+		DrainTimeout int `mapstructure:"draintimeout"`
+		// DrainMigrate asks peers to reconnect to another node on shutdown.
+		DrainMigrate bool `mapstructure:"drainmigrate"`
+		// TokenSecret is the HS256 secret of the join tokens granting the
+		// peer roles, peers must join with a valid token when set.
+		TokenSecret string `mapstructure:"tokensecret"`
 	} `mapstructure:"sfu"`
-	WebRTC WebRTCConfig `mapstructure:"webrtc"`
-	Log    log.Config   `mapstructure:"log"`
-	Router RouterConfig `mapstructure:"router"`
+	Session  SessionConfig   `mapstructure:"session"`
+	Codecs   CodecConfig     `mapstructure:"codecs"`
+	WebRTC   WebRTCConfig    `mapstructure:"webrtc"`
+	Log      log.Config      `mapstructure:"log"`
+	Router   RouterConfig    `mapstructure:"router"`
+	Registry registry.Config `mapstructure:"registry"`
 }
 
+const portRangeLimit = 100
+
+// Callers skipped by the log when printing the caller, kept by InitLog so
+// Reload applies a new level the same way
 var (
-	bufferFactory *buffer.Factory
-	packetFactory *sync.Pool
+	logMu        sync.Mutex
+	logFixByFile []string
+	logFixByFunc []string
 )
 
+// InitLog initializes the log at the config level, fixByFile and fixByFunc
+// are the callers skipped when printing the caller of a log.
+func InitLog(c log.Config, fixByFile, fixByFunc []string) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logFixByFile, logFixByFunc = fixByFile, fixByFunc
+	log.Init(c.Level, fixByFile, fixByFunc)
+}
+
+func reloadLog(c log.Config) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	log.Init(c.Level, logFixByFile, logFixByFunc)
+}
+
+var packetFactory = &sync.Pool{
+	New: func() interface{} {
+		return make([]byte, 1460)
+	},
+}
+
+// Validate checks the config values
+func (c *Config) Validate() error {
+	if len(c.WebRTC.ICEPortRange) > 2 ||
+		len(c.WebRTC.ICEPortRange) == 2 && int(c.WebRTC.ICEPortRange[1])-int(c.WebRTC.ICEPortRange[0]) < portRangeLimit {
+		return errInvalidPortRange
+	}
+	if err := c.Codecs.validate(); err != nil {
+		return err
+	}
+	if c.Router.MaxBufferTime < 0 {
+		return errInvalidBufferTime
+	}
+	if c.Router.MaxNackTimes < 0 || c.Router.MaxNackTimes > math.MaxUint8 || c.Router.NackDeadline < 0 {
+		return errInvalidNack
+	}
+	if c.Session.DefaultRole != "" && !c.Session.DefaultRole.Valid() {
+		return errInvalidRole
+	}
+	for _, dc := range c.Session.DataChannels {
+		if err := dc.validate(); err != nil {
+			return err
+		}
+	}
+	switch c.Log.Level {
+	case "", "trace", "debug", "info", "warn", "error":
+	default:
+		return errInvalidLogLevel
+	}
+	return nil
+}
+
 // SFU represents an sfu instance
 type SFU struct {
+	config   Config
 	webrtc   WebRTCTransportConfig
 	router   RouterConfig
 	mu       sync.RWMutex
 	sessions map[string]*Session
+	nodeID   string
+	registry registry.Registry
+	draining atomicBool
+	migrate  bool
+	closed   chan struct{}
+	// closeOnce closes the node resources on the first Shutdown
+	closeOnce sync.Once
 }
 
 // NewWebRTCTransportConfig parses our settings and returns a usable WebRTCTransportConfig for creating PeerConnections
-func NewWebRTCTransportConfig(c Config) WebRTCTransportConfig {
+func NewWebRTCTransportConfig(c Config) (WebRTCTransportConfig, error) {
 	se := webrtc.SettingEngine{}
 
 	var icePortStart, icePortEnd uint16
@@ -76,7 +165,7 @@ func NewWebRTCTransportConfig(c Config) WebRTCTransportConfig {
 
 	if icePortStart != 0 || icePortEnd != 0 {
 		if err := se.SetEphemeralUDPPortRange(icePortStart, icePortEnd); err != nil {
-			panic(err)
+			return WebRTCTransportConfig{}, err
 		}
 	}
 
@@ -94,6 +183,27 @@ func NewWebRTCTransportConfig(c Config) WebRTCTransportConfig {
 		}
 	}
 
+	var tcpMux *ice.TCPMuxDefault
+	if c.WebRTC.ICETCPPort != 0 {
+		tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: c.WebRTC.ICETCPPort})
+		if err != nil {
+			return WebRTCTransportConfig{}, err
+		}
+		log.Infof("Listening for ICE-TCP at %s", tcpListener.Addr())
+		tcpMux = ice.NewTCPMuxDefault(ice.TCPMuxParams{
+			Listener:       tcpListener,
+			ReadBufferSize: 32,
+		})
+		se.SetICETCPMux(tcpMux)
+		se.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4,
+			webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4,
+			webrtc.NetworkTypeTCP6,
+		})
+	}
+
+	bufferFactory := buffer.NewBufferFactory()
 	se.BufferFactory = bufferFactory.GetOrNew
 
 	sdpSemantics := webrtc.SDPSemanticsUnifiedPlan
@@ -109,56 +219,94 @@ func NewWebRTCTransportConfig(c Config) WebRTCTransportConfig {
 			ICEServers:   iceServers,
 			SDPSemantics: sdpSemantics,
 		},
-		setting: se,
-		router:  c.Router,
+		setting:       se,
+		router:        c.Router,
+		codecs:        c.Codecs,
+		tcpMux:        tcpMux,
+		bufferFactory: bufferFactory,
 	}
 
 	if len(c.WebRTC.Candidates.NAT1To1IPs) > 0 {
 		w.setting.SetNAT1To1IPs(c.WebRTC.Candidates.NAT1To1IPs, webrtc.ICECandidateTypeHost)
 	}
 
-	return w
+	return w, nil
 }
 
-// NewSFU creates a new sfu instance
-func NewSFU(c Config) *SFU {
+// NewSFU creates a new sfu instance, fails if the ICE-TCP port can't be
+// listened on or the registry type is unknown. The redis registry connects
+// on first use, while it can't be reached the errors are logged and the
+// sessions are served locally.
+func NewSFU(c Config) (*SFU, error) {
 	// Init random seed
 	rand.Seed(time.Now().UnixNano())
 	// Init ballast
 	ballast := make([]byte, c.SFU.Ballast*1024*1024)
-	// Init buffer factory
-	bufferFactory = buffer.NewBufferFactory()
-	// Init packet factory
-	packetFactory = &sync.Pool{
-		New: func() interface{} {
-			return make([]byte, 1460)
-		},
+
+	w, err := NewWebRTCTransportConfig(c)
+	if err != nil {
+		return nil, err
 	}
 
-	w := NewWebRTCTransportConfig(c)
+	r, err := registry.New(c.Registry)
+	if err != nil {
+		if w.tcpMux != nil {
+			if err := w.tcpMux.Close(); err != nil {
+				log.Errorf("Closing ICE-TCP mux err: %v", err)
+			}
+		}
+		return nil, err
+	}
+
+	nodeID := c.SFU.NodeID
+	if nodeID == "" {
+		nodeID = cuid.New()
+	}
 
 	s := &SFU{
+		config:   c,
 		webrtc:   w,
 		sessions: make(map[string]*Session),
+		nodeID:   nodeID,
+		registry: r,
+		migrate:  c.SFU.DrainMigrate,
+		closed:   make(chan struct{}),
 	}
 
+	go s.refreshSessions(c.Registry.ClaimTTL() / 2)
+
 	runtime.KeepAlive(ballast)
-	return s
+	return s, nil
 }
 
-// NewSession creates a new session instance
-func (s *SFU) newSession(id string) *Session {
+// NewSession creates a new session instance, returns the existing
+// session and false if another one was created concurrently.
+func (s *SFU) newSession(id string, c SessionConfig) (*Session, bool) {
+	s.mu.Lock()
+	if session, ok := s.sessions[id]; ok {
+		s.mu.Unlock()
+		return session, false
+	}
 	session := NewSession(id)
+	session.config = c
+	s.sessions[id] = session
+	s.mu.Unlock()
+
 	session.OnClose(func() {
 		s.mu.Lock()
 		delete(s.sessions, id)
 		s.mu.Unlock()
+		if err := s.registry.Release(id, s.nodeID); err != nil {
+			log.Errorf("Releasing session %s err: %v", id, err)
+		}
 	})
 
-	s.mu.Lock()
-	s.sessions[id] = session
-	s.mu.Unlock()
-	return session
+	if owner, err := s.registry.Claim(id, s.nodeID); err != nil {
+		log.Errorf("Claiming session %s err: %v", id, err)
+	} else if owner != s.nodeID {
+		log.Warnf("Session %s is owned by node %s, serving it locally", id, owner)
+	}
+	return session, true
 }
 
 // GetSession by id
@@ -168,10 +316,248 @@ func (s *SFU) getSession(id string) *Session {
 	return s.sessions[id]
 }
 
+// GetSession returns the session with the given id, creating it if it
+// doesn't exist. Returns a nil session when the node is draining.
 func (s *SFU) GetSession(sid string) (*Session, WebRTCTransportConfig) {
+	s.mu.RLock()
+	w := s.webrtc
+	s.mu.RUnlock()
+	if s.draining.get() {
+		return nil, w
+	}
 	session := s.getSession(sid)
 	if session == nil {
-		session = s.newSession(sid)
+		s.mu.RLock()
+		c := s.config.Session
+		s.mu.RUnlock()
+		session, _ = s.newSession(sid, c)
+	}
+	return session, w
+}
+
+// CreateSession creates a session with its own policy, fails if the
+// session already exists or the node is draining.
+func (s *SFU) CreateSession(sid string, c SessionConfig) (*Session, error) {
+	if s.draining.get() {
+		return nil, ErrSessionUnavailable
+	}
+	session, created := s.newSession(sid, c)
+	if !created {
+		return nil, ErrSessionExists
+	}
+	return session, nil
+}
+
+// VerifyToken checks the join token of a peer when a token secret is set
+// and returns the role it grants, tokens are ignored otherwise.
+func (s *SFU) VerifyToken(sid, token string) (Role, error) {
+	s.mu.RLock()
+	secret := s.config.SFU.TokenSecret
+	s.mu.RUnlock()
+	if secret == "" {
+		return "", nil
+	}
+	c, err := ParseToken(secret, token, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if c.SID != sid {
+		return "", ErrInvalidToken
+	}
+	return c.Role, nil
+}
+
+// Reload validates and applies a new config to the running node. ICE
+// servers and codecs apply to peers joining afterwards, router settings to
+// the tracks published afterwards with the session caps, maxbandwidth also
+// to the tracks already published, the session policy to new sessions and
+// the log level with the callers given to InitLog. Returns the settings
+// that changed but can only be applied with a restart.
+func (s *SFU) Reload(c Config) ([]string, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	old := s.config
+	var restart []string
+	for _, setting := range []struct {
+		name    string
+		changed bool
+	}{
+		{"sfu.ballast", c.SFU.Ballast != old.SFU.Ballast},
+		{"sfu.nodeid", c.SFU.NodeID != old.SFU.NodeID},
+		{"sfu.draintimeout", c.SFU.DrainTimeout != old.SFU.DrainTimeout},
+		{"webrtc.portrange", !reflect.DeepEqual(c.WebRTC.ICEPortRange, old.WebRTC.ICEPortRange)},
+		{"webrtc.icetcpport", c.WebRTC.ICETCPPort != old.WebRTC.ICETCPPort},
+		{"webrtc.candidates", !reflect.DeepEqual(c.WebRTC.Candidates, old.WebRTC.Candidates)},
+		{"webrtc.sdpsemantics", c.WebRTC.SDPSemantics != old.WebRTC.SDPSemantics},
+		{"registry", c.Registry != old.Registry},
+	} {
+		if setting.changed {
+			restart = append(restart, setting.name)
+		}
+	}
+
+	if !old.WebRTC.Candidates.IceLite {
+		iceServers := make([]webrtc.ICEServer, 0, len(c.WebRTC.ICEServers))
+		for _, iceServer := range c.WebRTC.ICEServers {
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs:       iceServer.URLs,
+				Username:   iceServer.Username,
+				Credential: iceServer.Credential,
+			})
+		}
+		s.webrtc.configuration.ICEServers = iceServers
+	}
+	s.webrtc.router = c.Router
+	s.webrtc.codecs = c.Codecs
+	s.migrate = c.SFU.DrainMigrate
+	s.config.WebRTC.ICEServers = c.WebRTC.ICEServers
+	s.config.Router = c.Router
+	s.config.Session = c.Session
+	s.config.Codecs = c.Codecs
+	s.config.Log = c.Log
+	s.config.SFU.DrainMigrate = c.SFU.DrainMigrate
+	s.config.SFU.TokenSecret = c.SFU.TokenSecret
+	s.mu.Unlock()
+
+	if c.Log != old.Log {
+		reloadLog(c.Log)
+	}
+
+	for _, session := range s.localSessions() {
+		for _, r := range session.routers() {
+			if r, ok := r.(*router); ok {
+				r.setConfig(session.routerConfig(c.Router))
+			}
+		}
+	}
+	return restart, nil
+}
+
+// NodeID returns the id this node registers its sessions with
+func (s *SFU) NodeID() string {
+	return s.nodeID
+}
+
+// LocateSession returns the node owning the session when it lives in
+// another node, an empty string means the session can be served locally.
+func (s *SFU) LocateSession(sid string) string {
+	if s.getSession(sid) != nil {
+		return ""
+	}
+	owner, err := s.registry.Lookup(sid)
+	if err != nil {
+		log.Errorf("Locating session %s err: %v", sid, err)
+		return ""
+	}
+	if owner == s.nodeID {
+		return ""
+	}
+	return owner
+}
+
+// Drain stops accepting new peers in the node, peers already connected
+// keep working. Peers are asked to reconnect to another node when
+// migrate is set, the claims of the local sessions are released so
+// they can be served by another node.
+func (s *SFU) Drain(migrate bool) {
+	s.draining.set(true)
+	for _, session := range s.localSessions() {
+		if err := s.registry.Release(session.id, s.nodeID); err != nil {
+			log.Errorf("Releasing session %s err: %v", session.id, err)
+		}
+		if !migrate {
+			continue
+		}
+		for _, p := range session.copyPeers() {
+			p.migrate()
+		}
+	}
+}
+
+// Draining returns true if the node doesn't accept new peers
+func (s *SFU) Draining() bool {
+	return s.draining.get()
+}
+
+// Shutdown drains the node and waits for all its sessions to close. When
+// the context is done before, the remaining sessions are closed and the
+// context error is returned.
+func (s *SFU) Shutdown(ctx context.Context) error {
+	log.Infof("Draining SFU node %s", s.nodeID)
+	s.mu.RLock()
+	migrate := s.migrate
+	s.mu.RUnlock()
+	s.Drain(migrate)
+
+	var err error
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for len(s.localSessions()) > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	for _, session := range s.localSessions() {
+		session.Close()
+	}
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		if s.webrtc.tcpMux != nil {
+			if err := s.webrtc.tcpMux.Close(); err != nil {
+				log.Errorf("Closing ICE-TCP mux err: %v", err)
+			}
+		}
+		if err := s.registry.Close(); err != nil {
+			log.Errorf("Closing session registry err: %v", err)
+		}
+		s.webrtc.bufferFactory.Close()
+		log.Infof("SFU node %s closed", s.nodeID)
+	})
+	return err
+}
+
+func (s *SFU) localSessions() []*Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// refreshSessions keeps the registry claims of the local sessions alive
+func (s *SFU) refreshSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+		if s.draining.get() {
+			continue
+		}
+		s.mu.RLock()
+		sids := make([]string, 0, len(s.sessions))
+		for sid := range s.sessions {
+			sids = append(sids, sid)
+		}
+		s.mu.RUnlock()
+
+		for _, sid := range sids {
+			if err := s.registry.Refresh(sid, s.nodeID); err != nil {
+				log.Errorf("Refreshing session %s err: %v", sid, err)
+			}
+		}
 	}
-	return session, s.webrtc
 }
@@ -1,11 +1,15 @@
 package sfu
 
 import (
+	"context"
+	"net"
 	"sync"
 	"testing"
 	"time"
 
 	log "github.com/pion/ion-log"
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/transport/packetio"
 	"github.com/pion/webrtc/v3"
 	med "github.com/pion/webrtc/v3/pkg/media"
 	"github.com/stretchr/testify/assert"
@@ -133,7 +137,8 @@ func TestSFU_SessionScenarios(t *testing.T) {
 	fixByFile := []string{"asm_amd64.s", "proc.go", "icegatherer.go", "jsonrpc2"}
 	fixByFunc := []string{"Handle"}
 	log.Init("trace", fixByFile, fixByFunc)
-	sfu := NewSFU(Config{Log: log.Config{Level: "trace"}})
+	sfu, err := NewSFU(Config{Log: log.Config{Level: "trace"}})
+	assert.NoError(t, err)
 
 	tests := []struct {
 		name  string
@@ -341,16 +346,16 @@ func TestSFU_SessionScenarios(t *testing.T) {
 								}
 							})
 
-							p.local.OnIceCandidate = func(init *webrtc.ICECandidateInit, i int) {
+							p.local.OnIceCandidate(func(init *webrtc.ICECandidateInit, i int) {
 								switch i {
 								case subscriber:
 									p.remoteSub.AddICECandidate(*init)
 								case publisher:
 									p.remotePub.AddICECandidate(*init)
 								}
-							}
+							})
 
-							p.local.OnOffer = func(o *webrtc.SessionDescription) {
+							p.local.OnOffer(func(o *webrtc.SessionDescription) {
 								if testDone.get() {
 									return
 								}
@@ -369,7 +374,7 @@ func TestSFU_SessionScenarios(t *testing.T) {
 									err = p.local.SetRemoteDescription(a)
 									assert.NoError(t, err)
 								}()
-							}
+							})
 
 							offer, err := p.remotePub.CreateOffer(nil)
 							assert.NoError(t, err)
@@ -434,3 +439,153 @@ func TestSFU_SessionScenarios(t *testing.T) {
 		})
 	}
 }
+
+func TestNewSFU(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	c := Config{}
+	c.WebRTC.ICETCPPort = l.Addr().(*net.TCPAddr).Port
+	s, err := NewSFU(c)
+	assert.Error(t, err)
+	assert.Nil(t, s)
+}
+
+func TestSFU_LocateSession(t *testing.T) {
+	node1, err := NewSFU(Config{})
+	assert.NoError(t, err)
+	node2, err := NewSFU(Config{})
+	assert.NoError(t, err)
+	node2.registry = node1.registry
+
+	node1.GetSession("session1")
+	assert.Empty(t, node1.LocateSession("session1"))
+	assert.Equal(t, node1.NodeID(), node2.LocateSession("session1"))
+	assert.Empty(t, node2.LocateSession("session2"))
+
+	_, err = NewPeer(node2).Join("session1", webrtc.SessionDescription{})
+	assert.Equal(t, &SessionRedirectError{SID: "session1", Node: node1.NodeID()}, err)
+}
+
+func TestSFU_Shutdown(t *testing.T) {
+	s, err := NewSFU(Config{})
+	assert.NoError(t, err)
+	session, _ := s.GetSession("session1")
+	assert.NotNil(t, session)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	assert.True(t, s.Draining())
+
+	session, _ = s.GetSession("session2")
+	assert.Nil(t, session)
+	_, err = NewPeer(s).Join("session2", webrtc.SessionDescription{})
+	assert.Equal(t, ErrSessionUnavailable, err)
+
+	// Shutting down again must not panic
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+}
+
+func TestSFU_ShutdownKeepsOtherBuffers(t *testing.T) {
+	node1, err := NewSFU(Config{})
+	assert.NoError(t, err)
+	node2, err := NewSFU(Config{})
+	assert.NoError(t, err)
+
+	reader := node2.webrtc.bufferFactory.GetOrNew(packetio.RTCPBufferPacket, 1234)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, node1.Shutdown(ctx))
+
+	_, err = reader.Write([]byte{0})
+	assert.NoError(t, err)
+	assert.Equal(t, reader, node2.webrtc.bufferFactory.GetRTCPReader(1234))
+}
+
+func TestSFU_Reload(t *testing.T) {
+	s, err := NewSFU(Config{})
+	assert.NoError(t, err)
+	session, _ := s.GetSession("session1")
+	pub, err := NewPublisher(session, "publisher", s.webrtc)
+	assert.NoError(t, err)
+	defer pub.Close()
+	session.AddRelay(pub)
+	buff := buffer.NewBuffer(1, nil, nil)
+	pub.GetRouter().(*router).receivers["video"] = &WebRTCReceiver{trackID: "video", buffers: []*buffer.Buffer{buff}}
+
+	c := Config{}
+	c.Router.MaxBandwidth = 500
+	c.Router.Simulcast.BestQualityFirst = true
+	c.WebRTC.ICEServers = []ICEServerConfig{{URLs: []string{"stun:stun.l.google.com:19302"}}}
+	c.WebRTC.SDPSemantics = "plan-b"
+	c.SFU.Ballast = 10
+	restart, err := s.Reload(c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sfu.ballast", "webrtc.sdpsemantics"}, restart)
+
+	_, cfg := s.GetSession("session1")
+	assert.Equal(t, c.Router, cfg.router)
+	assert.Equal(t, []string{"stun:stun.l.google.com:19302"}, cfg.configuration.ICEServers[0].URLs)
+	assert.Equal(t, webrtc.SDPSemanticsUnifiedPlan, cfg.configuration.SDPSemantics)
+	assert.Equal(t, c.Router, pub.GetRouter().(*router).config)
+	// maxbandwidth reaches the tracks already published
+	assert.Equal(t, uint64(500), buff.MaxBitrate())
+
+	// Sessions keep their own caps
+	capped, err := s.CreateSession("session2", SessionConfig{MaxBandwidth: 300, Simulcast: &SimulcastConfig{BestQualityFirst: false}})
+	assert.NoError(t, err)
+	cappedPub, err := NewPublisher(capped, "publisher", s.webrtc)
+	assert.NoError(t, err)
+	defer cappedPub.Close()
+	capped.AddRelay(cappedPub)
+	_, err = s.Reload(c)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(300), cappedPub.GetRouter().(*router).config.MaxBandwidth)
+	assert.False(t, cappedPub.GetRouter().(*router).config.Simulcast.BestQualityFirst)
+	assert.Equal(t, c.Router, pub.GetRouter().(*router).config)
+
+	c.Router.MaxBufferTime = -1
+	_, err = s.Reload(c)
+	assert.Equal(t, errInvalidBufferTime, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	type fields struct {
+		portRange    []uint16
+		logLevel     string
+		maxNackTimes int
+		defaultRole  Role
+		relay        string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   error
+	}{
+		{name: "Must accept empty config"},
+		{name: "Must accept valid port range", fields: fields{portRange: []uint16{5000, 5200}, logLevel: "debug"}},
+		{name: "Must reject short port range", fields: fields{portRange: []uint16{5000, 5010}}, want: errInvalidPortRange},
+		{name: "Must reject inverted port range", fields: fields{portRange: []uint16{5200, 5000}}, want: errInvalidPortRange},
+		{name: "Must reject unknown log level", fields: fields{logLevel: "verbose"}, want: errInvalidLogLevel},
+		{name: "Must reject too many nacks", fields: fields{maxNackTimes: 300}, want: errInvalidNack},
+		{name: "Must reject unknown default role", fields: fields{defaultRole: "admin"}, want: errInvalidRole},
+		{name: "Must accept data channel relay", fields: fields{relay: DataChannelRelayPublisher}},
+		{name: "Must reject unknown data channel relay", fields: fields{relay: "all"}, want: errInvalidDataChannelRelay},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{}
+			c.WebRTC.ICEPortRange = tt.fields.portRange
+			c.Log.Level = tt.fields.logLevel
+			c.Router.MaxNackTimes = tt.fields.maxNackTimes
+			c.Session.DefaultRole = tt.fields.defaultRole
+			c.Session.DataChannels = []DataChannelConfig{{Label: "chat", Relay: tt.fields.relay}}
+			assert.Equal(t, tt.want, c.Validate())
+		})
+	}
+}
@@ -1,29 +1,153 @@
 package sfu
 
-import "time"
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/sdp/v3"
+)
 
 const (
 	quarterResolution = "q"
 	halfResolution    = "h"
 	fullResolution    = "f"
+
+	// maxSimulcastLayers caps the layer of a RID not declared in the
+	// publisher description
+	maxSimulcastLayers = 3
 )
 
+// ridLayer returns the spatial layer of a simulcast track from its RID,
+// besides q/h/f the numeric RIDs used by Firefox and the low/mid/high
+// names used by some clients are mapped. Used when the RIDs can't be
+// read from the publisher description, the layer is capped below layers.
+func ridLayer(rid string, layers int) int {
+	layer, _ := ridRank(rid)
+	if layer >= layers {
+		layer = layers - 1
+	}
+	if layer < 0 {
+		return 0
+	}
+	return layer
+}
+
+// ridRank returns the rank of a well known RID name
+func ridRank(rid string) (int, bool) {
+	switch strings.ToLower(rid) {
+	case quarterResolution, "low", "lo":
+		return 0, true
+	case halfResolution, "mid", "medium":
+		return 1, true
+	case fullResolution, "high", "hi":
+		return 2, true
+	}
+	if n, err := strconv.Atoi(rid); err == nil && n >= 0 {
+		return n, true
+	}
+	return 0, false
+}
+
+type simulcastRID struct {
+	rid   string
+	index int
+	area  int
+	br    int
+}
+
+// simulcastLayers maps the send RIDs of a media section to spatial layers,
+// ordered from the lowest to the highest quality by the declared resolution
+// or bitrate, falling back to well known RID names and to the declared order.
+func simulcastLayers(md *sdp.MediaDescription) map[string]int {
+	var rids []simulcastRID
+	for _, a := range md.Attributes {
+		if a.Key != "rid" {
+			continue
+		}
+		// a=rid:<rid-id> <direction> [pt=<fmt list>;]<restriction>=<value>;...
+		fields := strings.Fields(a.Value)
+		if len(fields) < 2 || fields[1] != "send" {
+			continue
+		}
+		r := simulcastRID{rid: fields[0], index: len(rids)}
+		var width, height int
+		if len(fields) > 2 {
+			for _, param := range strings.Split(fields[2], ";") {
+				kv := strings.SplitN(param, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, _ := strconv.Atoi(kv[1])
+				switch kv[0] {
+				case "max-width":
+					width = v
+				case "max-height":
+					height = v
+				case "max-br":
+					r.br = v
+				}
+			}
+		}
+		r.area = width * height
+		rids = append(rids, r)
+	}
+
+	sort.SliceStable(rids, func(i, j int) bool {
+		a, b := rids[i], rids[j]
+		if a.area > 0 && b.area > 0 && a.area != b.area {
+			return a.area < b.area
+		}
+		if a.br > 0 && b.br > 0 && a.br != b.br {
+			return a.br < b.br
+		}
+		ra, okA := ridRank(a.rid)
+		rb, okB := ridRank(b.rid)
+		if okA && okB && ra != rb {
+			return ra < rb
+		}
+		return a.index < b.index
+	})
+
+	layers := make(map[string]int, len(rids))
+	for i, r := range rids {
+		layers[r.rid] = i
+	}
+	return layers
+}
+
 type SimulcastConfig struct {
-	BestQualityFirst    bool `mapstructure:"bestqualityfirst"`
-	EnableTemporalLayer bool `mapstructure:"enabletemporallayer"`
+	BestQualityFirst    bool `mapstructure:"bestqualityfirst" json:"bestQualityFirst"`
+	EnableTemporalLayer bool `mapstructure:"enabletemporallayer" json:"enableTemporalLayer"`
+	// Probe the subscriber bandwidth before switching to a higher layer
+	Probe ProbeConfig `mapstructure:"probe" json:"probe"`
 }
 
+// maxTemporalLayer is the highest VP8 temporal layer id
+const maxTemporalLayer = 3
+
 type simulcastTrackHelpers struct {
 	targetSpatialLayer int
-	temporalSupported  bool
-	targetTempLayer    int
+	targetTempLayer    int32
 	currentTempLayer   int
 	temporalEnabled    bool
 	lTSCalc            time.Time
 
 	// VP8Helper temporal helpers
-	refPicID  uint16
-	lastPicID uint16
-	refTlzi   uint8
-	lastTlzi  uint8
+	refPicID    uint16
+	lastPicID   uint16
+	refTlzi     uint8
+	lastTlzi    uint8
+	lastInPicID uint16
+	picIDSet    bool
+	dropFrame   bool
+}
+
+// resyncVP8 sets the PictureID and TL0PICIDX offsets of a new source, so
+// the rewritten values continue from the last ones sent
+func (h *simulcastTrackHelpers) resyncVP8(pkt *VP8Helper) {
+	h.refPicID = pkt.PictureID - h.lastPicID - 1
+	h.refTlzi = pkt.TL0PICIDX - h.lastTlzi - 1
+	h.picIDSet = false
 }
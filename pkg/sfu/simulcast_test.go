@@ -0,0 +1,72 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_simulcastLayers(t *testing.T) {
+	tests := []struct {
+		name string
+		rids []string
+		want map[string]int
+	}{
+		{
+			name: "Must order well known RIDs",
+			rids: []string{"f send", "h send", "q send"},
+			want: map[string]int{"q": 0, "h": 1, "f": 2},
+		},
+		{
+			name: "Must order numeric RIDs",
+			rids: []string{"2 send", "1 send", "0 send"},
+			want: map[string]int{"0": 0, "1": 1, "2": 2},
+		},
+		{
+			name: "Must order by declared resolution",
+			rids: []string{"hd send max-width=1280;max-height=720", "sd send max-width=640;max-height=360", "ld send max-width=320;max-height=180", "fhd send max-width=1920;max-height=1080"},
+			want: map[string]int{"ld": 0, "sd": 1, "hd": 2, "fhd": 3},
+		},
+		{
+			name: "Must order by declared bitrate",
+			rids: []string{"a send pt=96;max-br=2500000", "b send pt=96;max-br=150000", "c send pt=96;max-br=500000"},
+			want: map[string]int{"b": 0, "c": 1, "a": 2},
+		},
+		{
+			name: "Must keep declared order of unknown RIDs and ignore recv RIDs",
+			rids: []string{"x send", "y recv", "z send"},
+			want: map[string]int{"x": 0, "z": 1},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			md := &sdp.MediaDescription{}
+			for _, rid := range tt.rids {
+				md.WithValueAttribute("rid", rid)
+			}
+			assert.Equal(t, tt.want, simulcastLayers(md))
+		})
+	}
+}
+
+func TestWebRTCReceiver_Layers(t *testing.T) {
+	w := &WebRTCReceiver{isSimulcast: true}
+	dt := &DownTrack{}
+	assert.Equal(t, 0, w.Layers())
+	assert.Equal(t, errNoReceiverFound, w.SubDownTrack(dt, 4))
+
+	w.upTracks = make([]*webrtc.TrackRemote, 5)
+	w.downTracks = make([][]*DownTrack, 5)
+	w.downTracks[4] = []*DownTrack{}
+	assert.Equal(t, 5, w.Layers())
+	assert.Equal(t, uint32(0), w.SSRC(3))
+	assert.Equal(t, uint32(0), w.SSRC(7))
+	assert.NoError(t, w.SubDownTrack(dt, 4))
+	assert.Equal(t, errNoReceiverFound, w.SubDownTrack(dt, 3))
+	w.DeleteDownTrack(4, dt.peerID)
+	w.DeleteDownTrack(9, dt.peerID)
+	assert.Empty(t, w.downTracks[4])
+}
@@ -3,14 +3,15 @@ package sfu
 import (
 	"io"
 	"math"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/pion/rtcp"
 
 	"github.com/bep/debounce"
 	log "github.com/pion/ion-log"
+	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -24,6 +25,14 @@ type Subscriber struct {
 	tracks     map[string][]*DownTrack
 	channels   map[string]*webrtc.DataChannel
 	candidates []webrtc.ICECandidateInit
+	// codecs the remote end can decode, nil if unknown
+	codecs map[string]struct{}
+	// pacer of the down tracks, nil if pacing is disabled
+	pacer *pacer
+	// api serves the ion-sfu data channel
+	api *apiChannel
+	// bufferFactory holds the rtcp readers of the down tracks
+	bufferFactory *buffer.Factory
 
 	negotiate func()
 
@@ -51,6 +60,11 @@ func NewSubscriber(id string, cfg WebRTCTransportConfig) (*Subscriber, error) {
 		pc:       pc,
 		tracks:   make(map[string][]*DownTrack),
 		channels: make(map[string]*webrtc.DataChannel),
+
+		bufferFactory: cfg.bufferFactory,
+	}
+	if cfg.router.Pacer.Enabled {
+		s.pacer = newPacer(cfg.router.Pacer)
 	}
 
 	dc, err := pc.CreateDataChannel(apiChannelLabel, &webrtc.DataChannelInit{})
@@ -58,7 +72,7 @@ func NewSubscriber(id string, cfg WebRTCTransportConfig) (*Subscriber, error) {
 		log.Errorf("DC creation error: %v", err)
 		return nil, errPeerConnectionInitFailed
 	}
-	handleAPICommand(s, dc)
+	s.api = newAPIChannel(s, dc)
 
 	pc.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
 		log.Debugf("ice connection state: %s", connectionState)
@@ -166,8 +180,95 @@ func (s *Subscriber) GetDownTracks(streamID string) []*DownTrack {
 	return s.tracks[streamID]
 }
 
+// selectDownTracks returns the down tracks of a stream, of every stream
+// when the stream id is empty, or the single track with the track id.
+func (s *Subscriber) selectDownTracks(t APITrack) []*DownTrack {
+	s.RLock()
+	defer s.RUnlock()
+	var dts []*DownTrack
+	for streamID, tracks := range s.tracks {
+		if t.StreamID != "" && streamID != t.StreamID {
+			continue
+		}
+		for _, dt := range tracks {
+			if t.TrackID == "" || dt.id == t.TrackID {
+				dts = append(dts, dt)
+			}
+		}
+	}
+	return dts
+}
+
+// removeDownTracks unsubscribes from the tracks of a receiver
+func (s *Subscriber) removeDownTracks(recv Receiver) {
+	s.Lock()
+	var removed, kept []*DownTrack
+	for _, dt := range s.tracks[recv.StreamID()] {
+		if dt.receiver == recv {
+			removed = append(removed, dt)
+		} else {
+			kept = append(kept, dt)
+		}
+	}
+	if len(kept) > 0 {
+		s.tracks[recv.StreamID()] = kept
+	} else {
+		delete(s.tracks, recv.StreamID())
+	}
+	s.Unlock()
+
+	for _, dt := range removed {
+		current, target := dt.spatialLayers()
+		recv.DeleteDownTrack(current, s.id)
+		if target != current {
+			recv.DeleteDownTrack(target, s.id)
+		}
+		dt.Close()
+	}
+}
+
+// setCodecs sets the mime types the remote end can decode
+func (s *Subscriber) setCodecs(codecs map[string]struct{}) {
+	s.Lock()
+	s.codecs = codecs
+	s.Unlock()
+}
+
+// canDecode returns true if the remote end can decode the codec, or if
+// its codecs of the same kind are unknown
+func (s *Subscriber) canDecode(mime string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	mime = strings.ToLower(mime)
+	if _, ok := s.codecs[mime]; ok {
+		return true
+	}
+	kind := mime[:strings.Index(mime, "/")+1]
+	for codec := range s.codecs {
+		if strings.HasPrefix(codec, kind) {
+			return false
+		}
+	}
+	return true
+}
+
 // Close peer
 func (s *Subscriber) Close() error {
+	s.RLock()
+	for _, dts := range s.tracks {
+		for _, dt := range dts {
+			dt.stop()
+			current, target := dt.spatialLayers()
+			dt.receiver.DeleteDownTrack(current, s.id)
+			if target != current {
+				dt.receiver.DeleteDownTrack(target, s.id)
+			}
+		}
+	}
+	s.RUnlock()
+	if s.pacer != nil {
+		s.pacer.stop()
+	}
 	return s.pc.Close()
 }
 
@@ -183,19 +284,7 @@ func (s *Subscriber) downTracksReports() {
 				if !dt.bound.get() {
 					continue
 				}
-				now := time.Now().UnixNano()
-				nowNTP := timeToNtp(now)
-				lastPktMs := atomic.LoadInt64(&dt.lastPacketMs)
-				maxPktTs := atomic.LoadUint32(&dt.lastTS)
-				diffTs := uint32((now/1e6)-lastPktMs) * dt.codec.ClockRate / 1000
-				octets, packets := dt.getSRStats()
-				r = append(r, &rtcp.SenderReport{
-					SSRC:        dt.ssrc,
-					NTPTime:     nowNTP,
-					RTPTime:     maxPktTs + diffTs,
-					PacketCount: packets,
-					OctetCount:  octets,
-				})
+				r = append(r, dt.senderReport(time.Now().UnixNano()))
 				sd = append(sd, rtcp.SourceDescriptionChunk{
 					Source: dt.ssrc,
 					Items: []rtcp.SourceDescriptionItem{{
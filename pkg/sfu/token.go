@@ -0,0 +1,84 @@
+package sfu
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// TokenClaims are the claims of a join token, tokens are HS256 JWTs so
+// they can be issued by any JWT library sharing the sfu tokensecret.
+type TokenClaims struct {
+	// SID is the session the token allows to join
+	SID string `json:"sid"`
+	// Role of the peer, the session default role when empty
+	Role Role `json:"role,omitempty"`
+	// ExpiresAt is the unix time in seconds the token expires at, zero
+	// means no expiry
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+var tokenEncoding = base64.RawURLEncoding
+
+// NewToken returns a join token with the given claims signed with secret
+func NewToken(secret string, c TokenClaims) (string, error) {
+	header, err := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	payload := tokenEncoding.EncodeToString(header) + "." + tokenEncoding.EncodeToString(claims)
+	return payload + "." + tokenEncoding.EncodeToString(signToken(secret, payload)), nil
+}
+
+// ParseToken verifies a join token signed with secret and returns its claims
+func ParseToken(secret, token string, now time.Time) (TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return TokenClaims{}, ErrInvalidToken
+	}
+	sig, err := tokenEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, signToken(secret, parts[0]+"."+parts[1])) {
+		return TokenClaims{}, ErrInvalidToken
+	}
+	var header tokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return TokenClaims{}, ErrInvalidToken
+	}
+	var c TokenClaims
+	if err := decodeTokenPart(parts[1], &c); err != nil {
+		return TokenClaims{}, ErrInvalidToken
+	}
+	if c.Role != "" && !c.Role.Valid() {
+		return TokenClaims{}, ErrInvalidToken
+	}
+	if c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt {
+		return TokenClaims{}, ErrInvalidToken
+	}
+	return c, nil
+}
+
+func signToken(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload)) // nolint:errcheck
+	return mac.Sum(nil)
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := tokenEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
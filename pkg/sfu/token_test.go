@@ -0,0 +1,148 @@
+package sfu
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToken(t *testing.T) {
+	now := time.Unix(1000, 0)
+	valid, err := NewToken("secret", TokenClaims{SID: "room", Role: RoleHost, ExpiresAt: 2000})
+	assert.NoError(t, err)
+	expired, err := NewToken("secret", TokenClaims{SID: "room", ExpiresAt: 1000})
+	assert.NoError(t, err)
+	badRole, err := NewToken("secret", TokenClaims{SID: "room", Role: "admin"})
+	assert.NoError(t, err)
+	parts := strings.Split(valid, ".")
+	// {"alg":"none","typ":"JWT"}
+	unsigned := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."
+
+	tests := []struct {
+		name   string
+		secret string
+		token  string
+		want   TokenClaims
+		err    error
+	}{
+		{
+			name:   "Must parse a valid token",
+			secret: "secret",
+			token:  valid,
+			want:   TokenClaims{SID: "room", Role: RoleHost, ExpiresAt: 2000},
+		},
+		{
+			name:   "Must reject a token signed with another secret",
+			secret: "other",
+			token:  valid,
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "Must reject tampered claims",
+			secret: "secret",
+			token:  parts[0] + "." + tokenEncoding.EncodeToString([]byte(`{"sid":"room","role":"host","exp":9000}`)) + "." + parts[2],
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "Must reject unsigned tokens",
+			secret: "secret",
+			token:  unsigned,
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "Must reject expired tokens",
+			secret: "secret",
+			token:  expired,
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "Must reject unknown roles",
+			secret: "secret",
+			token:  badRole,
+			err:    ErrInvalidToken,
+		},
+		{
+			name:   "Must reject malformed tokens",
+			secret: "secret",
+			token:  "token",
+			err:    ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseToken(tt.secret, tt.token, now)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type joinProvider struct {
+	role    Role
+	created []SessionConfig
+}
+
+func (j *joinProvider) GetSession(sid string) (*Session, WebRTCTransportConfig) {
+	return nil, WebRTCTransportConfig{}
+}
+
+func (j *joinProvider) CreateSession(sid string, c SessionConfig) (*Session, error) {
+	j.created = append(j.created, c)
+	return nil, nil
+}
+
+func (j *joinProvider) VerifyToken(sid, token string) (Role, error) {
+	return j.role, nil
+}
+
+func TestPeer_joinConfig(t *testing.T) {
+	config := SessionConfig{
+		MaxPeers:     2,
+		DataChannels: []DataChannelConfig{{Label: "*", Relay: DataChannelRelayNone}},
+		DefaultRole:  RoleAttendee,
+	}
+	tests := []struct {
+		name    string
+		role    Role
+		trusted bool
+		want    []SessionConfig
+	}{
+		{
+			name: "Must apply the config of a host",
+			role: RoleHost,
+			want: []SessionConfig{config},
+		},
+		{
+			name: "Must ignore the config of a presenter",
+			role: RolePresenter,
+		},
+		{
+			name: "Must ignore the config of a peer without role",
+		},
+		{
+			name:    "Must apply the config given by the server",
+			role:    RoleAttendee,
+			trusted: true,
+			want:    []SessionConfig{config},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &joinProvider{role: tt.role}
+			p := NewPeer(provider)
+			var err error
+			if tt.trusted {
+				_, err = p.JoinWithConfig("room", webrtc.SessionDescription{}, config)
+			} else {
+				_, err = p.JoinWithToken("room", webrtc.SessionDescription{}, "token", &config)
+			}
+			assert.Equal(t, ErrSessionUnavailable, err)
+			assert.Equal(t, tt.want, provider.created)
+		})
+	}
+}